@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"load_balancer/models"
+	adminpb "load_balancer/proto/lbadmin"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adminServer implements the load balancer's admin service.
+type adminServer struct {
+	adminpb.UnimplementedLBAdminServer
+}
+
+func startAdminServer(address string, admin *adminServer) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	grpcServer := grpc.NewServer()
+	adminpb.RegisterLBAdminServer(grpcServer, admin)
+	log.Printf("Admin server is running on address %s...\n", address)
+	if err := grpcServer.Serve(lis); err != nil {
+		log.Fatalf("Failed to serve admin: %v", err)
+	}
+}
+
+func (s *adminServer) ListBackends(ctx context.Context, req *adminpb.ListBackendsRequest) (*adminpb.ListBackendsResponse, error) {
+	resp := &adminpb.ListBackendsResponse{Strategy: serverPool.Strategy().Name()}
+	if holder, ok := lease.Holder(); ok {
+		resp.MembershipLeader = holder.Address
+	}
+	for _, b := range serverPool.Backends() {
+		resp.Backends = append(resp.Backends, &adminpb.Backend{
+			Id:            b.ID,
+			Address:       b.Address,
+			Healthy:       b.Healthy,
+			Leader:        b.Leader,
+			InFlight:      b.InFlight,
+			EwmaLatencyMs: float64(b.Latency.Microseconds()) / 1000,
+			Requests:      b.Requests,
+			Failures:      b.Failures,
+			Weight:        int32(b.Weight),
+			Breaker:       b.Breaker.String(),
+			ErrorRate:     b.ErrorRate,
+			Draining:      b.Draining,
+		})
+	}
+	return resp, nil
+}
+
+func (s *adminServer) ListInstances(ctx context.Context, req *adminpb.ListInstancesRequest) (*adminpb.ListInstancesResponse, error) {
+	if leader, remote, err := membershipLeader(ctx); err != nil {
+		return nil, err
+	} else if remote {
+		conn, err := dialPeer(leader.Admin)
+		if err != nil {
+			return nil, err
+		}
+		return adminpb.NewLBAdminClient(conn).ListInstances(forwardContext(ctx), req)
+	}
+	resp := &adminpb.ListInstancesResponse{Launcher: instanceLauncher.Kind()}
+	for _, inst := range instanceLauncher.Instances() {
+		var startedAt int64
+		if !inst.StartedAt.IsZero() {
+			startedAt = inst.StartedAt.Unix()
+		}
+		resp.Instances = append(resp.Instances, &adminpb.Instance{
+			Id:            inst.ID,
+			KvAddress:     inst.KVAddress,
+			State:         inst.State.String(),
+			Pid:           int64(inst.PID),
+			Restarts:      int32(inst.Restarts),
+			StartedAtUnix: startedAt,
+			LastExit:      inst.LastExit,
+			LogFile:       inst.LogFile,
+		})
+	}
+	return resp, nil
+}
+
+func (s *adminServer) Decommission(req *adminpb.DecommissionRequest, stream adminpb.LBAdmin_DecommissionServer) error {
+	log.Printf("Decommissioning server: %s\n", req.Address)
+	report := logReport(req.Address)
+	return decommission(stream.Context(), req.Address, func(stage, state, detail string) {
+		report(stage, state, detail)
+		stream.Send(&adminpb.DecommissionStatus{Stage: stage, State: state, Detail: detail})
+	})
+}
+
+func (s *adminServer) SetDraining(ctx context.Context, req *adminpb.SetDrainingRequest) (*adminpb.SetDrainingResponse, error) {
+	if _, ok := serverPool.ID(req.Address); !ok {
+		return nil, status.Errorf(codes.NotFound, "no backend at %s", req.Address)
+	}
+	if err := setDraining(ctx, req.Address, req.Draining); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	id, _ := serverPool.ID(req.Address)
+	if req.Draining {
+		clusterEvents.Record(models.EventDrained, id, req.Address, "by an admin")
+	} else {
+		clusterEvents.Record(models.EventUndrained, id, req.Address, "by an admin")
+	}
+	return &adminpb.SetDrainingResponse{}, nil
+}
+
+func (s *adminServer) RecheckHealth(ctx context.Context, req *adminpb.RecheckHealthRequest) (*adminpb.ListBackendsResponse, error) {
+	if err := serverPool.RecheckHealth(ctx); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return s.ListBackends(ctx, &adminpb.ListBackendsRequest{})
+}
+
+func (s *adminServer) SetStrategy(ctx context.Context, req *adminpb.SetStrategyRequest) (*adminpb.SetStrategyResponse, error) {
+	strategy, err := models.NewStrategy(req.Strategy)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	previous := serverPool.Strategy().Name()
+	serverPool.SetStrategy(strategy)
+	log.Printf("Balancing strategy changed from %s to %s\n", previous, strategy.Name())
+	return &adminpb.SetStrategyResponse{Previous: previous, Strategy: strategy.Name()}, nil
+}
+
+func (s *adminServer) ListEvents(ctx context.Context, req *adminpb.ListEventsRequest) (*adminpb.ListEventsResponse, error) {
+	events := clusterEvents.Recent()
+	if req.Limit > 0 && int(req.Limit) < len(events) {
+		events = events[len(events)-int(req.Limit):]
+	}
+	resp := &adminpb.ListEventsResponse{}
+	for _, e := range events {
+		resp.Events = append(resp.Events, &adminpb.Event{
+			TimeUnixMs: e.Time.UnixMilli(),
+			Type:       e.Type,
+			Member:     e.Member,
+			Address:    e.Address,
+			Detail:     e.Detail,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	adminpb "load_balancer/proto/lbadmin"
+	"log"
+	"net/http"
+	"strconv"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var jsonOptions = protojson.MarshalOptions{EmitUnpopulated: true}
+
+// startAdminHTTPServer serves the admin service as JSON over HTTP:
+//
+//	GET  /backends
+//	GET  /instances
+//	GET  /events?limit=N
+//	POST /backends/drain?address=A
+//	POST /backends/undrain?address=A
+//	POST /health/recheck
+//	POST /strategy?name=S
+//	POST /decommission?address=A, streaming one stage status per line
+func startAdminHTTPServer(address string, admin *adminServer) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /backends", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.ListBackends(r.Context(), &adminpb.ListBackendsRequest{})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("GET /instances", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.ListInstances(r.Context(), &adminpb.ListInstancesRequest{})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		req := &adminpb.ListEventsRequest{}
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			n, err := strconv.ParseInt(limit, 10, 32)
+			if err != nil {
+				writeJSON(w, nil, status.Errorf(codes.InvalidArgument, "invalid limit %q", limit))
+				return
+			}
+			req.Limit = int32(n)
+		}
+		resp, err := admin.ListEvents(r.Context(), req)
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("POST /backends/drain", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.SetDraining(r.Context(), &adminpb.SetDrainingRequest{Address: r.URL.Query().Get("address"), Draining: true})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("POST /backends/undrain", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.SetDraining(r.Context(), &adminpb.SetDrainingRequest{Address: r.URL.Query().Get("address")})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("POST /health/recheck", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.RecheckHealth(r.Context(), &adminpb.RecheckHealthRequest{})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("POST /strategy", func(w http.ResponseWriter, r *http.Request) {
+		resp, err := admin.SetStrategy(r.Context(), &adminpb.SetStrategyRequest{Strategy: r.URL.Query().Get("name")})
+		writeJSON(w, resp, err)
+	})
+	mux.HandleFunc("POST /decommission", decommissionHandler(decommission))
+
+	log.Printf("Admin HTTP server is running on address %s...\n", address)
+	if err := http.ListenAndServe(address, mux); err != nil {
+		log.Fatalf("Failed to serve admin HTTP: %v", err)
+	}
+}
+
+// decommissionHandler streams the stages run reports as JSON lines. If run
+// fails before reporting anything, the error is returned as with writeJSON;
+// otherwise it ends the stream as a failed stage, unless run reported the
+// failure itself.
+func decommissionHandler(run func(ctx context.Context, address string, report reportFunc) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		address := r.URL.Query().Get("address")
+		log.Printf("Decommissioning server: %s\n", address)
+		flusher, _ := w.(http.Flusher)
+		logged := logReport(address)
+		var last *adminpb.DecommissionStatus
+		write := func(st *adminpb.DecommissionStatus) {
+			data, _ := jsonOptions.Marshal(st)
+			w.Write(append(data, '\n'))
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		err := run(r.Context(), address, func(stage, state, detail string) {
+			logged(stage, state, detail)
+			if last == nil {
+				w.Header().Set("Content-Type", "application/x-ndjson")
+			}
+			last = &adminpb.DecommissionStatus{Stage: stage, State: state, Detail: detail}
+			write(last)
+		})
+		switch {
+		case err == nil:
+		case last == nil:
+			log.Printf("Decommission %s failed: %v\n", address, err)
+			writeJSON(w, nil, err)
+		case last.State != stageFailed:
+			logged(last.Stage, stageFailed, err.Error())
+			write(&adminpb.DecommissionStatus{Stage: last.Stage, State: stageFailed, Detail: status.Convert(err).Message()})
+		}
+	}
+}
+
+// writeJSON writes resp, or err as {"error": ...} with the HTTP status
+// matching its gRPC code.
+func writeJSON(w http.ResponseWriter, resp proto.Message, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		code := http.StatusInternalServerError
+		switch status.Code(err) {
+		case codes.InvalidArgument:
+			code = http.StatusBadRequest
+		case codes.NotFound:
+			code = http.StatusNotFound
+		case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable:
+			code = http.StatusServiceUnavailable
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]string{"error": status.Convert(err).Message()})
+		return
+	}
+	data, err := jsonOptions.Marshal(resp)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	w.Write(data)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecommissionHandlerReportsErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		run  func(ctx context.Context, address string, report reportFunc) error
+		code int
+		last map[string]string
+	}{
+		{
+			name: "success",
+			run: func(ctx context.Context, address string, report reportFunc) error {
+				report(stageDrain, stageRunning, "")
+				report(stageDrain, stageDone, "")
+				return nil
+			},
+			code: http.StatusOK,
+			last: map[string]string{"stage": "drain", "state": "done", "detail": ""},
+		},
+		{
+			name: "fails before any stage",
+			run: func(ctx context.Context, address string, report reportFunc) error {
+				return errNotLeading
+			},
+			code: http.StatusServiceUnavailable,
+			last: map[string]string{"error": "no load balancer holds the membership lease"},
+		},
+		{
+			name: "fails after a stage",
+			run: func(ctx context.Context, address string, report reportFunc) error {
+				report(stageRemove, stageRunning, "")
+				return errors.New("lease holder went away")
+			},
+			code: http.StatusOK,
+			last: map[string]string{"stage": "remove", "state": "failed", "detail": "lease holder went away"},
+		},
+		{
+			name: "reports its own failure",
+			run: func(ctx context.Context, address string, report reportFunc) error {
+				report(stageDrain, stageRunning, "")
+				report(stageDrain, stageFailed, "not found")
+				return errors.New("not found")
+			},
+			code: http.StatusOK,
+			last: map[string]string{"stage": "drain", "state": "failed", "detail": "not found"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			decommissionHandler(c.run)(w, httptest.NewRequest("POST", "/decommission?address=a", nil))
+			if w.Code != c.code {
+				t.Fatalf("status = %d, want %d", w.Code, c.code)
+			}
+			lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+			var last map[string]string
+			if err := json.Unmarshal([]byte(lines[len(lines)-1]), &last); err != nil || !reflect.DeepEqual(last, c.last) {
+				t.Fatalf("last line = %s, want %v", lines[len(lines)-1], c.last)
+			}
+			if c.name == "reports its own failure" && len(lines) != 2 {
+				t.Fatalf("lines = %q, want the failure once", lines)
+			}
+		})
+	}
+}
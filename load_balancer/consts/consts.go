@@ -1,13 +1,42 @@
 package consts
 
+import "time"
+
 const (
-	KVServerListFileName   = "./config/kv_server_list"
-	RaftServerListFileName = "./config/raft_server_list"
+	KVServerListFileName = "./config/kv_server_list"
+)
+
+// Keys the load balancers coordinate through. The servers reserve
+// CoordinationPrefix: its keys can only be read and compare-and-swapped, so
+// client writes never reach them.
+const (
+	CoordinationPrefix = "\x00coord/"
+	IDCounterKey       = CoordinationPrefix + "lb/next-id"  // the lowest node ID not yet handed out
+	LeaseKey           = CoordinationPrefix + "lb/leader"   // the load balancer that runs membership operations
+	PeersKey           = CoordinationPrefix + "lb/peers"    // the load balancers sharing the cluster
+	DrainingKey        = CoordinationPrefix + "lb/draining" // backends no load balancer sends new requests to
 )
 
 const (
 	RaftPortBase         = 5000
+	KVPortBase           = 6000
 	ForceRemoveThreshold = 12
+	RemovedConnGrace     = 30 * time.Second // how long a removed backend's connection stays open for requests already sent
+	CatchUpPollInterval  = 500 * time.Millisecond
+)
+
+const (
+	DrainTimeout          = 30 * time.Second // longest wait for a draining backend's requests in flight
+	DrainPollInterval     = 50 * time.Millisecond
+	DrainSyncInterval     = time.Second // how often load balancers read the drained backends from the cluster
+	TransferLeaderTimeout = 10 * time.Second
+	RemovalTimeout        = 30 * time.Second // longest wait for a removal to show in the member registry
+)
+
+const (
+	MaxRedirects       = 8 // redirects followed for one request; the backoff adds up to more than an election timeout
+	RedirectBackoff    = 50 * time.Millisecond
+	MaxRedirectBackoff = 500 * time.Millisecond
 )
 
 const (
@@ -15,4 +44,6 @@ const (
 	InternalError = -1
 	KeyNotFound   = 1
 	Redirect      = 2
+	NoSpace       = 3
+	NotCaughtUp   = 4 // a learner is too far behind the leader to be promoted
 )
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"load_balancer/consts"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// forwardedKey marks a request one load balancer forwarded to another, which
+// must handle it itself rather than forward it again.
+const forwardedKey = "x-lb-forwarded"
+
+// errNotLeading is returned for a membership operation while no load
+// balancer is known to hold the lease.
+var errNotLeading = status.Error(codes.Unavailable, "no load balancer holds the membership lease")
+
+// clusterStore reaches the KV cluster through the pool.
+type clusterStore struct{}
+
+func (clusterStore) Get(ctx context.Context, key string) (string, bool, error) {
+	client := serverPool.LeaderClient()
+	if client == nil {
+		return "", false, errUnavailable
+	}
+	resp, err := client.Get(ctx, &pb.GetRequest{Key: key})
+	if err != nil {
+		return "", false, err
+	}
+	switch resp.Status {
+	case consts.Success:
+		return resp.Value, true, nil
+	case consts.KeyNotFound:
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("get %s: status %d", key, resp.Status)
+}
+
+func (clusterStore) CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (bool, string, bool, error) {
+	resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.CompareAndSwapResponse, error) {
+		return client.CompareAndSwap(ctx, &pb.CompareAndSwapRequest{Key: key, Expected: expected, ExpectMissing: expectMissing, Value: value})
+	})
+	if err != nil {
+		return false, "", false, err
+	}
+	if resp.Status != consts.Success {
+		return false, "", false, fmt.Errorf("compare-and-swap %s: status %d", key, resp.Status)
+	}
+	return resp.Swapped, resp.CurrentValue, resp.Found, nil
+}
+
+// drainMu keeps syncDraining from applying a set read before setDraining
+// changed it.
+var drainMu sync.Mutex
+
+// setDraining keeps the backend at address from new requests on every load
+// balancer, or lets it take them again. The drained backends are kept in
+// the cluster; the other load balancers pick them up within
+// consts.DrainSyncInterval.
+func setDraining(ctx context.Context, address string, draining bool) error {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+	if _, err := models.UpdateSet(ctx, clusterStore{}, consts.DrainingKey, address, draining); err != nil {
+		return fmt.Errorf("failed to share the drain with other load balancers: %w", err)
+	}
+	serverPool.SetDraining(address, draining)
+	return nil
+}
+
+// syncDraining drains the backends other load balancers drained, and lets
+// those they undrained take requests again, every interval.
+func syncDraining(interval time.Duration) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		drainMu.Lock()
+		drained, err := models.ReadSet(ctx, clusterStore{}, consts.DrainingKey)
+		if err == nil {
+			serverPool.SetDrained(drained)
+		}
+		drainMu.Unlock()
+		cancel()
+		if err != nil {
+			log.Printf("Failed to read the drained backends: %v\n", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// allocateID takes a node ID no load balancer has handed out.
+func allocateID(ctx context.Context) (uint64, error) {
+	return models.AllocateID(ctx, clusterStore{}, consts.IDCounterKey, serverPool.IDFloor())
+}
+
+// membershipLeader returns the load balancer that runs membership
+// operations, with remote false if it is this one. Requests forwarded to
+// this load balancer are never forwarded again.
+func membershipLeader(ctx context.Context) (holder models.LeaseHolder, remote bool, err error) {
+	if lease.Leading() {
+		return holder, false, nil
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get(forwardedKey)) > 0 {
+		return holder, false, errNotLeading
+	}
+	holder, ok := lease.Holder()
+	if !ok || holder == self {
+		return holder, false, errNotLeading
+	}
+	return holder, true, nil
+}
+
+// forwardContext marks ctx as forwarded by this load balancer.
+func forwardContext(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, forwardedKey, self.Address)
+}
+
+var (
+	peerConnsMu sync.Mutex
+	peerConns   = make(map[string]*grpc.ClientConn) // other load balancers, by address
+)
+
+// dialPeer returns a connection to another load balancer's key-value or
+// admin service.
+func dialPeer(address string) (*grpc.ClientConn, error) {
+	peerConnsMu.Lock()
+	defer peerConnsMu.Unlock()
+	if conn, ok := peerConns[address]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	peerConns[address] = conn
+	return conn, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"load_balancer/consts"
+	"load_balancer/launcher"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	adminpb "load_balancer/proto/lbadmin"
+	"log"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stages of decommissioning a member, in the order they run.
+const (
+	stageDrain              = "drain"
+	stageTransferLeadership = "transfer-leadership"
+	stageInFlight           = "in-flight"
+	stageRemove             = "remove"
+	stageConfirmRemoved     = "confirm-removed"
+	stageShutdown           = "shutdown"
+)
+
+// States a stage reports.
+const (
+	stageRunning = "running"
+	stageDone    = "done"
+	stageSkipped = "skipped"
+	stageFailed  = "failed"
+)
+
+// reportFunc receives the state of each decommission stage as it changes.
+type reportFunc func(stage, state, detail string)
+
+// logReport logs decommission stages for callers that do not watch them.
+func logReport(address string) reportFunc {
+	return func(stage, state, detail string) {
+		log.Printf("Decommission %s: %s %s: %s\n", address, stage, state, detail)
+	}
+}
+
+// decommission takes the member at address out of the cluster. It drains the
+// backend on every load balancer, moves leadership away from it, waits for
+// their requests in flight to it, removes it through raft, waits until the
+// removal is applied, and shuts the instance down. If a stage before the
+// removal fails, the backend takes requests again. Draining only stops reads:
+// writes follow the leader, so leadership moves before the wait for requests
+// in flight, or writes would keep arriving until the wait timed out.
+func decommission(ctx context.Context, address string, report reportFunc) error {
+	if leader, remote, err := membershipLeader(ctx); err != nil {
+		return err
+	} else if remote {
+		return forwardDecommission(ctx, leader, address, report)
+	}
+
+	id, ok := serverPool.ID(address)
+	report(stageDrain, stageRunning, "")
+	if !ok {
+		err := fmt.Errorf("server address not found in the server pool. Address: %s", address)
+		report(stageDrain, stageFailed, err.Error())
+		return err
+	}
+	if err := setDraining(ctx, address, true); err != nil {
+		report(stageDrain, stageFailed, err.Error())
+		return err
+	}
+	client := serverPool.GetClientByAddress(address)
+	clusterEvents.Record(models.EventDecommissioning, id, address, "draining")
+	report(stageDrain, stageDone, "no new requests are sent to it")
+
+	fail := func(stage string, err error, undrain bool) error {
+		report(stage, stageFailed, err.Error())
+		clusterEvents.Record(models.EventFailed, id, address, fmt.Sprintf("decommission %s: %v", stage, err))
+		if undrain {
+			undrainEverywhere(ctx, address)
+		}
+		return err
+	}
+
+	report(stageTransferLeadership, stageRunning, "")
+	transferCtx, cancel := context.WithTimeout(ctx, consts.TransferLeaderTimeout)
+	transfer, err := callLeader(transferCtx, func(client pb.KVStoreServiceClient) (*pb.TransferLeaderResponse, error) {
+		return client.TransferLeader(transferCtx, &pb.TransferLeaderRequest{Id: id})
+	})
+	cancel()
+	if err == nil && transfer.Status != consts.Success {
+		err = fmt.Errorf("status %d", transfer.Status)
+	}
+	if err != nil {
+		return fail(stageTransferLeadership, err, true)
+	}
+	if transfer.LeaderAddress != "" {
+		serverPool.ObserveRedirect(transfer.LeaderAddress)
+	}
+	report(stageTransferLeadership, stageDone, "leader is "+transfer.LeaderAddress)
+
+	report(stageInFlight, stageRunning, "")
+	if left, unsure := waitForInFlight(ctx, address); len(unsure) > 0 {
+		report(stageInFlight, stageDone, fmt.Sprintf("gave up waiting with %d requests in flight and no drain confirmed by %v", left, unsure))
+	} else if left > 0 {
+		report(stageInFlight, stageDone, fmt.Sprintf("gave up waiting with %d requests in flight", left))
+	} else {
+		report(stageInFlight, stageDone, "no requests in flight on any load balancer")
+	}
+
+	report(stageRemove, stageRunning, "")
+	// Once removed, the server exits by itself and must not be restarted.
+	instanceLauncher.Retire(id)
+	leave, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.LeaveResponse, error) {
+		return client.Leave(ctx, &pb.LeaveRequest{ServerName: address, Id: id})
+	})
+	if err == nil && leave.Status != consts.Success {
+		err = fmt.Errorf("status %d", leave.Status)
+	}
+	if err != nil {
+		return fail(stageRemove, fmt.Errorf("failed to remove node from raft cluster: %v", err), true)
+	}
+	report(stageRemove, stageDone, "removal proposed")
+
+	report(stageConfirmRemoved, stageRunning, "")
+	confirmCtx, cancel := context.WithTimeout(ctx, consts.RemovalTimeout)
+	err = waitForRegistry(confirmCtx, func(members []*pb.Member) bool { return registered(members, id) == nil })
+	cancel()
+	if err != nil {
+		return fail(stageConfirmRemoved, fmt.Errorf("removal not applied: %v", err), false)
+	}
+	serverPool.RemoveServer(address)
+	report(stageConfirmRemoved, stageDone, "removed from the member registry")
+
+	// The address may be reused by a later member, which must not start out
+	// drained.
+	undrainEverywhere(ctx, address)
+
+	report(stageShutdown, stageRunning, "")
+	if detail, err := shutdown(ctx, id, client); err != nil {
+		report(stageShutdown, stageFailed, err.Error())
+		clusterEvents.Record(models.EventDecommissioned, id, address, "removed but not shut down: "+err.Error())
+	} else {
+		report(stageShutdown, stageDone, detail)
+		clusterEvents.Record(models.EventDecommissioned, id, address, "removed and shut down")
+	}
+	return nil
+}
+
+// shutdown stops a removed member's instance through the launcher or, if the
+// launcher does not run it, by sending Close. It describes what it did.
+func shutdown(ctx context.Context, id uint64, client pb.KVStoreServiceClient) (string, error) {
+	err := instanceLauncher.Stop(id)
+	if err == nil {
+		return "instance stopped", nil
+	}
+	if !errors.Is(err, launcher.ErrUnmanaged) {
+		log.Printf("Failed to stop instance %d, sending Close: %v\n", id, err)
+	}
+	resp, closeErr := client.Close(ctx, &pb.CloseRequest{Clean: 1})
+	switch {
+	case closeErr == nil && resp.Status == consts.Success:
+		return fmt.Sprintf("%v; closed it", err), nil
+	case status.Code(closeErr) == codes.Unavailable:
+		// A removed member exits once a peer turns it away.
+		return fmt.Sprintf("%v; it had already exited", err), nil
+	case closeErr == nil:
+		closeErr = fmt.Errorf("status %d", resp.Status)
+	}
+	return "", fmt.Errorf("%v; close failed: %v", err, closeErr)
+}
+
+// forwardDecommission has the lease holder decommission the member at
+// address, and relays the stages it reports.
+func forwardDecommission(ctx context.Context, leader models.LeaseHolder, address string, report reportFunc) error {
+	conn, err := dialPeer(leader.Admin)
+	if err != nil {
+		return err
+	}
+	log.Printf("Forwarding decommission of %s to %s\n", address, leader.Admin)
+	stream, err := adminpb.NewLBAdminClient(conn).Decommission(forwardContext(ctx), &adminpb.DecommissionRequest{Address: address})
+	if err != nil {
+		return err
+	}
+	for {
+		st, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		report(st.Stage, st.State, st.Detail)
+	}
+}
+
+// undrainEverywhere lets the backend at address take requests again on every
+// load balancer, even after the caller of the decommission has gone.
+func undrainEverywhere(ctx context.Context, address string) {
+	if err := setDraining(context.WithoutCancel(ctx), address, false); err != nil {
+		log.Printf("Failed to undrain %s: %v\n", address, err)
+	}
+}
+
+// waitForInFlight waits until no load balancer has requests in flight to the
+// backend at address, or for consts.DrainTimeout. The other load balancers
+// count once they report the backend drained, which they do within
+// consts.DrainSyncInterval. It returns how many requests are left, and the
+// load balancers that did not confirm the drain.
+func waitForInFlight(ctx context.Context, address string) (left int64, unsure []string) {
+	deadline := time.After(consts.DrainTimeout)
+	for {
+		left, unsure = inFlight(serverPool.Backends(), address), nil
+		for _, peer := range livePeers() {
+			n, err := peerInFlight(ctx, peer, address)
+			if err != nil {
+				unsure = append(unsure, peer.Address)
+				continue
+			}
+			left += n
+		}
+		if left == 0 && len(unsure) == 0 {
+			return 0, nil
+		}
+		select {
+		case <-ctx.Done():
+			return left, unsure
+		case <-deadline:
+			return left, unsure
+		case <-time.After(consts.DrainPollInterval):
+		}
+	}
+}
+
+// livePeers returns the other load balancers known to be running.
+func livePeers() []models.LeaseHolder {
+	if peers == nil {
+		return nil
+	}
+	return peers.Live()
+}
+
+// peerInFlight asks another load balancer how many requests it has in
+// flight to the backend at address, which it must report as draining.
+func peerInFlight(ctx context.Context, peer models.LeaseHolder, address string) (int64, error) {
+	conn, err := dialPeer(peer.Admin)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, consts.DrainSyncInterval)
+	defer cancel()
+	resp, err := adminpb.NewLBAdminClient(conn).ListBackends(ctx, &adminpb.ListBackendsRequest{})
+	if err != nil {
+		return 0, err
+	}
+	for _, b := range resp.Backends {
+		if b.Address == address {
+			if !b.Draining {
+				return 0, fmt.Errorf("%s still sends requests to %s", peer.Address, address)
+			}
+			return b.InFlight, nil
+		}
+	}
+	// It has removed the backend already.
+	return 0, nil
+}
+
+func inFlight(backends []models.BackendStatus, address string) int64 {
+	for _, b := range backends {
+		if b.Address == address {
+			return b.InFlight
+		}
+	}
+	return 0
+}
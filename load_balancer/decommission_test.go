@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"load_balancer/consts"
+	"load_balancer/launcher"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	adminpb "load_balancer/proto/lbadmin"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestShutdownClosesUnmanagedInstance(t *testing.T) {
+	f := newFakeCluster(t, 2)
+	old := instanceLauncher
+	t.Cleanup(func() { instanceLauncher = old })
+	instanceLauncher = launcher.NewExternal()
+	ctx := context.Background()
+
+	detail, err := shutdown(ctx, 1, serverPool.GetClientByAddress(f.addresses[0]))
+	if err != nil || !strings.Contains(detail, "closed it") {
+		t.Fatalf("shutdown = %q, %v; want it closed", detail, err)
+	}
+	if got := f.count(f.addresses[0], "close"); got != 1 {
+		t.Fatalf("Close sent %d times, want 1", got)
+	}
+
+	f.stop(f.addresses[1])
+	detail, err = shutdown(ctx, 2, serverPool.GetClientByAddress(f.addresses[1]))
+	if err != nil || !strings.Contains(detail, "already exited") {
+		t.Fatalf("shutdown of an exited instance = %q, %v; want it reported as exited", detail, err)
+	}
+}
+
+// memStore is a models.CoordinationStore in memory.
+type memStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func (s *memStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, found := s.data[key]
+	return value, found, nil
+}
+
+func (s *memStore) CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (bool, string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found := s.data[key]
+	if (found && current == expected) || (!found && expectMissing) {
+		s.data[key] = value
+		return true, value, true, nil
+	}
+	return false, current, found, nil
+}
+
+// fakePeer is another load balancer's admin service, reporting one backend.
+type fakePeer struct {
+	adminpb.UnimplementedLBAdminServer
+	mu      sync.Mutex
+	backend *adminpb.Backend
+}
+
+func (p *fakePeer) set(draining bool, inFlight int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.backend.Draining, p.backend.InFlight = draining, inFlight
+}
+
+func (p *fakePeer) ListBackends(ctx context.Context, req *adminpb.ListBackendsRequest) (*adminpb.ListBackendsResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return &adminpb.ListBackendsResponse{Backends: []*adminpb.Backend{proto.Clone(p.backend).(*adminpb.Backend)}}, nil
+}
+
+func TestWaitForInFlightOnEveryLoadBalancer(t *testing.T) {
+	f := newFakeCluster(t, 1)
+	address := f.addresses[0]
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := &fakePeer{backend: &adminpb.Backend{Id: 1, Address: address}}
+	server := grpc.NewServer()
+	adminpb.RegisterLBAdminServer(server, peer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	// Both load balancers register; this one learns of the other.
+	store := &memStore{data: make(map[string]string)}
+	ctx := context.Background()
+	other := models.NewPeers(store, consts.PeersKey, models.LeaseHolder{Address: "other:8080", Admin: lis.Addr().String()}, time.Minute)
+	old := peers
+	t.Cleanup(func() { peers = old })
+	peers = models.NewPeers(store, consts.PeersKey, models.LeaseHolder{Address: "self:8080"}, time.Minute)
+	if err := other.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := peers.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	wait := func() (int64, []string) {
+		ctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer cancel()
+		return waitForInFlight(ctx, address)
+	}
+	if left, unsure := wait(); !slices.Equal(unsure, []string{"other:8080"}) {
+		t.Fatalf("waitForInFlight = %d, %v; want the peer that has not drained", left, unsure)
+	}
+	peer.set(true, 2)
+	if left, unsure := wait(); left != 2 || len(unsure) != 0 {
+		t.Fatalf("waitForInFlight = %d, %v; want the peer's 2 requests", left, unsure)
+	}
+	peer.set(true, 0)
+	if left, unsure := wait(); left != 0 || len(unsure) != 0 {
+		t.Fatalf("waitForInFlight = %d, %v; want none left", left, unsure)
+	}
+}
+
+func TestDecommissionLeaderWhileWriting(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	leader := f.addresses[0]
+	serverPool.SetLeader(1)
+	f.writeDelay = 20 * time.Millisecond
+
+	oldLauncher, oldLease, oldSelf := instanceLauncher, lease, self
+	t.Cleanup(func() { instanceLauncher, lease, self = oldLauncher, oldLease, oldSelf })
+	instanceLauncher = launcher.NewExternal()
+	self = models.LeaseHolder{Address: "self:8080"}
+	lease = models.NewLease(&memStore{data: make(map[string]string)}, consts.LeaseKey, self, time.Minute)
+	go lease.Run()
+	for deadline := time.Now().Add(5 * time.Second); !lease.Leading(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("lease not taken")
+		}
+	}
+
+	// Writes keep coming while the leader is decommissioned.
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	var writeErrs []error
+	var errMu sync.Mutex
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				resp, err := (&server{}).Put(context.Background(), &pb.PutRequest{Key: "k", Value: "v"})
+				if err == nil && resp.Status != consts.Success {
+					err = fmt.Errorf("status %d", resp.Status)
+				}
+				if err != nil {
+					errMu.Lock()
+					writeErrs = append(writeErrs, err)
+					errMu.Unlock()
+				}
+			}
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.count(leader, "put") == 0; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("no writes reached the leader")
+		}
+	}
+
+	var stages []string
+	details := make(map[string]string)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	start := time.Now()
+	err := decommission(ctx, leader, func(stage, state, detail string) {
+		if state != stageRunning {
+			stages = append(stages, stage)
+			details[stage] = detail
+		}
+	})
+	elapsed := time.Since(start)
+	close(stop)
+	wg.Wait()
+
+	if err != nil {
+		t.Fatalf("decommission: %v (stages %v)", err, details)
+	}
+	want := []string{stageDrain, stageTransferLeadership, stageInFlight, stageRemove, stageConfirmRemoved, stageShutdown}
+	if !slices.Equal(stages, want) {
+		t.Fatalf("stages = %v, want %v", stages, want)
+	}
+	if details[stageInFlight] != "no requests in flight on any load balancer" {
+		t.Fatalf("in-flight stage: %q, want the leader's writes drained", details[stageInFlight])
+	}
+	if elapsed > consts.DrainTimeout/2 {
+		t.Fatalf("decommission took %v, want the in-flight wait not to time out", elapsed)
+	}
+	if len(writeErrs) > 0 {
+		t.Fatalf("%d writes failed during the decommission, first: %v", len(writeErrs), writeErrs[0])
+	}
+	if id, _, ok := serverPool.Leader(); !ok || id != 2 {
+		t.Fatalf("leader = %d, %v; want the new leader 2", id, ok)
+	}
+}
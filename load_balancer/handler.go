@@ -4,14 +4,15 @@ import (
 	"context"
 	"fmt"
 	"load_balancer/consts"
+	"load_balancer/launcher"
 	pb "load_balancer/proto/kv739" // Import the generated package
 	"load_balancer/utils"
 	"log"
-	"os"
-	"os/exec"
 	"sync"
-	"syscall"
 	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // Define a struct that implements the KeyValueServiceServer interface.
@@ -23,32 +24,85 @@ type server struct {
 // Get Implement the Get method.
 func (s *server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
 	//log.Printf("Getting key: %s\n", req.Key)
-	client := serverPool.LoadBalance()
-	if client == nil {
-		return &pb.GetResponse{Status: consts.InternalError}, fmt.Errorf("server address not found in the server pool. Address: %s", req.Key)
+	return getWithRetries(ctx, req)
+}
+
+// redirectable is a response that can point the caller at the leader.
+type redirectable interface {
+	GetStatus() int32
+	GetLeaderAddress() string
+}
+
+// callLeader sends a request to the known leader and follows up to
+// MaxRedirects redirects. A redirect without an address, or a leader that
+// cannot be reached, means an election is under way, so it backs off and
+// asks another backend.
+func callLeader[R redirectable](ctx context.Context, call func(pb.KVStoreServiceClient) (R, error)) (R, error) {
+	client := serverPool.LeaderClient()
+	backoff := consts.RedirectBackoff
+	for redirects := 0; ; redirects++ {
+		if client == nil {
+			var none R
+			return none, errUnavailable
+		}
+		resp, err := call(client)
+		unreachable := status.Code(err) == codes.Unavailable
+		if unreachable {
+			serverPool.ClearLeader()
+		} else if err != nil || resp.GetStatus() != consts.Redirect {
+			return resp, err
+		}
+		if redirects == consts.MaxRedirects {
+			if err == nil {
+				err = fmt.Errorf("no leader after %d redirects", redirects)
+			}
+			return resp, err
+		}
+
+		var address string
+		if !unreachable {
+			address = resp.GetLeaderAddress()
+		}
+		if address != "" && redirects == 0 {
+			log.Printf("Redirecting to leader: %s\n", address)
+			client = serverPool.ObserveRedirect(address)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return resp, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, consts.MaxRedirectBackoff)
+		if address != "" {
+			client = serverPool.ObserveRedirect(address)
+		} else {
+			serverPool.ClearLeader()
+			client = serverPool.LeaderClient()
+		}
 	}
-	return client.Get(ctx, req)
 }
 
 // Put Implement the Put method.
 func (s *server) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
 	//log.Printf("Storing key: %s with value: %s\n", req.Key, req.Value)
-	client := serverPool.LoadBalance()
-	resp, err := client.Put(ctx, req)
+	resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.PutResponse, error) {
+		return client.Put(ctx, req)
+	})
 	if err != nil {
 		log.Printf("Error storing key: %v", err)
-		return resp, err
 	}
+	return resp, err
+}
 
-	if resp.Status == consts.Redirect && resp.LeaderAddress != "" {
-		// Redirect to the leader
-		client = serverPool.GetClientByAddress(resp.LeaderAddress)
-		if client == nil {
-			return &pb.PutResponse{Status: consts.InternalError}, fmt.Errorf("leader address not found in the server pool. Address: %s", resp.LeaderAddress)
-		}
-		return client.Put(ctx, req)
+// Delete Implement the Delete method.
+func (s *server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.DeleteResponse, error) {
+		return client.Delete(ctx, req)
+	})
+	if err != nil {
+		log.Printf("Error deleting key: %v", err)
 	}
-
 	return resp, err
 }
 
@@ -63,101 +117,85 @@ func (s *server) Close(ctx context.Context, req *pb.CloseRequest) (*pb.CloseResp
 		return &pb.CloseResponse{Status: consts.InternalError}, fmt.Errorf("server address not found in the server pool. Address: %s", req.ServerName)
 	}
 
-	serverPool.Health[serverPool.AddressToID[req.ServerName]] = 1
+	serverPool.SetHealthy(req.ServerName, false)
 	return client.Close(ctx, req)
 }
 
 func (s *server) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
 	log.Printf("Starting server: %s\n", req.ServerName)
-	if req.New == 1 {
-		newId := serverPool.NextID()
-		if err := utils.AddInstanceToConfigFile(newId, req.ServerName, utils.GenRaftAddr(newId)); err != nil {
+	if leader, remote, err := membershipLeader(ctx); err != nil {
+		return &pb.StartResponse{Status: consts.InternalError}, err
+	} else if remote {
+		conn, err := dialPeer(leader.Address)
+		if err != nil {
 			return &pb.StartResponse{Status: consts.InternalError}, err
 		}
+		log.Printf("Forwarding start of %s to %s\n", req.ServerName, leader.Address)
+		return pb.NewKVStoreServiceClient(conn).Start(forwardContext(ctx), req)
+	}
 
-		client := serverPool.LoadBalance()
-		if client == nil {
-			return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("server address not found in the server pool. Address: %s", req.ServerName)
-		}
-		req.Id = newId
-		resp, err := client.Start(ctx, req)
-		if err != nil || (resp.Status != consts.Success && resp.Status != consts.Redirect) {
-			return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("failed to add node to raft cluster: %v", err)
-		}
-
-		if resp.Status == consts.Redirect && resp.LeaderAddress != "" {
-			// Redirect to the leader
-			log.Printf("Redirecting to leader: %s\n", resp.LeaderAddress)
-			client = serverPool.GetClientByAddress(resp.LeaderAddress)
-			if client == nil {
-				return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("leader address not found in the server pool. Address: %s", resp.LeaderAddress)
-			}
-			resp, err = client.Start(ctx, req)
-			if err != nil || resp.Status != consts.Success {
-				return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("failed to add node to raft cluster: %v", err)
-			}
+	if req.New == 1 {
+		newId, err := allocateID(ctx)
+		if err != nil {
+			return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("failed to allocate a node ID: %v", err)
 		}
-
-		time.Sleep(1 * time.Second)
-		log.Println("Starting server with ID:", newId)
-		cmd := exec.Command("./server", "--id", fmt.Sprintf("%d", newId), "--join")
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Start(); err != nil {
+		if err := startNewInstance(ctx, newId, req.ServerName, req.Learner); err != nil {
 			return &pb.StartResponse{Status: consts.InternalError}, err
 		}
 
 		log.Println("Server started successfully. ID:", newId)
-		serverPool.AddServer(newId, req.ServerName)
-		serverPool.Health[newId] = 0
+		if !req.Learner {
+			// Learners join the pool once they are promoted.
+			serverPool.AddServer(newId, req.ServerName)
+		}
 		return &pb.StartResponse{Status: consts.Success}, nil
 	} else {
-		id, ok := serverPool.AddressToID[req.ServerName]
+		id, ok := serverPool.ID(req.ServerName)
 		if !ok {
 			return &pb.StartResponse{Status: consts.InternalError}, fmt.Errorf("server address not found in the server pool. Address: %s", req.ServerName)
 		}
 
-		cmd := exec.Command("./server", "--id", fmt.Sprintf("%d", id))
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Start()
-		if err != nil {
+		if err := instanceLauncher.Start(launcher.Spec{ID: id, KVAddress: req.ServerName}); err != nil {
 			return &pb.StartResponse{Status: consts.InternalError}, err
 		}
 
-		serverPool.Health[id] = 0
+		serverPool.SetHealthy(req.ServerName, true)
 		return &pb.StartResponse{Status: consts.Success}, nil
 	}
 }
 
-func (s *server) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResponse, error) {
-	log.Printf("Stopping server: %s\n", req.ServerName)
-	client := serverPool.GetClientByAddress(req.ServerName)
-	if client == nil {
-		return &pb.LeaveResponse{Status: consts.InternalError}, fmt.Errorf("server address not found in the server pool. Address: %s", req.ServerName)
+// startNewInstance adds a member with the given ID and KV address to the
+// raft cluster, as a learner if asked, and launches its instance.
+func startNewInstance(ctx context.Context, id uint64, address string, learner bool) error {
+	raftAddress := utils.GenRaftAddr(id)
+	req := &pb.StartRequest{ServerName: address, New: 1, Id: id, RaftAddress: raftAddress, Learner: learner}
+	resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.StartResponse, error) {
+		return client.Start(ctx, req)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to add node to raft cluster: %v", err)
 	}
-
-	req.Id = serverPool.AddressToID[req.ServerName]
-	if err := utils.RemoveInstanceFromConfigFile(req.ServerName); err != nil {
-		return &pb.LeaveResponse{Status: consts.InternalError}, err
+	if resp.Status != consts.Success {
+		return fmt.Errorf("failed to add node to raft cluster: status %d", resp.Status)
 	}
-	serverPool.RemoveServer(req.ServerName)
 
-	resp, err := client.Leave(ctx, req)
-	if err != nil || (resp.Status != consts.Success && resp.Status != consts.Redirect) {
-		return &pb.LeaveResponse{Status: consts.InternalError}, fmt.Errorf("failed to remove node from raft cluster: %v", err)
-	}
+	time.Sleep(1 * time.Second)
+	log.Println("Starting server with ID:", id)
+	return instanceLauncher.Start(launcher.Spec{ID: id, KVAddress: address, RaftAddress: raftAddress, Join: true})
+}
 
-	if resp.Status == consts.Redirect && resp.LeaderAddress != "" {
-		// Redirect to the leader
-		client = serverPool.GetClientByAddress(resp.LeaderAddress)
-		if client == nil {
-			return &pb.LeaveResponse{Status: consts.InternalError}, fmt.Errorf("leader address not found in the server pool. Address: %s", resp.LeaderAddress)
-		}
-		return client.Leave(ctx, req)
-	}
+// Promote asks the leader to make a learner a voter.
+func (s *server) Promote(ctx context.Context, req *pb.PromoteRequest) (*pb.PromoteResponse, error) {
+	return callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.PromoteResponse, error) {
+		return client.Promote(ctx, req)
+	})
+}
 
+// Leave decommissions the member at req.ServerName; see decommission.
+func (s *server) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResponse, error) {
+	log.Printf("Decommissioning server: %s\n", req.ServerName)
+	if err := decommission(ctx, req.ServerName, logReport(req.ServerName)); err != nil {
+		return &pb.LeaveResponse{Status: consts.InternalError}, err
+	}
 	return &pb.LeaveResponse{Status: consts.Success}, nil
 }
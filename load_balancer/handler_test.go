@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"load_balancer/consts"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// fakeCluster runs fake key-value servers on local ports and points the
+// global server pool at them. One of them leads: the others redirect writes
+// to it.
+type fakeCluster struct {
+	mu          sync.Mutex
+	leader      string // "" while an election is under way
+	addresses   []string
+	servers     map[string]*grpc.Server
+	calls       map[string]map[string]int // requests per server and method
+	getDelay    map[string]time.Duration  // how long each server takes to read
+	getErr      map[string]error
+	firstGet    time.Duration  // how long the first read takes, wherever it goes
+	writeDelay  time.Duration  // how long the leader takes to apply a write
+	cancelled   map[string]int // reads abandoned by the load balancer
+	gets        int
+	startStatus int32
+	promoteErr  string            // why the leader refuses promotions, "" to accept them
+	data        map[string]string // keys written with compare-and-swap
+	removed     map[uint64]bool   // members removed from the registry
+}
+
+func newFakeCluster(t *testing.T, n int) *fakeCluster {
+	f := &fakeCluster{
+		servers:   make(map[string]*grpc.Server),
+		calls:     make(map[string]map[string]int),
+		getDelay:  make(map[string]time.Duration),
+		getErr:    make(map[string]error),
+		cancelled: make(map[string]int),
+		data:      make(map[string]string),
+		removed:   make(map[uint64]bool),
+	}
+	var ids []uint64
+	addresses := make(map[uint64]string)
+	for i := 1; i <= n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		address := lis.Addr().String()
+		server := grpc.NewServer()
+		pb.RegisterKVStoreServiceServer(server, &fakeBackend{cluster: f, address: address})
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+
+		f.addresses = append(f.addresses, address)
+		f.servers[address] = server
+		f.calls[address] = make(map[string]int)
+		ids = append(ids, uint64(i))
+		addresses[uint64(i)] = address
+	}
+	f.leader = f.addresses[0]
+
+	old := serverPool
+	serverPool = models.NewServerPool(ids, addresses)
+	serverPool.Connect()
+	t.Cleanup(func() {
+		serverPool.Close()
+		serverPool = old
+	})
+	return f
+}
+
+func (f *fakeCluster) setLeader(address string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leader = address
+}
+
+func (f *fakeCluster) stop(address string) {
+	f.servers[address].Stop()
+}
+
+// abandoned returns how many reads the servers saw cancelled.
+func (f *fakeCluster) abandoned() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, cancelled := range f.cancelled {
+		n += cancelled
+	}
+	return n
+}
+
+// count returns how many requests for method address has answered.
+func (f *fakeCluster) count(address, method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[address][method]
+}
+
+// total returns how many requests for method the servers have answered.
+func (f *fakeCluster) total(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, calls := range f.calls {
+		n += calls[method]
+	}
+	return n
+}
+
+// redirect counts a request for method to address and returns the leader
+// to redirect it to, or "" if address leads. ok is false while there is no
+// leader.
+func (f *fakeCluster) redirect(address, method string) (leader string, ok bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[address][method]++
+	if f.leader == address {
+		return "", true
+	}
+	return f.leader, f.leader != ""
+}
+
+type fakeBackend struct {
+	pb.UnimplementedKVStoreServiceServer
+	cluster *fakeCluster
+	address string
+}
+
+func (s *fakeBackend) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	f := s.cluster
+	f.mu.Lock()
+	f.calls[s.address]["get"]++
+	delay, err := f.getDelay[s.address], f.getErr[s.address]
+	if f.gets++; f.gets == 1 && f.firstGet > 0 {
+		delay = f.firstGet
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		f.mu.Lock()
+		f.cancelled[s.address]++
+		f.mu.Unlock()
+		return nil, ctx.Err()
+	case <-time.After(delay):
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if value, ok := f.data[req.Key]; ok {
+		return &pb.GetResponse{Status: consts.Success, Value: value}, nil
+	}
+	if strings.HasPrefix(req.Key, consts.CoordinationPrefix) {
+		return &pb.GetResponse{Status: consts.KeyNotFound}, nil
+	}
+	return &pb.GetResponse{Status: consts.Success, Value: s.address}, nil
+}
+
+func (s *fakeBackend) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.CompareAndSwapResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "cas"); leader != "" || !ok {
+		return &pb.CompareAndSwapResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	current, found := s.cluster.data[req.Key]
+	if (found && current == req.Expected) || (!found && req.ExpectMissing) {
+		s.cluster.data[req.Key] = req.Value
+		return &pb.CompareAndSwapResponse{Status: consts.Success, Swapped: true, CurrentValue: req.Value, Found: true}, nil
+	}
+	return &pb.CompareAndSwapResponse{Status: consts.Success, CurrentValue: current, Found: found}, nil
+}
+
+// TransferLeader hands leadership from member req.Id to the next member.
+func (s *fakeBackend) TransferLeader(ctx context.Context, req *pb.TransferLeaderRequest) (*pb.TransferLeaderResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "transfer"); leader != "" || !ok {
+		return &pb.TransferLeaderResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	f := s.cluster
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.addresses[req.Id-1] == f.leader {
+		f.leader = f.addresses[int(req.Id)%len(f.addresses)]
+	}
+	return &pb.TransferLeaderResponse{Status: consts.Success, LeaderAddress: f.leader}, nil
+}
+
+func (s *fakeBackend) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "leave"); leader != "" || !ok {
+		return &pb.LeaveResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	s.cluster.removed[req.Id] = true
+	return &pb.LeaveResponse{Status: consts.Success}, nil
+}
+
+func (s *fakeBackend) Members(req *pb.MembersRequest, stream pb.KVStoreService_MembersServer) error {
+	f := s.cluster
+	f.mu.Lock()
+	var members []*pb.Member
+	for i, address := range f.addresses {
+		if id := uint64(i + 1); !f.removed[id] {
+			members = append(members, &pb.Member{Id: id, KvAddress: address})
+		}
+	}
+	f.mu.Unlock()
+	return stream.Send(&pb.MembersResponse{Members: members})
+}
+
+func (s *fakeBackend) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "put"); leader != "" || !ok {
+		return &pb.PutResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	delay := s.cluster.writeDelay
+	s.cluster.mu.Unlock()
+	time.Sleep(delay)
+	return &pb.PutResponse{Status: consts.Success}, nil
+}
+
+func (s *fakeBackend) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "delete"); leader != "" || !ok {
+		return &pb.DeleteResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	return &pb.DeleteResponse{Status: consts.Success}, nil
+}
+
+func (s *fakeBackend) Close(ctx context.Context, req *pb.CloseRequest) (*pb.CloseResponse, error) {
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	s.cluster.calls[s.address]["close"]++
+	return &pb.CloseResponse{Status: consts.Success}, nil
+}
+
+func (s *fakeBackend) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "start"); leader != "" || !ok {
+		return &pb.StartResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	return &pb.StartResponse{Status: s.cluster.startStatus}, nil
+}
+
+func (s *fakeBackend) Promote(ctx context.Context, req *pb.PromoteRequest) (*pb.PromoteResponse, error) {
+	if leader, ok := s.cluster.redirect(s.address, "promote"); leader != "" || !ok {
+		return &pb.PromoteResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	if s.cluster.promoteErr != "" {
+		return &pb.PromoteResponse{Status: consts.InternalError, Error: s.cluster.promoteErr}, nil
+	}
+	return &pb.PromoteResponse{Status: consts.Success}, nil
+}
+
+func TestCallLeaderFollowsAndCachesRedirect(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	stale, leader := f.addresses[0], f.addresses[2]
+	f.setLeader(leader)
+	serverPool.SetLeader(1)
+	s := &server{}
+	ctx := context.Background()
+
+	resp, err := s.Put(ctx, &pb.PutRequest{Key: "k", Value: "v"})
+	if err != nil || resp.Status != consts.Success {
+		t.Fatalf("Put = %v, %v; want success after one redirect", resp, err)
+	}
+	if f.count(stale, "put") != 1 || f.count(leader, "put") != 1 {
+		t.Fatalf("puts on the stale leader, leader = %d, %d; want 1, 1", f.count(stale, "put"), f.count(leader, "put"))
+	}
+	if id, address, ok := serverPool.Leader(); !ok || id != 3 || address != leader {
+		t.Fatalf("leader = %d at %s, %v; want 3 at %s", id, address, ok, leader)
+	}
+
+	// The redirect is remembered, so later writes go straight to the leader.
+	if resp, err := s.Delete(ctx, &pb.DeleteRequest{Key: "k"}); err != nil || resp.Status != consts.Success {
+		t.Fatalf("Delete = %v, %v; want success", resp, err)
+	}
+	if f.count(stale, "delete") != 0 || f.count(leader, "delete") != 1 {
+		t.Fatalf("deletes on the stale leader, leader = %d, %d; want 0, 1", f.count(stale, "delete"), f.count(leader, "delete"))
+	}
+}
+
+func TestCallLeaderSkipsUnreachableLeader(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	f.setLeader(f.addresses[1])
+	f.stop(f.addresses[2])
+	serverPool.SetLeader(3)
+
+	resp, err := (&server{}).Put(context.Background(), &pb.PutRequest{Key: "k", Value: "v"})
+	if err != nil || resp.Status != consts.Success {
+		t.Fatalf("Put = %v, %v; want success on the live leader", resp, err)
+	}
+	if id, _, ok := serverPool.Leader(); ok && id == 3 {
+		t.Fatal("the unreachable leader is still cached")
+	}
+}
+
+func TestCallLeaderGivesUpWithoutLeader(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	f.setLeader("")
+	s := &server{}
+
+	// The caller's deadline ends the backoff early.
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.Put(ctx, &pb.PutRequest{Key: "k", Value: "v"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put past the deadline: %v, want context.DeadlineExceeded", err)
+	}
+
+	before := f.total("put")
+	resp, err := s.Put(context.Background(), &pb.PutRequest{Key: "k", Value: "v"})
+	if err == nil || !strings.Contains(err.Error(), "no leader") {
+		t.Fatalf("Put during an election: %v, want no leader", err)
+	}
+	if resp.GetStatus() != consts.Redirect {
+		t.Fatalf("status = %d, want the last redirect", resp.GetStatus())
+	}
+	if got := f.total("put") - before; got != consts.MaxRedirects+1 {
+		t.Fatalf("puts sent = %d, want %d", got, consts.MaxRedirects+1)
+	}
+	if _, _, ok := serverPool.Leader(); ok {
+		t.Fatal("a leader is cached after every backend redirected without one")
+	}
+}
+
+func TestStartNewInstanceReportsStatus(t *testing.T) {
+	f := newFakeCluster(t, 1)
+	f.startStatus = consts.InternalError
+
+	err := startNewInstance(context.Background(), 4, "127.0.0.1:1", false)
+	if err == nil || !strings.Contains(err.Error(), "status -1") {
+		t.Fatalf("startNewInstance = %v, want the leader's status", err)
+	}
+}
+
+func TestPromoteReportsRefusal(t *testing.T) {
+	f := newFakeCluster(t, 1)
+	f.promoteErr = "member 4 is not a learner"
+
+	_, err := promoteWhenCaughtUp(context.Background(), 4)
+	if err == nil || !strings.Contains(err.Error(), f.promoteErr) {
+		t.Fatalf("promoteWhenCaughtUp = %v, want the leader's reason", err)
+	}
+}
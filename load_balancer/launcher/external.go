@@ -0,0 +1,52 @@
+package launcher
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// External is the launcher for deployments where something else, such as
+// an orchestrator, runs the servers. It starts nothing and only records the
+// instances it was asked to start.
+type External struct {
+	mu        sync.Mutex
+	instances map[uint64]Instance
+}
+
+func NewExternal() *External {
+	return &External{instances: make(map[uint64]Instance)}
+}
+
+func (e *External) Kind() string { return KindExternal }
+
+func (e *External) Start(spec Spec) error {
+	log.Printf("Instance %d at %s is expected to be started externally\n", spec.ID, spec.KVAddress)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.instances[spec.ID] = Instance{Spec: spec, State: StateExternal}
+	return nil
+}
+
+// Stop forgets the instance and returns ErrUnmanaged, as it is still running.
+func (e *External) Stop(id uint64) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.instances, id)
+	return fmt.Errorf("instance %d is run externally: %w", id, ErrUnmanaged)
+}
+
+// Retire does nothing: whatever runs the instance decides about restarts.
+func (e *External) Retire(id uint64) {}
+
+func (e *External) Instances() []Instance {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	out := make([]Instance, 0, len(e.instances))
+	for _, inst := range e.instances {
+		out = append(out, inst)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
@@ -0,0 +1,101 @@
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrUnmanaged is returned by Stop for an instance the launcher does not run,
+// which has to be shut down some other way.
+var ErrUnmanaged = errors.New("instance is not managed by this launcher")
+
+// Launchers.
+const (
+	KindLocal    = "local"
+	KindExternal = "external"
+)
+
+// Spec describes a server instance to run.
+type Spec struct {
+	ID          uint64
+	KVAddress   string
+	RaftAddress string // passed to new nodes only
+	Join        bool   // the node joins a running cluster
+}
+
+// State is the state of a managed instance.
+type State int
+
+const (
+	StateStarting State = iota // the process is being started
+	StateRunning               // the process is running
+	StateBackoff               // the process exited and is restarted after a delay
+	StateExited                // the process exited cleanly and is not restarted
+	StateFailed                // the process failed and is not restarted
+	StateStopped               // the process was stopped through the launcher
+	StateExternal              // something outside the load balancer runs the process
+)
+
+func (s State) String() string {
+	switch s {
+	case StateStarting:
+		return "starting"
+	case StateRunning:
+		return "running"
+	case StateBackoff:
+		return "backoff"
+	case StateExited:
+		return "exited"
+	case StateFailed:
+		return "failed"
+	case StateStopped:
+		return "stopped"
+	case StateExternal:
+		return "external"
+	}
+	return "unknown"
+}
+
+// Instance is a point-in-time view of a managed instance.
+type Instance struct {
+	Spec
+	State     State
+	PID       int // 0 while no process runs
+	Restarts  int
+	StartedAt time.Time // when the current or last process started
+	LastExit  string    // how the last process ended, empty if none has
+	LogFile   string
+}
+
+// Launcher starts and supervises server instances.
+type Launcher interface {
+	Kind() string
+	// Start runs an instance and keeps it running. Starting an instance
+	// that is running fails.
+	Start(spec Spec) error
+	// Stop stops an instance for good. It returns ErrUnmanaged for an
+	// instance the launcher does not run.
+	Stop(id uint64) error
+	// Retire marks an instance as being removed from the cluster. A removed
+	// server exits cleanly on its own, and from then on a clean exit is
+	// final whatever the restart policy. Unknown instances are ignored.
+	Retire(id uint64)
+	// Instances lists the managed instances in ID order.
+	Instances() []Instance
+}
+
+// New returns the launcher of the given kind. config is only used by the
+// local launcher.
+func New(kind string, config Config) (Launcher, error) {
+	switch kind {
+	case KindLocal:
+		if err := config.Restart.validate(); err != nil {
+			return nil, err
+		}
+		return NewLocal(config), nil
+	case KindExternal:
+		return NewExternal(), nil
+	}
+	return nil, fmt.Errorf("unknown launcher %q, want %s or %s", kind, KindLocal, KindExternal)
+}
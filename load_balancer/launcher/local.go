@@ -0,0 +1,301 @@
+package launcher
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Restart modes.
+const (
+	RestartAlways    = "always"     // restart whenever the process exits
+	RestartOnFailure = "on-failure" // restart unless the process exited cleanly
+	RestartNever     = "never"
+)
+
+// stopTimeout is how long Stop waits after SIGTERM before it kills the process.
+var stopTimeout = 10 * time.Second
+
+// RestartPolicy decides whether and when an exited instance is restarted.
+type RestartPolicy struct {
+	Mode       string
+	Backoff    time.Duration // wait before the first restart, doubling after each
+	MaxBackoff time.Duration
+	// MaxRestarts is how many restarts in a row are tried before the
+	// instance is given up as failed, 0 for no limit.
+	MaxRestarts int
+	// A process that ran for at least ResetAfter was healthy: the restarts
+	// in a row and the backoff start over. 0 never starts them over.
+	ResetAfter time.Duration
+}
+
+// Config configures the local launcher.
+type Config struct {
+	Binary  string // server binary
+	Dir     string // working directory of the servers, holding their config directory
+	DataDir string // passed to the servers as -data-dir, "" for their default
+	LogDir  string // each instance appends its output to LogDir/server-<id>.log
+	Restart RestartPolicy
+}
+
+var DefaultConfig = Config{
+	Binary: "./server",
+	Dir:    ".",
+	LogDir: "logs",
+	Restart: RestartPolicy{
+		Mode:       RestartOnFailure,
+		Backoff:    time.Second,
+		MaxBackoff: 30 * time.Second,
+		ResetAfter: time.Minute,
+	},
+}
+
+// Local runs instances as child processes of the load balancer. It reaps
+// every process it starts and restarts them under the restart policy.
+type Local struct {
+	config Config
+
+	mu        sync.Mutex
+	instances map[uint64]*process
+}
+
+// process is a managed instance. Its Instance fields are guarded by Local.mu.
+type process struct {
+	Instance
+	cmd      *exec.Cmd
+	stopping bool
+	retiring bool          // set by Retire
+	stop     chan struct{} // closed by Stop
+	done     chan struct{} // closed when supervision ends
+}
+
+func NewLocal(config Config) *Local {
+	return &Local{config: config, instances: make(map[uint64]*process)}
+}
+
+func (l *Local) Kind() string { return KindLocal }
+
+func (p RestartPolicy) validate() error {
+	switch p.Mode {
+	case RestartAlways, RestartOnFailure, RestartNever:
+		return nil
+	}
+	return fmt.Errorf("unknown restart mode %q, want %s, %s or %s", p.Mode, RestartAlways, RestartOnFailure, RestartNever)
+}
+
+func (l *Local) Start(spec Spec) error {
+	if err := os.MkdirAll(l.config.LogDir, 0750); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok := l.instances[spec.ID]; ok && !p.finished() {
+		return fmt.Errorf("instance %d is already %s", spec.ID, p.State)
+	}
+	p := &process{
+		Instance: Instance{
+			Spec:    spec,
+			State:   StateStarting,
+			LogFile: filepath.Join(l.config.LogDir, fmt.Sprintf("server-%d.log", spec.ID)),
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := l.spawn(p); err != nil {
+		return err
+	}
+	l.instances[spec.ID] = p
+	go l.supervise(p)
+	return nil
+}
+
+func (l *Local) Stop(id uint64) error {
+	l.mu.Lock()
+	p, ok := l.instances[id]
+	if !ok {
+		l.mu.Unlock()
+		return fmt.Errorf("instance %d: %w", id, ErrUnmanaged)
+	}
+	pid := p.PID
+	if !p.stopping {
+		p.stopping = true
+		close(p.stop)
+		if pid != 0 {
+			// The server leads its own process group.
+			syscall.Kill(-pid, syscall.SIGTERM)
+		}
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-p.done:
+	case <-time.After(stopTimeout):
+		log.Printf("Instance %d did not stop within %v, killing it\n", id, stopTimeout)
+		// A process spawned since SIGTERM was sent has a different pid, and
+		// one that exited has none; -0 would signal our own process group.
+		l.mu.Lock()
+		if pid := p.PID; pid != 0 {
+			syscall.Kill(-pid, syscall.SIGKILL)
+		}
+		l.mu.Unlock()
+		<-p.done
+	}
+	return nil
+}
+
+func (l *Local) Retire(id uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if p, ok := l.instances[id]; ok {
+		p.retiring = true
+	}
+}
+
+func (l *Local) Instances() []Instance {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]Instance, 0, len(l.instances))
+	for _, p := range l.instances {
+		out = append(out, p.Instance)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+func (p *process) finished() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Local) args(spec Spec) []string {
+	args := []string{"--id", strconv.FormatUint(spec.ID, 10)}
+	if spec.Join {
+		args = append(args, "--join")
+	}
+	if spec.KVAddress != "" {
+		args = append(args, "--kv-addr", spec.KVAddress)
+	}
+	if spec.RaftAddress != "" {
+		args = append(args, "--raft-addr", spec.RaftAddress)
+	}
+	if l.config.DataDir != "" {
+		args = append(args, "--data-dir", l.config.DataDir)
+	}
+	return args
+}
+
+// spawn starts the instance's process with its output appended to the log
+// file. The caller must hold l.mu.
+func (l *Local) spawn(p *process) error {
+	logFile, err := os.OpenFile(p.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close() // the child keeps its own descriptor
+
+	cmd := exec.Command(l.config.Binary, l.args(p.Spec)...)
+	cmd.Dir = l.config.Dir
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	p.cmd = cmd
+	p.PID = cmd.Process.Pid
+	p.State = StateRunning
+	p.StartedAt = time.Now()
+	log.Printf("Started instance %d with PID %d, logging to %s\n", p.ID, p.PID, p.LogFile)
+	return nil
+}
+
+// supervise waits for the instance's process, reaping it, and restarts it
+// under the restart policy until it is stopped or given up.
+func (l *Local) supervise(p *process) {
+	defer close(p.done)
+	policy := l.config.Restart
+	backoff, inRow := policy.Backoff, 0
+	for {
+		err := p.cmd.Wait()
+
+		l.mu.Lock()
+		p.PID, p.LastExit = 0, describeExit(err)
+		log.Printf("Instance %d exited: %s\n", p.ID, p.LastExit)
+		if policy.ResetAfter > 0 && time.Since(p.StartedAt) >= policy.ResetAfter {
+			backoff, inRow = policy.Backoff, 0
+		}
+		for {
+			if state, final := l.afterExit(p, err, inRow); final {
+				p.State = state
+				l.mu.Unlock()
+				return
+			}
+			p.State = StateBackoff
+			l.mu.Unlock()
+
+			select {
+			case <-p.stop:
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, policy.MaxBackoff)
+			inRow++
+
+			l.mu.Lock()
+			if p.stopping {
+				p.State = StateStopped
+				l.mu.Unlock()
+				return
+			}
+			p.Restarts++
+			if err = l.spawn(p); err == nil {
+				break
+			}
+			p.LastExit = "failed to start: " + err.Error()
+			log.Printf("Instance %d %s\n", p.ID, p.LastExit)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// afterExit decides the fate of an instance whose process ended with err
+// after inRow restarts in a row. It returns the instance's final state and
+// true if it is not restarted. The caller must hold l.mu.
+func (l *Local) afterExit(p *process, err error, inRow int) (State, bool) {
+	policy := l.config.Restart
+	switch {
+	case p.stopping:
+		return StateStopped, true
+	case err == nil && (policy.Mode != RestartAlways || p.retiring):
+		return StateExited, true
+	case policy.Mode == RestartNever:
+		return StateFailed, true
+	case policy.MaxRestarts > 0 && inRow >= policy.MaxRestarts:
+		log.Printf("Instance %d failed after %d restarts in a row, giving up\n", p.ID, inRow)
+		return StateFailed, true
+	}
+	return 0, false
+}
+
+func describeExit(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "exit status 0"
+	case errors.As(err, &exitErr):
+		return exitErr.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,195 @@
+package launcher
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeServer writes a shell script that logs its arguments and then runs body.
+func fakeServer(t *testing.T, body string) Config {
+	dir := t.TempDir()
+	binary := filepath.Join(dir, "server")
+	if err := os.WriteFile(binary, []byte("#!/bin/sh\necho \"args: $*\"\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		Binary: binary,
+		Dir:    dir,
+		LogDir: filepath.Join(dir, "logs"),
+		Restart: RestartPolicy{
+			Mode:       RestartOnFailure,
+			Backoff:    10 * time.Millisecond,
+			MaxBackoff: 20 * time.Millisecond,
+		},
+	}
+}
+
+// waitFor polls the instance until it reaches state.
+func waitFor(t *testing.T, l Launcher, id uint64, state State) Instance {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, inst := range l.Instances() {
+			if inst.ID == id && inst.State == state {
+				return inst
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("instance %d never became %s: %+v", id, state, l.Instances())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLocalRestartsFailingInstance(t *testing.T) {
+	config := fakeServer(t, "exit 3")
+	config.Restart.MaxRestarts = 3
+	l := NewLocal(config)
+	if err := l.Start(Spec{ID: 7, KVAddress: "localhost:6006", RaftAddress: "http://127.0.0.1:5006", Join: true}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	inst := waitFor(t, l, 7, StateFailed)
+	if inst.Restarts != 3 || inst.LastExit != "exit status 3" || inst.PID != 0 {
+		t.Fatalf("instance = %+v, want 3 restarts after exit status 3", inst)
+	}
+	out, err := os.ReadFile(inst.LogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "args: --id 7 --join --kv-addr localhost:6006 --raft-addr http://127.0.0.1:5006\n"
+	if string(out) != strings.Repeat(want, 4) {
+		t.Fatalf("log = %q, want 4 runs of %q", out, want)
+	}
+
+	// A given-up instance can be started again.
+	if err := l.Start(Spec{ID: 7}); err != nil {
+		t.Fatalf("Start after failure: %v", err)
+	}
+}
+
+func TestLocalDoesNotRestartCleanExit(t *testing.T) {
+	l := NewLocal(fakeServer(t, "exit 0"))
+	if err := l.Start(Spec{ID: 1}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	if inst := waitFor(t, l, 1, StateExited); inst.Restarts != 0 {
+		t.Fatalf("instance = %+v, want no restarts", inst)
+	}
+}
+
+func TestLocalDoesNotRestartRetiredInstance(t *testing.T) {
+	// The server exits cleanly once it is removed, as a removed member does.
+	config := fakeServer(t, "while [ ! -f removed ]; do sleep 0.01; done")
+	config.Restart.Mode = RestartAlways
+	l := NewLocal(config)
+	if err := l.Start(Spec{ID: 3}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	waitFor(t, l, 3, StateRunning)
+	l.Retire(3)
+	l.Retire(4) // not managed: ignored
+
+	if err := os.WriteFile(filepath.Join(config.Dir, "removed"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if inst := waitFor(t, l, 3, StateExited); inst.Restarts != 0 {
+		t.Fatalf("instance = %+v, want the removed instance left exited", inst)
+	}
+	time.Sleep(5 * config.Restart.MaxBackoff)
+	if inst := l.Instances()[0]; inst.State != StateExited || inst.Restarts != 0 {
+		t.Fatalf("instance = %+v, want it not restarted", inst)
+	}
+}
+
+func TestLocalStopReapsProcess(t *testing.T) {
+	config := fakeServer(t, "exec sleep 60")
+	config.Restart.Mode = RestartAlways
+	l := NewLocal(config)
+	if err := l.Start(Spec{ID: 2}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	inst := waitFor(t, l, 2, StateRunning)
+	if inst.PID == 0 {
+		t.Fatalf("running instance has no PID")
+	}
+	if err := l.Start(Spec{ID: 2}); err == nil {
+		t.Fatalf("started a running instance twice")
+	}
+
+	if err := l.Stop(2); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if got := l.Instances()[0]; got.State != StateStopped || got.PID != 0 {
+		t.Fatalf("instance = %+v, want stopped", got)
+	}
+	// A process that exited but was not reaped would still be signalable.
+	if err := syscall.Kill(inst.PID, 0); err != syscall.ESRCH {
+		t.Fatalf("process %d still exists after Stop: %v", inst.PID, err)
+	}
+}
+
+func TestLocalStopKillsProcessIgnoringSIGTERM(t *testing.T) {
+	defer func(old time.Duration) { stopTimeout = old }(stopTimeout)
+	stopTimeout = 50 * time.Millisecond
+	config := fakeServer(t, "trap '' TERM\necho ready\nwhile :; do sleep 1; done")
+	l := NewLocal(config)
+	if err := l.Start(Spec{ID: 3}); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	inst := waitFor(t, l, 3, StateRunning)
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if out, _ := os.ReadFile(inst.LogFile); strings.Contains(string(out), "ready") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the server never ignored SIGTERM")
+		}
+	}
+
+	if err := l.Stop(3); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+	if err := syscall.Kill(inst.PID, 0); err != syscall.ESRCH {
+		t.Fatalf("process %d still exists after Stop: %v", inst.PID, err)
+	}
+	// Stopping again finds no process to signal.
+	if err := l.Stop(3); err != nil {
+		t.Fatalf("second Stop: %v", err)
+	}
+	if err := l.Stop(4); !errors.Is(err, ErrUnmanaged) {
+		t.Fatalf("Stop of an unknown instance = %v, want ErrUnmanaged", err)
+	}
+}
+
+func TestExternalRecordsInstances(t *testing.T) {
+	l, err := New(KindExternal, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Start(Spec{ID: 3, KVAddress: "localhost:6002"})
+	if got := l.Instances(); len(got) != 1 || got[0].State != StateExternal {
+		t.Fatalf("instances = %+v, want one external instance", got)
+	}
+	if err := l.Stop(3); !errors.Is(err, ErrUnmanaged) {
+		t.Fatalf("Stop = %v, want ErrUnmanaged as nothing was stopped", err)
+	}
+	if got := l.Instances(); len(got) != 0 {
+		t.Fatalf("instances = %+v after Stop, want none", got)
+	}
+}
+
+func TestNewRejectsUnknownSettings(t *testing.T) {
+	if _, err := New("docker", DefaultConfig); err == nil {
+		t.Fatalf("unknown launcher accepted")
+	}
+	config := DefaultConfig
+	config.Restart.Mode = "sometimes"
+	if _, err := New(KindLocal, config); err == nil {
+		t.Fatalf("unknown restart mode accepted")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"google.golang.org/grpc"
 	"load_balancer/consts"
+	"load_balancer/launcher"
 	"load_balancer/models"
 	pb "load_balancer/proto/kv739"
 	"load_balancer/utils"
@@ -17,16 +18,61 @@ import (
 )
 
 var (
-	port     int
-	serverIp string
+	port               int
+	serverIp           string
+	leaderPollInterval time.Duration
+	membersRetry       time.Duration
+	strategy           string
+	weights            string
+	adminPort          int
+	adminHTTPPort      int
+	breakerConfig      = models.DefaultBreakerConfig
+	launcherKind       string
+	launcherConfig     = launcher.DefaultConfig
+	replicationFactor  int
+	leaseDuration      time.Duration
+	catchUpTimeout     time.Duration
 
-	serverPool *models.ServerPool
+	serverPool       *models.ServerPool
+	instanceLauncher launcher.Launcher
+	clusterEvents    = models.NewEventLog(256)
+	self             models.LeaseHolder // this load balancer, as the lease names it
+	lease            *models.Lease
+	peers            *models.Peers // the other load balancers
 )
 
 func main() {
 	// Parse command-line arguments
 	flag.IntVar(&port, "port", 8080, "Server port")
 	flag.StringVar(&serverIp, "ip", "localhost", "Server IP")
+	flag.StringVar(&strategy, "strategy", models.StrategyRoundRobin, "Read balancing strategy: round-robin, least-outstanding, p2c-ewma, weighted or consistent-hash")
+	flag.StringVar(&weights, "weights", "", "Backend weights for the weighted strategy, as id=weight pairs separated by commas; unlisted backends get 1")
+	flag.IntVar(&adminPort, "admin-port", 0, "Admin server port, 0 for the server port plus 1000")
+	flag.IntVar(&adminHTTPPort, "admin-http-port", 0, "Port of the admin service as JSON over HTTP, 0 for the server port plus 2000")
+	flag.IntVar(&getPolicy.MaxAttempts, "get-attempts", 3, "Attempts per read, each on a different backend when possible")
+	flag.DurationVar(&getPolicy.Backoff, "retry-backoff", 10*time.Millisecond, "Wait before retrying a failed read, doubling after each retry")
+	flag.DurationVar(&getPolicy.MaxBackoff, "max-retry-backoff", 200*time.Millisecond, "Longest wait between read retries")
+	flag.Float64Var(&getPolicy.HedgeQuantile, "hedge-quantile", 0.95, "Send a second read once the first is slower than this quantile of recent reads, 0 to disable")
+	flag.Float64Var(&breakerConfig.FailureRate, "breaker-failure-rate", breakerConfig.FailureRate, "Open a backend's circuit breaker when this share of its requests fail")
+	flag.IntVar(&breakerConfig.MinRequests, "breaker-min-requests", breakerConfig.MinRequests, "Requests in a window before the failure rate can open a circuit breaker")
+	flag.IntVar(&breakerConfig.ConsecutiveFailures, "breaker-consecutive-failures", breakerConfig.ConsecutiveFailures, "Open a circuit breaker after this many failures in a row")
+	flag.DurationVar(&breakerConfig.Window, "breaker-window", breakerConfig.Window, "How long request outcomes count towards the failure rate")
+	flag.DurationVar(&breakerConfig.OpenTimeout, "breaker-open-timeout", breakerConfig.OpenTimeout, "How long an open circuit breaker waits before probing the backend")
+	flag.DurationVar(&leaderPollInterval, "leader-poll-interval", 2*time.Second, "How often to ask the backends who the raft leader is")
+	flag.DurationVar(&membersRetry, "members-retry", time.Second, "Wait before resubscribing to the member registry after its stream breaks")
+	flag.StringVar(&launcherKind, "launcher", launcher.KindLocal, "How server instances are run: local, as child processes, or external, by something else")
+	flag.StringVar(&launcherConfig.Binary, "server-binary", launcherConfig.Binary, "Server binary the local launcher runs")
+	flag.StringVar(&launcherConfig.Dir, "server-dir", launcherConfig.Dir, "Working directory of launched servers, holding their config directory")
+	flag.StringVar(&launcherConfig.DataDir, "server-data-dir", launcherConfig.DataDir, "Data directory of launched servers, empty for their default")
+	flag.StringVar(&launcherConfig.LogDir, "server-log-dir", launcherConfig.LogDir, "Directory for the launched servers' log files, one per instance")
+	flag.StringVar(&launcherConfig.Restart.Mode, "restart", launcherConfig.Restart.Mode, "When to restart launched servers that exit: always, on-failure or never")
+	flag.DurationVar(&launcherConfig.Restart.Backoff, "restart-backoff", launcherConfig.Restart.Backoff, "Wait before restarting a server, doubling after each restart in a row")
+	flag.DurationVar(&launcherConfig.Restart.MaxBackoff, "max-restart-backoff", launcherConfig.Restart.MaxBackoff, "Longest wait before restarting a server")
+	flag.IntVar(&launcherConfig.Restart.MaxRestarts, "max-restarts", launcherConfig.Restart.MaxRestarts, "Restarts in a row before a server is given up, 0 for no limit")
+	flag.DurationVar(&launcherConfig.Restart.ResetAfter, "restart-reset-after", launcherConfig.Restart.ResetAfter, "Run time after which a server's restarts in a row and backoff start over")
+	flag.IntVar(&replicationFactor, "replication-factor", 0, "Members to keep; a force-removed member is replaced while the cluster has fewer, 0 to never replace")
+	flag.DurationVar(&catchUpTimeout, "catch-up-timeout", 2*time.Minute, "How long a replacement may take to start and catch up before it is given up")
+	flag.DurationVar(&leaseDuration, "lease-duration", 6*time.Second, "How long the membership lease lasts without renewal before another load balancer takes it")
 	flag.Parse()
 
 	var IDs []uint64
@@ -35,12 +81,57 @@ func main() {
 		log.Fatalf("Failed to read config file: %v", err)
 	}
 
+	if getPolicy.HedgeQuantile < 0 || getPolicy.HedgeQuantile >= 1 {
+		log.Fatalf("-hedge-quantile must be at least 0 and below 1")
+	}
+	getLatencies = models.NewLatencyTracker(getPolicy.HedgeQuantile)
+
+	var err error
+	if instanceLauncher, err = launcher.New(launcherKind, launcherConfig); err != nil {
+		log.Fatal(err)
+	}
+
+	balancer, err := models.NewStrategy(strategy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	backendWeights, err := utils.ParseWeights(weights)
+	if err != nil {
+		log.Fatalf("Invalid -weights: %v", err)
+	}
+
 	serverPool = models.NewServerPool(IDs, servers)
+	serverPool.SetStrategy(balancer)
+	serverPool.SetWeights(backendWeights)
+	serverPool.SetBreakerConfig(breakerConfig)
+	serverPool.SetEventLog(clusterEvents)
 	serverPool.Connect()
 	defer serverPool.Close()
 
 	forceLeaveC := make(chan string)
 	go serverPool.HealthCheck(5*time.Second, forceLeaveC)
+	go serverPool.TrackLeader(leaderPollInterval)
+	go serverPool.WatchMembers(membersRetry)
+
+	if adminPort == 0 {
+		adminPort = port + 1000
+	}
+	if adminHTTPPort == 0 {
+		adminHTTPPort = port + 2000
+	}
+	self = models.LeaseHolder{
+		Address: serverIp + ":" + strconv.Itoa(port),
+		Admin:   serverIp + ":" + strconv.Itoa(adminPort),
+	}
+	lease = models.NewLease(clusterStore{}, consts.LeaseKey, self, leaseDuration)
+	go lease.Run()
+	peers = models.NewPeers(clusterStore{}, consts.PeersKey, self, leaseDuration)
+	go peers.Run()
+	go syncDraining(consts.DrainSyncInterval)
+
+	admin := &adminServer{}
+	go startAdminServer(serverIp+":"+strconv.Itoa(adminPort), admin)
+	go startAdminHTTPServer(serverIp+":"+strconv.Itoa(adminHTTPPort), admin)
 
 	lis, err := net.Listen("tcp", serverIp+":"+strconv.Itoa(port))
 	if err != nil {
@@ -53,21 +144,25 @@ func main() {
 	}
 	pb.RegisterKVStoreServiceServer(grpcServer, newServer)
 
-	go func() {
-		for serverName := range forceLeaveC {
-			log.Printf("Force leaving the server pool for server: %s...\n", serverName)
-			resp, err := newServer.Leave(context.TODO(), &pb.LeaveRequest{
-				ServerName: serverName,
-				Clean:      1,
-			})
-
-			if err != nil || resp.Status != consts.Success {
-				log.Printf("Failed to leave the server pool: %v\n", err)
-			} else {
-				log.Printf("Force leave response: %v\n", resp)
-			}
+	go forceLeaves(forceLeaveC, func(serverName string) {
+		if !lease.Leading() {
+			// The lease holder's own health checks find the server too.
+			return
+		}
+		log.Printf("Force leaving the server pool for server: %s...\n", serverName)
+		id, _ := serverPool.ID(serverName)
+		resp, err := newServer.Leave(context.TODO(), &pb.LeaveRequest{
+			ServerName: serverName,
+			Clean:      1,
+		})
+
+		if err != nil || resp.Status != consts.Success {
+			log.Printf("Failed to leave the server pool: %v\n", err)
+		} else {
+			log.Printf("Force leave response: %v\n", resp)
+			go replaceMember(id, serverName)
 		}
-	}()
+	})
 
 	fmt.Printf("Load balancer started on :%d\n", port)
 	if err := grpcServer.Serve(lis); err != nil {
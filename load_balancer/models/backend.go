@@ -0,0 +1,136 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// ewmaDecay is how much of the previous average a new latency sample keeps.
+const ewmaDecay = 0.9
+
+// Backend holds the request statistics and circuit breaker of one server,
+// which the balancing strategies choose between.
+type Backend struct {
+	ID      uint64
+	Address string
+	Weight  int
+	Breaker *Breaker
+
+	inFlight     atomic.Int64
+	requests     atomic.Uint64
+	failures     atomic.Uint64
+	failedChecks atomic.Int32 // health checks failed in a row
+	draining     atomic.Bool  // takes no new requests, while it is decommissioned
+
+	mu      sync.Mutex
+	ewma    float64 // latency in nanoseconds, 0 until the first sample
+	current int     // smooth weighted round-robin state, guarded by the strategy
+}
+
+func NewBackend(id uint64, address string, weight int, breaker BreakerConfig) *Backend {
+	return &Backend{
+		ID:      id,
+		Address: address,
+		Weight:  max(weight, 1),
+		Breaker: NewBreaker(fmt.Sprintf("backend %d at %s", id, address), breaker),
+	}
+}
+
+// InFlight returns the number of requests currently outstanding.
+func (b *Backend) InFlight() int64 {
+	return b.inFlight.Load()
+}
+
+// Latency returns the moving average of request latency.
+func (b *Backend) Latency() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration(b.ewma)
+}
+
+// Healthy reports whether the backend passed its last health check.
+func (b *Backend) Healthy() bool {
+	return b.failedChecks.Load() == 0
+}
+
+// Draining reports whether the backend is kept from new requests.
+func (b *Backend) Draining() bool {
+	return b.draining.Load()
+}
+
+func (b *Backend) markHealthy() {
+	b.failedChecks.Store(0)
+}
+
+// markUnhealthy records a failed health check and returns how many have
+// failed in a row.
+func (b *Backend) markUnhealthy() int32 {
+	return b.failedChecks.Add(1)
+}
+
+// Requests returns the number of completed requests and how many of them failed.
+func (b *Backend) Requests() (requests, failures uint64) {
+	return b.requests.Load(), b.failures.Load()
+}
+
+func (b *Backend) begin() time.Time {
+	b.Breaker.start()
+	b.inFlight.Add(1)
+	return time.Now()
+}
+
+func (b *Backend) done(start time.Time, err error) {
+	b.Breaker.finish(err)
+	b.inFlight.Add(-1)
+	b.requests.Add(1)
+	if err != nil {
+		b.failures.Add(1)
+	}
+	sample := float64(time.Since(start))
+	b.mu.Lock()
+	if b.ewma == 0 {
+		b.ewma = sample
+	} else {
+		b.ewma = ewmaDecay*b.ewma + (1-ewmaDecay)*sample
+	}
+	b.mu.Unlock()
+}
+
+// score is the expected wait for a new request: the latency average scaled
+// by the requests queued ahead of it. Backends without samples score 0 so
+// they get tried.
+func (b *Backend) score() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.ewma == 0 {
+		return 0
+	}
+	return b.ewma * float64(b.inFlight.Load()+1)
+}
+
+// interceptor records the in-flight count and latency of key-value requests
+// sent to the backend. Control calls such as health checks are not counted.
+func (b *Backend) interceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if !isKVMethod(method) {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	start := b.begin()
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	b.done(start, err)
+	return err
+}
+
+func isKVMethod(method string) bool {
+	i := strings.LastIndexByte(method, '/')
+	switch method[i+1:] {
+	case "Get", "Put", "Delete":
+		return true
+	}
+	return false
+}
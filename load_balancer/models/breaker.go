@@ -0,0 +1,193 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// BreakerState is the state of a circuit breaker.
+type BreakerState int
+
+const (
+	BreakerClosed   BreakerState = iota // requests flow normally
+	BreakerOpen                         // requests are kept away from the backend
+	BreakerHalfOpen                     // a few probe requests test whether the backend recovered
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// BreakerConfig configures the circuit breakers of a pool.
+type BreakerConfig struct {
+	// Window is how long request outcomes are counted before the counts reset.
+	Window time.Duration
+	// The breaker opens when at least MinRequests requests in the window
+	// failed at FailureRate or more, or after ConsecutiveFailures failures
+	// in a row.
+	MinRequests         int
+	FailureRate         float64
+	ConsecutiveFailures int
+	// OpenTimeout is how long the breaker stays open before it lets probes through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is how many probe requests may be outstanding at once.
+	HalfOpenProbes int
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	Window:              10 * time.Second,
+	MinRequests:         10,
+	FailureRate:         0.5,
+	ConsecutiveFailures: 5,
+	OpenTimeout:         5 * time.Second,
+	HalfOpenProbes:      1,
+}
+
+// Breaker is a circuit breaker driven by the outcomes of real requests. A
+// closed breaker opens when the backend fails too often; after OpenTimeout
+// it turns half-open and lets probes through, closing again on the first
+// success or reopening on the first failure.
+type Breaker struct {
+	name   string
+	config BreakerConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	state       BreakerState
+	windowStart time.Time
+	requests    int
+	failures    int
+	consecutive int
+	openedAt    time.Time
+	probes      int
+}
+
+func NewBreaker(name string, config BreakerConfig) *Breaker {
+	return &Breaker{name: name, config: config, now: time.Now}
+}
+
+// State returns the breaker's state, and the failure rate in the current window.
+func (b *Breaker) State() (BreakerState, float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	var rate float64
+	if b.requests > 0 {
+		rate = float64(b.failures) / float64(b.requests)
+	}
+	return b.state, rate
+}
+
+// Ready reports whether a request may be sent now: the breaker is closed,
+// or half-open with a probe slot free.
+func (b *Breaker) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	switch b.state {
+	case BreakerClosed:
+		return true
+	case BreakerHalfOpen:
+		return b.probes < b.config.HalfOpenProbes
+	}
+	return false
+}
+
+// start notes that a request was sent.
+func (b *Breaker) start() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	if b.state == BreakerHalfOpen {
+		b.probes++
+	}
+}
+
+// finish records the outcome of a request sent after start.
+func (b *Breaker) finish(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advance()
+	failed := isBackendFailure(err)
+	if err != nil && !failed {
+		// Abandoned or rejected requests say nothing about the backend.
+		if b.state == BreakerHalfOpen && b.probes > 0 {
+			b.probes--
+		}
+		return
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if failed {
+			b.open("probe failed: %v", err)
+		} else {
+			b.close()
+		}
+	case BreakerClosed:
+		b.requests++
+		if !failed {
+			b.consecutive = 0
+			return
+		}
+		b.failures++
+		b.consecutive++
+		if b.consecutive >= b.config.ConsecutiveFailures {
+			b.open("%d failures in a row, last: %v", b.consecutive, err)
+		} else if b.requests >= b.config.MinRequests && float64(b.failures) >= b.config.FailureRate*float64(b.requests) {
+			b.open("%d of %d requests failed, last: %v", b.failures, b.requests, err)
+		}
+	}
+}
+
+// advance resets the window when it has passed and moves an open breaker
+// to half-open once OpenTimeout has passed. The caller must hold b.mu.
+func (b *Breaker) advance() {
+	now := b.now()
+	if now.Sub(b.windowStart) >= b.config.Window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		b.state, b.probes = BreakerHalfOpen, 0
+		log.Printf("Circuit breaker for %s is half-open\n", b.name)
+	}
+}
+
+func (b *Breaker) open(format string, args ...interface{}) {
+	b.state, b.openedAt = BreakerOpen, b.now()
+	b.consecutive, b.probes = 0, 0
+	log.Printf("Circuit breaker for %s opened: "+format+"\n", append([]interface{}{b.name}, args...)...)
+}
+
+func (b *Breaker) close() {
+	b.state = BreakerClosed
+	b.windowStart, b.requests, b.failures, b.consecutive, b.probes = b.now(), 0, 0, 0, 0
+	log.Printf("Circuit breaker for %s closed\n", b.name)
+}
+
+// isBackendFailure reports whether err means the backend is unreachable or
+// misbehaving, rather than that the caller gave up or sent a bad request.
+func isBackendFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Unknown, codes.Internal, codes.ResourceExhausted, codes.Aborted, codes.DataLoss:
+		return true
+	}
+	return false
+}
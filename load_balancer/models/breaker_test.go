@@ -0,0 +1,98 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errUnavailable = status.Error(codes.Unavailable, "connection refused")
+
+func newTestBreaker() (*Breaker, *time.Time) {
+	now := time.Unix(1000, 0)
+	b := NewBreaker("test", BreakerConfig{
+		Window:              10 * time.Second,
+		MinRequests:         4,
+		FailureRate:         0.5,
+		ConsecutiveFailures: 3,
+		OpenTimeout:         5 * time.Second,
+		HalfOpenProbes:      1,
+	})
+	b.now = func() time.Time { return now }
+	return b, &now
+}
+
+func record(b *Breaker, errs ...error) {
+	for _, err := range errs {
+		b.start()
+		b.finish(err)
+	}
+}
+
+func TestBreakerOpensOnFailureRate(t *testing.T) {
+	b, _ := newTestBreaker()
+	record(b, nil, errUnavailable, nil, errUnavailable)
+	if state, rate := b.State(); state != BreakerOpen || rate != 0.5 {
+		t.Fatalf("state = %v, rate = %v; want open at 0.5", state, rate)
+	}
+	if b.Ready() {
+		t.Fatalf("open breaker let a request through")
+	}
+}
+
+func TestBreakerOpensOnConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker()
+	record(b, errUnavailable, errUnavailable)
+	if state, _ := b.State(); state != BreakerClosed {
+		t.Fatalf("state = %v after 2 failures, want closed", state)
+	}
+	record(b, errUnavailable)
+	if state, _ := b.State(); state != BreakerOpen {
+		t.Fatalf("state = %v after 3 failures in a row, want open", state)
+	}
+}
+
+func TestBreakerIgnoresCallerErrors(t *testing.T) {
+	b, _ := newTestBreaker()
+	record(b, context.Canceled, status.Error(codes.Canceled, "hedge lost"), status.Error(codes.InvalidArgument, "bad"), context.Canceled)
+	if state, _ := b.State(); state != BreakerClosed {
+		t.Fatalf("state = %v, want closed", state)
+	}
+}
+
+func TestBreakerHalfOpenProbes(t *testing.T) {
+	b, now := newTestBreaker()
+	record(b, errUnavailable, errUnavailable, errUnavailable)
+
+	*now = now.Add(5 * time.Second)
+	if state, _ := b.State(); state != BreakerHalfOpen || !b.Ready() {
+		t.Fatalf("state = %v, want half-open and ready", state)
+	}
+	b.start()
+	if b.Ready() {
+		t.Fatalf("half-open breaker allowed a second probe")
+	}
+	b.finish(errUnavailable)
+	if state, _ := b.State(); state != BreakerOpen {
+		t.Fatalf("state = %v after a failed probe, want open", state)
+	}
+
+	*now = now.Add(5 * time.Second)
+	record(b, nil)
+	if state, _ := b.State(); state != BreakerClosed || !b.Ready() {
+		t.Fatalf("state = %v after a successful probe, want closed", state)
+	}
+}
+
+func TestBreakerWindowResets(t *testing.T) {
+	b, now := newTestBreaker()
+	record(b, nil, errUnavailable, nil)
+	*now = now.Add(10 * time.Second)
+	record(b, errUnavailable, nil, nil, nil)
+	if state, rate := b.State(); state != BreakerClosed || rate != 0.25 {
+		t.Fatalf("state = %v, rate = %v; want closed at 0.25", state, rate)
+	}
+}
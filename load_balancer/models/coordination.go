@@ -0,0 +1,336 @@
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CoordinationStore is the part of the key-value service that load
+// balancers coordinate through.
+type CoordinationStore interface {
+	Get(ctx context.Context, key string) (value string, found bool, err error)
+	// CompareAndSwap sets key to value if it holds expected, or if it is
+	// missing and expectMissing is set. It returns the value afterwards.
+	CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (swapped bool, current string, found bool, err error)
+}
+
+// AllocateID takes the next node ID from the counter at key, which holds
+// the lowest ID not yet handed out. IDs below floor are skipped, for
+// clusters whose members predate the counter. Concurrent callers, on any
+// load balancer, never get the same ID.
+func AllocateID(ctx context.Context, store CoordinationStore, key string, floor uint64) (uint64, error) {
+	expected, found := "", false
+	for {
+		next := floor
+		if found {
+			current, err := strconv.ParseUint(expected, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid ID counter %q: %w", expected, err)
+			}
+			next = max(next, current)
+		}
+		swapped, current, nowFound, err := store.CompareAndSwap(ctx, key, expected, !found, strconv.FormatUint(next+1, 10))
+		if err != nil {
+			return 0, err
+		}
+		if swapped {
+			return next, nil
+		}
+		expected, found = current, nowFound
+	}
+}
+
+// LeaseHolder identifies a load balancer.
+type LeaseHolder struct {
+	Address string `json:"address"` // where it serves the key-value service
+	Admin   string `json:"admin"`   // where it serves the admin service
+}
+
+// leaseRecord is the value of the lease key. The holder bumps Seq to renew.
+type leaseRecord struct {
+	LeaseHolder
+	Seq uint64 `json:"seq"`
+}
+
+// Lease elects one load balancer through a key of the KV cluster. The holder
+// renews the lease by changing the key's value; the others take it over once
+// the value has not changed for the lease duration. Both sides measure time
+// on their own clock, so clocks need not agree.
+type Lease struct {
+	store    CoordinationStore
+	key      string
+	self     LeaseHolder
+	duration time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	observed  string // the key's value when last read, "" if missing
+	found     bool
+	changedAt time.Time // when observed was first seen
+	renewedAt time.Time // when this load balancer last wrote the key, while it held the lease
+	holder    leaseRecord
+}
+
+func NewLease(store CoordinationStore, key string, self LeaseHolder, duration time.Duration) *Lease {
+	return &Lease{store: store, key: key, self: self, duration: duration, now: time.Now}
+}
+
+// Run keeps trying to take or renew the lease, three times per duration.
+func (l *Lease) Run() {
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), l.duration/3)
+		if err := l.tick(ctx); err != nil {
+			log.Printf("Lease %s: %v\n", l.key, err)
+		}
+		cancel()
+		<-ticker.C
+	}
+}
+
+// tick renews the lease if this load balancer holds it, and takes it over if
+// its holder has not renewed it for the lease duration.
+func (l *Lease) tick(ctx context.Context) error {
+	l.mu.Lock()
+	holding := l.found && l.holder.LeaseHolder == l.self
+	l.mu.Unlock()
+
+	if !holding {
+		value, found, err := l.store.Get(ctx, l.key)
+		if err != nil {
+			return err
+		}
+		l.observe(value, found)
+	}
+	l.mu.Lock()
+	observed, found, changedAt := l.observed, l.found, l.changedAt
+	holding = found && l.holder.LeaseHolder == l.self
+	l.mu.Unlock()
+	if found && !holding && l.now().Sub(changedAt) < l.duration {
+		// The holder renewed it recently enough.
+		return nil
+	}
+
+	record := leaseRecord{LeaseHolder: l.self}
+	if found {
+		// A value that does not parse is replaced like any other.
+		var current leaseRecord
+		json.Unmarshal([]byte(observed), &current)
+		record.Seq = current.Seq + 1
+	}
+	value, _ := json.Marshal(record)
+	start := l.now()
+	swapped, current, nowFound, err := l.store.CompareAndSwap(ctx, l.key, observed, !found, string(value))
+	if err != nil {
+		return err
+	}
+	l.observe(current, nowFound)
+	if swapped {
+		l.mu.Lock()
+		if !holding {
+			log.Printf("Took lease %q as %s\n", l.key, l.self.Address)
+		}
+		l.renewedAt = start
+		l.mu.Unlock()
+	}
+	return nil
+}
+
+// observe records the key's value as just read.
+func (l *Lease) observe(value string, found bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if value == l.observed && found == l.found && !l.changedAt.IsZero() {
+		return
+	}
+	l.observed, l.found, l.changedAt = value, found, l.now()
+	l.holder = leaseRecord{}
+	if found && json.Unmarshal([]byte(value), &l.holder) != nil {
+		l.holder = leaseRecord{}
+	}
+}
+
+// Leading reports whether this load balancer holds the lease. It stops
+// before the others may take the lease over: a renewal one tick short of
+// the duration ago is too old.
+func (l *Lease) Leading() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.found && l.holder.LeaseHolder == l.self && l.now().Sub(l.renewedAt) < l.duration-l.duration/3
+}
+
+// Holder returns the load balancer that last held the lease, as far as this
+// one knows, or ok false if none has.
+func (l *Lease) Holder() (holder LeaseHolder, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.holder.LeaseHolder, l.found && l.holder.Address != ""
+}
+
+// UpdateSet adds member to the set of strings kept at key as a JSON list, or
+// removes it, and returns the set afterwards. Concurrent updates, on any load
+// balancer, are not lost.
+func UpdateSet(ctx context.Context, store CoordinationStore, key, member string, add bool) ([]string, error) {
+	value, found, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		set, err := parseSet(value, found)
+		if err != nil {
+			return nil, fmt.Errorf("invalid set %s: %w", key, err)
+		}
+		set = slices.DeleteFunc(set, func(v string) bool { return v == member })
+		if add {
+			set = append(set, member)
+			slices.Sort(set)
+		}
+		next, _ := json.Marshal(set)
+		swapped, current, nowFound, err := store.CompareAndSwap(ctx, key, value, !found, string(next))
+		if err != nil {
+			return nil, err
+		}
+		if swapped {
+			return set, nil
+		}
+		value, found = current, nowFound
+	}
+}
+
+// ReadSet returns the set kept at key by UpdateSet.
+func ReadSet(ctx context.Context, store CoordinationStore, key string) ([]string, error) {
+	value, found, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	set, err := parseSet(value, found)
+	if err != nil {
+		return nil, fmt.Errorf("invalid set %s: %w", key, err)
+	}
+	return set, nil
+}
+
+func parseSet(value string, found bool) ([]string, error) {
+	var set []string
+	if !found {
+		return set, nil
+	}
+	err := json.Unmarshal([]byte(value), &set)
+	return set, err
+}
+
+// Peers keeps a registry of the load balancers sharing a cluster in a key of
+// the KV cluster. Each one bumps its own entry three times per duration; one
+// whose entry has not changed for the duration, as this load balancer's clock
+// measures it, is gone. Entries gone for peerForgetAfter durations are dropped.
+type Peers struct {
+	store    CoordinationStore
+	key      string
+	self     LeaseHolder
+	duration time.Duration
+	now      func() time.Time
+
+	mu   sync.Mutex
+	seen map[string]peerEntry // by address
+}
+
+// peerForgetAfter is how many durations a gone load balancer stays listed.
+const peerForgetAfter = 10
+
+type peerEntry struct {
+	record    leaseRecord
+	changedAt time.Time // when record was first seen
+}
+
+func NewPeers(store CoordinationStore, key string, self LeaseHolder, duration time.Duration) *Peers {
+	return &Peers{store: store, key: key, self: self, duration: duration, now: time.Now, seen: make(map[string]peerEntry)}
+}
+
+// Run keeps this load balancer's entry fresh, three times per duration.
+func (p *Peers) Run() {
+	ticker := time.NewTicker(p.duration / 3)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), p.duration/3)
+		if err := p.Sync(ctx); err != nil {
+			log.Printf("Peers %s: %v\n", p.key, err)
+		}
+		cancel()
+		<-ticker.C
+	}
+}
+
+// Sync reads the registry and bumps this load balancer's entry.
+func (p *Peers) Sync(ctx context.Context) error {
+	value, found, err := p.store.Get(ctx, p.key)
+	if err != nil {
+		return err
+	}
+	for {
+		// A value that does not parse is replaced like any other.
+		records := make(map[string]leaseRecord)
+		if found {
+			json.Unmarshal([]byte(value), &records)
+		}
+		p.observe(records)
+
+		next := make(map[string]leaseRecord, len(records)+1)
+		p.mu.Lock()
+		for address, record := range records {
+			if p.now().Sub(p.seen[address].changedAt) < peerForgetAfter*p.duration {
+				next[address] = record
+			}
+		}
+		p.mu.Unlock()
+		next[p.self.Address] = leaseRecord{LeaseHolder: p.self, Seq: records[p.self.Address].Seq + 1}
+		data, _ := json.Marshal(next)
+		swapped, current, nowFound, err := p.store.CompareAndSwap(ctx, p.key, value, !found, string(data))
+		if err != nil {
+			return err
+		}
+		if swapped {
+			p.observe(next)
+			return nil
+		}
+		value, found = current, nowFound
+	}
+}
+
+// observe records the registry as just read.
+func (p *Peers) observe(records map[string]leaseRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for address, record := range records {
+		if old, ok := p.seen[address]; !ok || old.record != record {
+			p.seen[address] = peerEntry{record: record, changedAt: p.now()}
+		}
+	}
+	for address := range p.seen {
+		if _, ok := records[address]; !ok {
+			delete(p.seen, address)
+		}
+	}
+}
+
+// Live returns the other load balancers whose entries changed within the
+// duration, in address order.
+func (p *Peers) Live() []LeaseHolder {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var live []LeaseHolder
+	for address, entry := range p.seen {
+		if address != p.self.Address && p.now().Sub(entry.changedAt) < p.duration {
+			live = append(live, entry.record.LeaseHolder)
+		}
+	}
+	slices.SortFunc(live, func(a, b LeaseHolder) int { return strings.Compare(a.Address, b.Address) })
+	return live
+}
@@ -0,0 +1,194 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memStore is a CoordinationStore in memory.
+type memStore struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string]string)}
+}
+
+func (s *memStore) Get(ctx context.Context, key string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, found := s.data[key]
+	return value, found, nil
+}
+
+func (s *memStore) CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (bool, string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found := s.data[key]
+	if (found && current == expected) || (!found && expectMissing) {
+		s.data[key] = value
+		return true, value, true, nil
+	}
+	return false, current, found, nil
+}
+
+func TestAllocateIDIsUnique(t *testing.T) {
+	store := newMemStore()
+	var mu sync.Mutex
+	seen := make(map[uint64]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				id, err := AllocateID(context.Background(), store, "next-id", 4)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[id] || id < 4 {
+					t.Errorf("ID %d handed out twice or below the floor", id)
+				}
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if store.data["next-id"] != "164" {
+		t.Fatalf("counter = %s, want 164", store.data["next-id"])
+	}
+
+	// A higher floor moves the counter past it.
+	if id, _ := AllocateID(context.Background(), store, "next-id", 200); id != 200 {
+		t.Fatalf("ID = %d, want 200", id)
+	}
+}
+
+func TestLeaseTakeover(t *testing.T) {
+	store := newMemStore()
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+	a := NewLease(store, "leader", LeaseHolder{Address: "a"}, 3*time.Second)
+	b := NewLease(store, "leader", LeaseHolder{Address: "b"}, 3*time.Second)
+	a.now, b.now = clock, clock
+	ctx := context.Background()
+
+	a.tick(ctx)
+	b.tick(ctx)
+	if !a.Leading() || b.Leading() {
+		t.Fatalf("a leading %v, b leading %v; want only a", a.Leading(), b.Leading())
+	}
+	if holder, ok := b.Holder(); !ok || holder.Address != "a" {
+		t.Fatalf("b sees holder %+v, %v; want a", holder, ok)
+	}
+
+	// While a renews, b waits.
+	for i := 0; i < 5; i++ {
+		now = now.Add(time.Second)
+		a.tick(ctx)
+		b.tick(ctx)
+	}
+	if !a.Leading() || b.Leading() {
+		t.Fatalf("b took a lease that was being renewed")
+	}
+
+	// a stops renewing: it steps down before b takes over.
+	now = now.Add(2 * time.Second)
+	if a.Leading() {
+		t.Fatalf("a still leading 2s after its last renewal")
+	}
+	b.tick(ctx)
+	if b.Leading() {
+		t.Fatalf("b took the lease before it expired")
+	}
+	now = now.Add(time.Second)
+	b.tick(ctx)
+	if !b.Leading() {
+		t.Fatalf("b did not take the expired lease")
+	}
+
+	// a comes back and learns it lost the lease.
+	a.tick(ctx)
+	if a.Leading() {
+		t.Fatalf("a leading after b took over")
+	}
+	if holder, _ := a.Holder(); holder.Address != "b" {
+		t.Fatalf("a sees holder %+v, want b", holder)
+	}
+}
+
+func TestUpdateSet(t *testing.T) {
+	store := newMemStore()
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, member := range []string{"c", "a", "b", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := UpdateSet(ctx, store, "drained", member, true); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	set, err := UpdateSet(ctx, store, "drained", "b", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "c", "d"}; !slices.Equal(set, want) {
+		t.Fatalf("set = %v, want %v", set, want)
+	}
+	if read, err := ReadSet(ctx, store, "drained"); err != nil || !slices.Equal(read, set) {
+		t.Fatalf("ReadSet = %v, %v; want %v", read, err, set)
+	}
+	if read, err := ReadSet(ctx, store, "missing"); err != nil || len(read) != 0 {
+		t.Fatalf("ReadSet of a missing key = %v, %v; want empty", read, err)
+	}
+}
+
+func TestPeersExpire(t *testing.T) {
+	store := newMemStore()
+	now := time.Unix(1000, 0)
+	clock := func() time.Time { return now }
+	a := NewPeers(store, "peers", LeaseHolder{Address: "a", Admin: "a-admin"}, 3*time.Second)
+	b := NewPeers(store, "peers", LeaseHolder{Address: "b", Admin: "b-admin"}, 3*time.Second)
+	a.now, b.now = clock, clock
+	ctx := context.Background()
+
+	for _, p := range []*Peers{a, b, a} {
+		if err := p.Sync(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if live := a.Live(); len(live) != 1 || live[0].Admin != "b-admin" {
+		t.Fatalf("a sees %v, want b", live)
+	}
+	if live := b.Live(); len(live) != 1 || live[0].Address != "a" {
+		t.Fatalf("b sees %v, want a", live)
+	}
+
+	// b stops syncing: a sees its entry unchanged for the duration.
+	for i := 0; i < 3; i++ {
+		now = now.Add(time.Second)
+		a.Sync(ctx)
+	}
+	if live := a.Live(); len(live) != 0 {
+		t.Fatalf("a sees %v after b stopped, want nobody", live)
+	}
+	if !strings.Contains(store.data["peers"], `"b"`) {
+		t.Fatal("b was dropped from the registry before it was forgotten")
+	}
+	now = now.Add(peerForgetAfter * 3 * time.Second)
+	a.Sync(ctx)
+	if strings.Contains(store.data["peers"], `"b"`) {
+		t.Fatalf("registry = %s, want b forgotten", store.data["peers"])
+	}
+}
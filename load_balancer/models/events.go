@@ -0,0 +1,74 @@
+package models
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// Types of cluster events.
+const (
+	EventForceRemoved    = "force-removed"   // a member failed its health checks and was removed
+	EventProvisioning    = "provisioning"    // a replacement learner is being added to the cluster
+	EventStarted         = "started"         // the replacement's instance was launched
+	EventCaughtUp        = "caught-up"       // the replacement replicated the log
+	EventPromoted        = "promoted"        // the replacement became a voter and joined the pool
+	EventFailed          = "failed"          // provisioning a replacement or a decommission was given up
+	EventReplicationMet  = "replication-met" // the cluster has its target number of members
+	EventDecommissioning = "decommissioning" // a member is being drained and removed
+	EventDecommissioned  = "decommissioned"  // a member was removed and shut down
+	EventJoined          = "joined"          // a member joined the pool from the registry
+	EventLeft            = "left"            // a member left the pool as the registry no longer lists it
+	EventDrained         = "drained"         // a backend was kept from new requests
+	EventUndrained       = "undrained"       // a drained backend takes requests again
+)
+
+// Event is a change to the cluster made or seen by the load balancer.
+type Event struct {
+	Time    time.Time
+	Type    string
+	Member  uint64
+	Address string
+	Detail  string
+}
+
+// EventLog keeps the most recent events in a ring buffer.
+type EventLog struct {
+	mu     sync.Mutex
+	events []Event
+	next   int // where the next event goes
+	full   bool
+}
+
+func NewEventLog(size int) *EventLog {
+	return &EventLog{events: make([]Event, size)}
+}
+
+// Record logs an event and keeps it, dropping the oldest if the log is full.
+// A nil log only logs.
+func (l *EventLog) Record(eventType string, member uint64, address, detail string) {
+	log.Printf("Cluster event %s: member %d at %s: %s\n", eventType, member, address, detail)
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.events) == 0 {
+		return
+	}
+	l.events[l.next] = Event{Time: time.Now(), Type: eventType, Member: member, Address: address, Detail: detail}
+	l.next = (l.next + 1) % len(l.events)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Recent returns the kept events, oldest first.
+func (l *EventLog) Recent() []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]Event(nil), l.events[:l.next]...)
+	}
+	return append(append([]Event(nil), l.events[l.next:]...), l.events[:l.next]...)
+}
@@ -0,0 +1,22 @@
+package models
+
+import "testing"
+
+func TestEventLogKeepsMostRecent(t *testing.T) {
+	l := NewEventLog(3)
+	if got := l.Recent(); len(got) != 0 {
+		t.Fatalf("Recent = %v, want none", got)
+	}
+	for id := uint64(1); id <= 5; id++ {
+		l.Record(EventStarted, id, "", "")
+	}
+	got := l.Recent()
+	if len(got) != 3 {
+		t.Fatalf("kept %d events, want 3", len(got))
+	}
+	for i, e := range got {
+		if e.Member != uint64(i+3) {
+			t.Fatalf("Recent = %+v, want members 3 to 5 in order", got)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindow     = 1024 // samples kept
+	latencyMinSamples = 32   // samples needed before percentiles are reported
+	latencyRecompute  = 64   // samples between recomputing the cached percentile
+)
+
+// LatencyTracker keeps the most recent request latencies and reports a
+// percentile of them. The percentile is recomputed every latencyRecompute
+// samples, so reading it is cheap.
+type LatencyTracker struct {
+	mu         sync.Mutex
+	quantile   float64
+	samples    []time.Duration
+	next       int
+	sinceCalc  int
+	percentile time.Duration
+}
+
+// NewLatencyTracker tracks the given quantile, between 0 and 1.
+func NewLatencyTracker(quantile float64) *LatencyTracker {
+	return &LatencyTracker{
+		quantile: quantile,
+		samples:  make([]time.Duration, 0, latencyWindow),
+	}
+}
+
+func (t *LatencyTracker) Observe(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.samples) < latencyWindow {
+		t.samples = append(t.samples, d)
+	} else {
+		t.samples[t.next] = d
+		t.next = (t.next + 1) % latencyWindow
+	}
+	t.sinceCalc++
+	if len(t.samples) >= latencyMinSamples && (t.percentile == 0 || t.sinceCalc >= latencyRecompute) {
+		sorted := slices.Clone(t.samples)
+		slices.Sort(sorted)
+		t.percentile = sorted[int(t.quantile*float64(len(sorted)-1))]
+		t.sinceCalc = 0
+	}
+}
+
+// Percentile returns the tracked percentile, or ok false until enough
+// samples have been observed.
+func (t *LatencyTracker) Percentile() (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.percentile, t.percentile > 0
+}
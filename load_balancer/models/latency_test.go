@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyTrackerPercentile(t *testing.T) {
+	tracker := NewLatencyTracker(0.9)
+	for i := 1; i < latencyMinSamples; i++ {
+		tracker.Observe(time.Millisecond)
+	}
+	if _, ok := tracker.Percentile(); ok {
+		t.Fatalf("percentile reported before enough samples")
+	}
+
+	for i := 0; i < latencyWindow; i++ {
+		tracker.Observe(time.Duration(i%100+1) * time.Millisecond)
+	}
+	if p, ok := tracker.Percentile(); !ok || p < 85*time.Millisecond || p > 95*time.Millisecond {
+		t.Fatalf("p90 = %v, %v; want about 90ms", p, ok)
+	}
+
+	// Old samples age out of the window.
+	for i := 0; i < latencyWindow; i++ {
+		tracker.Observe(time.Millisecond)
+	}
+	if p, _ := tracker.Percentile(); p != time.Millisecond {
+		t.Fatalf("p90 = %v after the window turned over, want 1ms", p)
+	}
+}
@@ -0,0 +1,116 @@
+package models
+
+import (
+	"context"
+	pb "load_balancer/proto/kv739"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// leader is the last known raft leader. The ID is 0 if only the address is
+// known, for a leader that is not in the pool.
+type leader struct {
+	id      uint64
+	address string
+}
+
+// Leader returns the ID and KV address of the last known leader, or ok
+// false if no leader is known.
+func (p *ServerPool) Leader() (id uint64, address string, ok bool) {
+	l := p.leader.Load()
+	if l == nil {
+		return 0, "", false
+	}
+	return l.id, l.address, true
+}
+
+// LeaderClient returns a client for the last known leader, or the next
+// backend in round-robin order if no leader is known.
+func (p *ServerPool) LeaderClient() pb.KVStoreServiceClient {
+	if _, address, ok := p.Leader(); ok {
+		if client := p.clientForAddress(address); client != nil {
+			return client
+		}
+	}
+	return p.LoadBalance()
+}
+
+// SetLeader records the backend with the given ID as the leader.
+func (p *ServerPool) SetLeader(id uint64) {
+	m, ok := p.members().members[id]
+	if !ok {
+		return
+	}
+	p.setLeader(&leader{id: id, address: m.backend.Address})
+}
+
+// ObserveRedirect records address, taken from a Redirect response, as the
+// leader and returns a client for it. Addresses outside the pool get a
+// connection of their own.
+func (p *ServerPool) ObserveRedirect(address string) pb.KVStoreServiceClient {
+	id, _ := p.ID(address)
+	p.setLeader(&leader{id: id, address: address})
+	return p.clientForAddress(address)
+}
+
+// ClearLeader forgets the leader, so the next write looks for it again.
+func (p *ServerPool) ClearLeader() {
+	if old := p.leader.Swap(nil); old != nil {
+		log.Printf("Forgetting leader %d at %s\n", old.id, old.address)
+	}
+}
+
+func (p *ServerPool) setLeader(l *leader) {
+	old := p.leader.Swap(l)
+	if old == nil || *old != *l {
+		log.Printf("Leader is now %d at %s\n", l.id, l.address)
+	}
+}
+
+func (p *ServerPool) clientForAddress(address string) pb.KVStoreServiceClient {
+	if client := p.GetClientByAddress(address); client != nil {
+		return client
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if client, ok := p.redirectClients[address]; ok {
+		return client
+	}
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		log.Printf("Failed to connect to leader %s: %v\n", address, err)
+		return nil
+	}
+	p.redirectConns = append(p.redirectConns, conn)
+	p.redirectClients[address] = pb.NewKVStoreServiceClient(conn)
+	return p.redirectClients[address]
+}
+
+// TrackLeader polls the healthy backends' status every interval and
+// records the leader they report, so writes go straight to it even before
+// any of them has been redirected.
+func (p *ServerPool) TrackLeader(interval time.Duration) {
+	for {
+		p.pollLeader()
+		time.Sleep(interval)
+	}
+}
+
+func (p *ServerPool) pollLeader() {
+	view := p.members()
+	for _, id := range view.ids {
+		m := view.members[id]
+		if !m.backend.Healthy() {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		resp, err := m.client.Status(ctx, &pb.StatusRequest{})
+		cancel()
+		if err == nil && resp.LeaderId != 0 {
+			p.SetLeader(resp.LeaderId)
+			return
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	pb "load_balancer/proto/kv739"
+	"log"
+	"time"
+)
+
+// WatchMembers keeps the pool in step with the cluster's member registry.
+// It subscribes through one healthy backend at a time and moves to another
+// when the stream breaks or that backend turns unhealthy.
+func (p *ServerPool) WatchMembers(retry time.Duration) {
+	for {
+		id, client, ok := p.pick(p.Strategy().Pick, nil)
+		if !ok {
+			time.Sleep(retry)
+			continue
+		}
+		err := p.watchMembers(id, client, retry)
+		log.Printf("Member registry stream from backend %d ended: %v\n", id, err)
+		time.Sleep(retry)
+	}
+}
+
+func (p *ServerPool) watchMembers(id uint64, client pb.KVStoreServiceClient, interval time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		// A backend that stopped answering may keep the stream open.
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if m, ok := p.members().members[id]; !ok || !m.backend.Healthy() {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	stream, err := client.Members(ctx, &pb.MembersRequest{})
+	if err != nil {
+		return err
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		p.SyncMembers(resp.Members)
+	}
+}
+
+// SyncMembers adds the voting members the pool lacks and removes the
+// backends no longer listed as voters. An empty list is ignored, since a cluster always has members.
+func (p *ServerPool) SyncMembers(members []*pb.Member) {
+	if len(members) == 0 {
+		return
+	}
+	view := p.members()
+	listed := make(map[string]bool, len(members))
+	for _, m := range members {
+		p.mu.Lock()
+		p.globalNextID = max(p.globalNextID, m.Id+1)
+		p.mu.Unlock()
+		if m.Learner {
+			// Learners serve no clients until they are promoted.
+			continue
+		}
+		listed[m.KvAddress] = true
+		if id, ok := view.byAddress[m.KvAddress]; !ok || id != m.Id {
+			p.events.Record(EventJoined, m.Id, m.KvAddress, "listed in the member registry")
+			p.AddServer(m.Id, m.KvAddress)
+		}
+	}
+	for _, id := range view.ids {
+		if address := view.members[id].backend.Address; !listed[address] {
+			p.events.Record(EventLeft, id, address, "no longer listed in the member registry")
+			p.RemoveServer(address)
+		}
+	}
+}
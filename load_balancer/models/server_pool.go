@@ -5,6 +5,8 @@ import (
 	"load_balancer/consts"
 	pb "load_balancer/proto/kv739"
 	"log"
+	"slices"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -12,147 +14,422 @@ import (
 	"google.golang.org/grpc"
 )
 
+// ServerPool tracks the backends and routes requests between them. Its
+// membership is an immutable view swapped atomically, so requests and health
+// checks read it without locking while members come and go.
 type ServerPool struct {
-	IDs             []uint64
-	IdToServers     map[uint64]string
-	IdToConnections map[uint64]*grpc.ClientConn
-	IdToClient      map[uint64]pb.KVStoreServiceClient
-	current         uint32
-	Health          map[uint64]int
-	AddressToID     map[string]uint64
-	globalNextID    uint64
+	view         atomic.Pointer[membership]
+	updateMu     sync.Mutex // serializes membership updates
+	seed         map[uint64]string
+	globalNextID uint64
+
+	strategy        atomic.Value // strategyHolder
+	weights         map[uint64]int
+	breakerConfig   BreakerConfig
+	leader          atomic.Pointer[leader]
+	redirectClients map[string]pb.KVStoreServiceClient // leaders outside the pool, by address
+	redirectConns   []*grpc.ClientConn
+	recheck         chan chan struct{} // forced health checks, closed when done
+	events          *EventLog
 
 	mu sync.Mutex
 }
 
+// membership is one version of the pool's members. It is never changed once
+// published; updates publish a copy.
+type membership struct {
+	ids       []uint64 // in the order the members joined
+	members   map[uint64]*member
+	byAddress map[string]uint64
+}
+
+// member is a backend and its connection. Its health and statistics live
+// in the Backend, which is shared by every view the member is in.
+type member struct {
+	backend *Backend
+	conn    *grpc.ClientConn
+	client  pb.KVStoreServiceClient
+}
+
+func (m *membership) clone() *membership {
+	next := &membership{
+		ids:       slices.Clone(m.ids),
+		members:   make(map[uint64]*member, len(m.members)+1),
+		byAddress: make(map[string]uint64, len(m.byAddress)+1),
+	}
+	for id, mem := range m.members {
+		next.members[id] = mem
+	}
+	for address, id := range m.byAddress {
+		next.byAddress[address] = id
+	}
+	return next
+}
+
 func NewServerPool(IDs []uint64, servers map[uint64]string) *ServerPool {
-	return &ServerPool{
-		IDs:             IDs,
-		IdToServers:     servers,
-		IdToConnections: make(map[uint64]*grpc.ClientConn, len(servers)),
-		IdToClient:      make(map[uint64]pb.KVStoreServiceClient, len(servers)),
-		Health:          make(map[uint64]int, len(servers)),
-		AddressToID:     make(map[string]uint64),
-		globalNextID:    IDs[len(IDs)-1] + 1,
+	p := &ServerPool{
+		seed:            servers,
+		globalNextID:    1,
+		redirectClients: make(map[string]pb.KVStoreServiceClient),
+		breakerConfig:   DefaultBreakerConfig,
+		recheck:         make(chan chan struct{}),
 		mu:              sync.Mutex{},
 	}
+	for _, id := range IDs {
+		p.globalNextID = max(p.globalNextID, id+1)
+	}
+	p.view.Store(&membership{members: map[uint64]*member{}, byAddress: map[string]uint64{}})
+	p.SetStrategy(&roundRobin{})
+	return p
 }
 
-func (p *ServerPool) Connect() {
-	// Connect to all servers in the server list
-	for id, server := range p.IdToServers {
-		conn, err := grpc.Dial(server, grpc.WithInsecure())
-		if err != nil {
-			log.Fatalf("Failed to connect to server: %v", err)
-		}
+// members returns the current membership view.
+func (p *ServerPool) members() *membership {
+	return p.view.Load()
+}
+
+// update applies change to a copy of the membership and publishes it. It is
+// the only way the membership changes, and runs one change at a time.
+func (p *ServerPool) update(change func(next *membership)) {
+	p.updateMu.Lock()
+	defer p.updateMu.Unlock()
+	next := p.members().clone()
+	change(next)
+	p.view.Store(next)
+}
+
+// strategyHolder gives every strategy the same concrete type, as atomic.Value requires.
+type strategyHolder struct {
+	Strategy
+}
+
+// SetStrategy changes how backends are picked for reads.
+func (p *ServerPool) SetStrategy(strategy Strategy) {
+	p.strategy.Store(strategyHolder{strategy})
+}
+
+func (p *ServerPool) Strategy() Strategy {
+	return p.strategy.Load().(strategyHolder).Strategy
+}
+
+// SetWeights sets the weights of backends under the weighted strategy, by
+// ID. Backends without a weight get 1. It must be called before Connect.
+func (p *ServerPool) SetWeights(weights map[uint64]int) {
+	p.weights = weights
+}
 
-		p.IdToConnections[id] = conn
-		p.IdToClient[id] = pb.NewKVStoreServiceClient(conn)
-		p.AddressToID[server] = id
+// SetEventLog records the pool's membership changes in events.
+func (p *ServerPool) SetEventLog(events *EventLog) {
+	p.events = events
+}
+
+// SetBreakerConfig configures the backends' circuit breakers. It must be
+// called before Connect.
+func (p *ServerPool) SetBreakerConfig(config BreakerConfig) {
+	p.breakerConfig = config
+}
+
+// dial connects to a backend, tracking its requests in a new Backend.
+func (p *ServerPool) dial(id uint64, address string) *member {
+	backend := NewBackend(id, address, p.weights[id], p.breakerConfig)
+	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithUnaryInterceptor(backend.interceptor))
+	if err != nil {
+		log.Fatalf("Failed to connect to server: %v", err)
 	}
+	return &member{backend: backend, conn: conn, client: pb.NewKVStoreServiceClient(conn)}
 }
 
-// Close closes all IdToConnections to servers in the pool
+// Connect adds the servers the pool was created with.
+func (p *ServerPool) Connect() {
+	ids := make([]uint64, 0, len(p.seed))
+	for id := range p.seed {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		p.AddServer(id, p.seed[id])
+	}
+}
+
+// Close closes the connections to the servers in the pool
 func (p *ServerPool) Close() {
-	for _, conn := range p.IdToConnections {
-		if err := conn.Close(); err != nil {
+	for _, m := range p.members().members {
+		if err := m.conn.Close(); err != nil {
 			log.Printf("Failed to close connection: %v", err)
 		}
 	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conn := range p.redirectConns {
+		conn.Close()
+	}
 }
 
-func (p *ServerPool) getNextServer() pb.KVStoreServiceClient {
-	count := 0
-	for {
-		if count == len(p.IdToServers) {
-			log.Fatalf("All servers are unhealthy")
+// pick chooses among the healthy backends not in exclude, or among all the
+// healthy ones if every one of them is excluded. A backend is healthy if it
+// answers health checks and its circuit breaker lets requests through. It
+// returns ok false if no backend is healthy.
+func (p *ServerPool) pick(choose func(candidates []*Backend) *Backend, exclude []uint64) (uint64, pb.KVStoreServiceClient, bool) {
+	view := p.members()
+	healthy := make([]*Backend, 0, len(view.ids))
+	candidates := make([]*Backend, 0, len(view.ids))
+	for _, id := range view.ids {
+		b := view.members[id].backend
+		// Skip unhealthy and draining servers
+		if !b.Healthy() || b.Draining() || !b.Breaker.Ready() {
+			continue
 		}
-		// Atomically increment and get the next server index
-		next := atomic.AddUint32(&p.current, 1)
-		index := next % uint32(len(p.IDs))
-		id := p.IDs[index]
-
-		// Check if the server is healthy
-		if p.Health[id] == 0 {
-			return p.IdToClient[id]
+		healthy = append(healthy, b)
+		if !slices.Contains(exclude, id) {
+			candidates = append(candidates, b)
 		}
-		// If not healthy, continue to the next server
-		log.Printf("Skipping unhealthy server: %s\n", p.IdToServers[id])
-		count += 1
 	}
+	if len(candidates) == 0 {
+		candidates = healthy
+	}
+	if len(candidates) == 0 {
+		log.Printf("All servers are unhealthy")
+		return 0, nil, false
+	}
+	id := choose(candidates).ID
+	return id, view.members[id].client, true
 }
 
+// Pick chooses a backend for a request on key, preferring ones not in
+// exclude. Under a keyed strategy, requests for the same key keep going to
+// the same backend. It returns ok false if no backend is healthy.
+func (p *ServerPool) Pick(key string, exclude []uint64) (uint64, pb.KVStoreServiceClient, bool) {
+	strategy := p.Strategy()
+	if keyed, ok := strategy.(KeyedStrategy); ok {
+		return p.pick(func(candidates []*Backend) *Backend {
+			return keyed.PickKey(key, candidates)
+		}, exclude)
+	}
+	return p.pick(strategy.Pick, exclude)
+}
+
+// LoadBalance returns the next backend by the strategy, or nil if no
+// backend is healthy.
 func (p *ServerPool) LoadBalance() pb.KVStoreServiceClient {
-	return p.getNextServer()
+	_, client, _ := p.pick(p.Strategy().Pick, nil)
+	return client
 }
 
-// HealthCheck runs a periodic Health check on all servers
+// HealthCheck runs a periodic Health check on all servers, and the checks
+// RecheckHealth asks for in between.
 func (p *ServerPool) HealthCheck(interval time.Duration, forceLeaveC chan<- string) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 	for {
-		time.Sleep(interval)
-		for id, client := range p.IdToClient {
-			// Perform a Health check on the server (using a Ping method or similar)
-			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-			resp, err := client.Ping(ctx, &pb.PingRequest{})
-			cancel()
-
-			// Update Health status based on response
-			if err == nil && resp.GetMessage() == "pong" {
-				//log.Printf("Server %s is healthy", p.IdToServers[id])
-				p.Health[id] = 0
-			} else {
-				log.Printf("Server %s is unhealthy: err=%v, message=%s", p.IdToServers[id], err, resp.GetMessage())
-				p.Health[id] += 1
-				if p.Health[id] >= consts.ForceRemoveThreshold {
-					forceLeaveC <- p.IdToServers[id]
+		select {
+		case <-ticker.C:
+			p.checkHealth(forceLeaveC)
+		case done := <-p.recheck:
+			p.checkHealth(forceLeaveC)
+			close(done)
+		}
+	}
+}
+
+// RecheckHealth checks every backend now, instead of at the next interval,
+// and waits for the check to finish. It needs HealthCheck to be running.
+func (p *ServerPool) RecheckHealth(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case p.recheck <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// checkHealth pings every member of the current view once.
+func (p *ServerPool) checkHealth(forceLeaveC chan<- string) {
+	view := p.members()
+	for _, id := range view.ids {
+		m := view.members[id]
+		// Perform a Health check on the server (using a Ping method or similar)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		resp, err := m.client.Ping(ctx, &pb.PingRequest{})
+		cancel()
+
+		// Update Health status based on response
+		if err == nil && resp.GetMessage() == "pong" {
+			m.backend.markHealthy()
+		} else {
+			log.Printf("Server %s is unhealthy: err=%v, message=%s", m.backend.Address, err, resp.GetMessage())
+			// Offered after every failed check from the threshold on, until
+			// the member is removed, in case the receiver cannot act at once.
+			// Never waited for: the checks of the other members go on.
+			if m.backend.markUnhealthy() >= consts.ForceRemoveThreshold {
+				select {
+				case forceLeaveC <- m.backend.Address:
+				default:
 				}
 			}
 		}
 	}
 }
 
-func (p *ServerPool) NextID() uint64 {
+// IDFloor returns the lowest ID above every member the pool has known. New
+// IDs are allocated through the cluster, from at least this value.
+func (p *ServerPool) IDFloor() uint64 {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	return p.globalNextID
+}
 
-	id := p.globalNextID
-	p.globalNextID += 1
-	return id
+// ID returns the ID of the member at address.
+func (p *ServerPool) ID(address string) (uint64, bool) {
+	id, ok := p.members().byAddress[address]
+	return id, ok
 }
 
 func (p *ServerPool) GetClientByAddress(address string) pb.KVStoreServiceClient {
-	return p.IdToClient[p.AddressToID[address]]
+	view := p.members()
+	if id, ok := view.byAddress[address]; ok {
+		return view.members[id].client
+	}
+	return nil
 }
 
-func (p *ServerPool) AddServer(id uint64, address string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
+// SetHealthy marks the member at address healthy or down until its next
+// health check.
+func (p *ServerPool) SetHealthy(address string, healthy bool) {
+	view := p.members()
+	id, ok := view.byAddress[address]
+	if !ok {
+		return
+	}
+	if healthy {
+		view.members[id].backend.markHealthy()
+	} else {
+		view.members[id].backend.markUnhealthy()
+	}
+}
 
-	p.IDs = append(p.IDs, id)
-	p.IdToServers[id] = address
-	conn, err := grpc.Dial(address, grpc.WithInsecure())
-	if err != nil {
-		log.Fatalf("Failed to connect to server: %v", err)
+// SetDraining keeps the backend at address from new requests, or lets it
+// take them again. It returns false if no backend has that address.
+func (p *ServerPool) SetDraining(address string, draining bool) bool {
+	view := p.members()
+	id, ok := view.byAddress[address]
+	if ok {
+		view.members[id].backend.draining.Store(draining)
 	}
+	return ok
+}
 
-	p.IdToConnections[id] = conn
-	p.IdToClient[id] = pb.NewKVStoreServiceClient(conn)
-	p.AddressToID[address] = id
+// SetDrained drains exactly the backends whose addresses are in drained.
+func (p *ServerPool) SetDrained(drained []string) {
+	for _, m := range p.members().members {
+		m.backend.draining.Store(slices.Contains(drained, m.backend.Address))
+	}
+}
+
+// AddServer connects to a new member. Adding an ID or address already in the
+// pool replaces that member, unless both match it.
+func (p *ServerPool) AddServer(id uint64, address string) {
+	if current, ok := p.ID(address); ok && current == id {
+		return
+	}
+	m := p.dial(id, address)
+	var replaced []*member
+	p.update(func(next *membership) {
+		if old, ok := next.members[id]; ok {
+			replaced = append(replaced, old)
+			delete(next.byAddress, old.backend.Address)
+			next.ids = slices.DeleteFunc(next.ids, func(v uint64) bool { return v == id })
+		}
+		if oldID, ok := next.byAddress[address]; ok {
+			replaced = append(replaced, next.members[oldID])
+			delete(next.members, oldID)
+			next.ids = slices.DeleteFunc(next.ids, func(v uint64) bool { return v == oldID })
+		}
+		next.ids = append(next.ids, id)
+		next.members[id] = m
+		next.byAddress[address] = id
+	})
+	for _, old := range replaced {
+		closeLater(old)
+	}
 }
 
 func (p *ServerPool) RemoveServer(address string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	id := p.AddressToID[address]
-	for i, v := range p.IDs {
-		if v == id {
-			p.IDs = append(p.IDs[:i], p.IDs[i+1:]...)
-			break
+	var removed *member
+	p.update(func(next *membership) {
+		id, ok := next.byAddress[address]
+		if !ok {
+			return
 		}
+		removed = next.members[id]
+		next.ids = slices.DeleteFunc(next.ids, func(v uint64) bool { return v == id })
+		delete(next.members, id)
+		delete(next.byAddress, address)
+	})
+	if l := p.leader.Load(); l != nil && l.address == address {
+		p.leader.CompareAndSwap(l, nil)
+	}
+	if removed != nil {
+		closeLater(removed)
+	}
+}
+
+// closeLater closes a removed member's connection once requests that picked
+// it from an older view have had time to finish.
+func closeLater(m *member) {
+	time.AfterFunc(consts.RemovedConnGrace, func() {
+		m.conn.Close()
+	})
+}
+
+// BackendStatus is a point-in-time view of a backend.
+type BackendStatus struct {
+	ID       uint64
+	Address  string
+	Healthy  bool
+	Draining bool
+	Leader   bool
+	Weight   int
+	InFlight int64
+	Latency  time.Duration
+	Requests uint64
+	Failures uint64
+	// Breaker is the circuit breaker's state; ErrorRate is the share of
+	// requests that failed in its current window.
+	Breaker   BreakerState
+	ErrorRate float64
+}
+
+// Backends returns the status of every backend, in ID order.
+func (p *ServerPool) Backends() []BackendStatus {
+	leaderID, _, _ := p.Leader()
+	view := p.members()
+	out := make([]BackendStatus, 0, len(view.ids))
+	for _, id := range view.ids {
+		b := view.members[id].backend
+		requests, failures := b.Requests()
+		breaker, errorRate := b.Breaker.State()
+		out = append(out, BackendStatus{
+			ID:       id,
+			Address:  b.Address,
+			Healthy:  b.Healthy(),
+			Draining: b.Draining(),
+			Leader:   id == leaderID,
+			Weight:   b.Weight,
+			InFlight: b.InFlight(),
+			Latency:  b.Latency(),
+			Requests: requests,
+			Failures: failures,
+
+			Breaker:   breaker,
+			ErrorRate: errorRate,
+		})
 	}
-	delete(p.AddressToID, address)
-	delete(p.IdToServers, id)
-	delete(p.IdToConnections, id)
-	delete(p.IdToClient, id)
-	delete(p.Health, id)
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
 }
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"load_balancer/consts"
+	pb "load_balancer/proto/kv739"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testAddress is a port nothing listens on; connections are made lazily, so
+// routing never touches the network.
+func testAddress(id uint64) string {
+	return fmt.Sprintf("127.0.0.1:%d", 1+id%1000)
+}
+
+func TestServerPoolConnectsSeedServers(t *testing.T) {
+	p := NewServerPool([]uint64{1, 2, 3}, map[uint64]string{1: testAddress(1), 2: testAddress(2), 3: testAddress(3)})
+	p.Connect()
+	defer p.Close()
+
+	if got := p.IDFloor(); got != 4 {
+		t.Fatalf("ID floor = %d, want 4", got)
+	}
+	for id := uint64(1); id <= 3; id++ {
+		if got, ok := p.ID(testAddress(id)); !ok || got != id {
+			t.Fatalf("ID(%s) = %d, %v, want %d", testAddress(id), got, ok, id)
+		}
+	}
+	statuses := p.Backends()
+	if len(statuses) != 3 || statuses[0].ID != 1 || !statuses[0].Healthy {
+		t.Fatalf("backends = %+v, want 3 healthy backends", statuses)
+	}
+}
+
+func TestServerPoolRemoveForgetsMember(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	p.AddServer(1, testAddress(1))
+	p.AddServer(2, testAddress(2))
+	p.SetLeader(2)
+
+	p.RemoveServer(testAddress(2))
+	if _, ok := p.ID(testAddress(2)); ok {
+		t.Fatalf("removed server still in the pool")
+	}
+	if p.GetClientByAddress(testAddress(2)) != nil {
+		t.Fatalf("removed server still has a client")
+	}
+	if _, _, ok := p.Leader(); ok {
+		t.Fatalf("removed leader still recorded")
+	}
+	for i := 0; i < 10; i++ {
+		if id, _, ok := p.Pick("", nil); !ok || id != 1 {
+			t.Fatalf("picked %d, %v, want 1", id, ok)
+		}
+	}
+
+	p.RemoveServer(testAddress(1))
+	if _, _, ok := p.Pick("", nil); ok {
+		t.Fatalf("picked a backend from an empty pool")
+	}
+}
+
+func TestServerPoolSkipsUnhealthy(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	p.AddServer(1, testAddress(1))
+	p.AddServer(2, testAddress(2))
+
+	p.SetHealthy(testAddress(1), false)
+	for i := 0; i < 10; i++ {
+		if id, _, _ := p.Pick("", nil); id != 2 {
+			t.Fatalf("picked unhealthy backend %d", id)
+		}
+	}
+	p.SetHealthy(testAddress(1), true)
+	if id, _, _ := p.Pick("", []uint64{2}); id != 1 {
+		t.Fatalf("picked %d, want the recovered backend 1", id)
+	}
+}
+
+func TestServerPoolSkipsDraining(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	p.AddServer(1, testAddress(1))
+	p.AddServer(2, testAddress(2))
+
+	if !p.SetDraining(testAddress(1), true) {
+		t.Fatalf("SetDraining did not find backend 1")
+	}
+	for i := 0; i < 10; i++ {
+		if id, _, _ := p.Pick("", []uint64{2}); id != 2 {
+			t.Fatalf("picked draining backend %d", id)
+		}
+	}
+	if p.SetDraining(testAddress(3), true) {
+		t.Fatalf("SetDraining found a backend that is not in the pool")
+	}
+	p.SetDraining(testAddress(1), false)
+	if id, _, _ := p.Pick("", []uint64{2}); id != 1 {
+		t.Fatalf("picked %d, want the undrained backend 1", id)
+	}
+
+	// The drained set shared by the load balancers replaces local flags.
+	p.SetDraining(testAddress(1), true)
+	p.SetDrained([]string{testAddress(2), testAddress(3)})
+	for _, b := range p.Backends() {
+		if b.Draining != (b.ID == 2) {
+			t.Fatalf("backend %d draining = %v, want only backend 2 drained", b.ID, b.Draining)
+		}
+	}
+}
+
+// TestServerPoolConcurrentMembership adds, removes and routes at the same
+// time; run it with -race.
+func TestServerPoolConcurrentMembership(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	for id := uint64(1); id <= 3; id++ {
+		p.AddServer(id, testAddress(id))
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	// Churn members 10 to 29 in and out while the stable ones stay.
+	for w := uint64(0); w < 4; w++ {
+		wg.Add(1)
+		go func(w uint64) {
+			defer wg.Done()
+			for round := 0; round < 50; round++ {
+				for id := 10 + w*5; id < 15+w*5; id++ {
+					p.AddServer(id, testAddress(id))
+					p.SetHealthy(testAddress(id), round%2 == 0)
+				}
+				for id := 10 + w*5; id < 15+w*5; id++ {
+					p.RemoveServer(testAddress(id))
+				}
+			}
+		}(w)
+	}
+
+	var routers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		routers.Add(1)
+		go func(r int) {
+			defer routers.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				id, client, ok := p.Pick(fmt.Sprintf("key-%d", i), []uint64{uint64(r)})
+				if !ok || client == nil || id == 0 {
+					t.Errorf("pick = %d, %v, %v with stable members present", id, client, ok)
+					return
+				}
+				p.SetLeader(id)
+				p.Backends()
+			}
+		}(r)
+	}
+
+	wg.Wait()
+	close(stop)
+	routers.Wait()
+
+	statuses := p.Backends()
+	if len(statuses) != 3 {
+		t.Fatalf("backends = %+v, want the 3 stable ones", statuses)
+	}
+	for i, s := range statuses {
+		if s.ID != uint64(i+1) || s.Address != testAddress(s.ID) {
+			t.Fatalf("backend %d = %+v", i, s)
+		}
+	}
+}
+
+func TestSyncMembers(t *testing.T) {
+	p := NewServerPool([]uint64{1, 2}, map[uint64]string{1: testAddress(1), 2: testAddress(2)})
+	p.Connect()
+	defer p.Close()
+	before := p.GetClientByAddress(testAddress(1))
+
+	p.SyncMembers([]*pb.Member{{Id: 1, KvAddress: testAddress(1)}, {Id: 5, KvAddress: testAddress(5)}})
+	if p.GetClientByAddress(testAddress(1)) != before {
+		t.Fatalf("unchanged member was reconnected")
+	}
+	if _, ok := p.ID(testAddress(2)); ok {
+		t.Fatalf("unlisted member kept")
+	}
+	if id, ok := p.ID(testAddress(5)); !ok || id != 5 {
+		t.Fatalf("ID(%s) = %d, %v, want 5", testAddress(5), id, ok)
+	}
+	if got := p.IDFloor(); got != 6 {
+		t.Fatalf("ID floor = %d, want 6", got)
+	}
+
+	// Learners are not routed to, but their IDs are taken.
+	p.SyncMembers([]*pb.Member{{Id: 1, KvAddress: testAddress(1)}, {Id: 5, KvAddress: testAddress(5)}, {Id: 8, KvAddress: testAddress(8), Learner: true}})
+	if _, ok := p.ID(testAddress(8)); ok {
+		t.Fatalf("learner joined the pool")
+	}
+	if got := p.IDFloor(); got != 9 {
+		t.Fatalf("ID floor = %d, want 9", got)
+	}
+
+	p.SyncMembers(nil)
+	if len(p.Backends()) != 2 {
+		t.Fatalf("empty member list emptied the pool")
+	}
+}
+
+func TestServerPoolRecheckHealth(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	p.AddServer(1, testAddress(1))
+	go p.HealthCheck(time.Hour, make(chan string, 1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := p.RecheckHealth(ctx); err != nil {
+		t.Fatalf("RecheckHealth: %v", err)
+	}
+	// Nothing listens at the test address.
+	if b := p.Backends()[0]; b.Healthy {
+		t.Fatalf("backend %+v still healthy after a forced check", b)
+	}
+}
+
+func TestServerPoolHealthCheckDoesNotWaitForForcedLeave(t *testing.T) {
+	p := NewServerPool(nil, nil)
+	defer p.Close()
+	p.AddServer(1, testAddress(1))
+	// Nobody receives: the forced leave is busy elsewhere.
+	forceLeaveC := make(chan string)
+	go p.HealthCheck(time.Hour, forceLeaveC)
+
+	for i := 0; i <= consts.ForceRemoveThreshold; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := p.RecheckHealth(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("check %d: RecheckHealth: %v", i+1, err)
+		}
+	}
+}
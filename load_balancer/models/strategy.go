@@ -0,0 +1,185 @@
+package models
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Balancing strategies.
+const (
+	StrategyRoundRobin       = "round-robin"
+	StrategyLeastOutstanding = "least-outstanding"
+	StrategyP2CEWMA          = "p2c-ewma"
+	StrategyWeighted         = "weighted"
+	StrategyConsistentHash   = "consistent-hash"
+)
+
+// Strategy picks the backend for a request.
+type Strategy interface {
+	Name() string
+	// Pick chooses one of the candidates, which are healthy and never empty.
+	Pick(candidates []*Backend) *Backend
+}
+
+// NewStrategy returns the strategy with the given name.
+func NewStrategy(name string) (Strategy, error) {
+	switch name {
+	case StrategyRoundRobin:
+		return &roundRobin{}, nil
+	case StrategyLeastOutstanding:
+		return &leastOutstanding{}, nil
+	case StrategyP2CEWMA:
+		return &p2cEWMA{}, nil
+	case StrategyWeighted:
+		return &weightedRoundRobin{}, nil
+	case StrategyConsistentHash:
+		return &consistentHash{}, nil
+	}
+	return nil, fmt.Errorf("unknown balancing strategy %q, want %s, %s, %s, %s or %s",
+		name, StrategyRoundRobin, StrategyLeastOutstanding, StrategyP2CEWMA, StrategyWeighted, StrategyConsistentHash)
+}
+
+// roundRobin takes the candidates in turn.
+type roundRobin struct {
+	next atomic.Uint32
+}
+
+func (s *roundRobin) Name() string { return StrategyRoundRobin }
+
+func (s *roundRobin) Pick(candidates []*Backend) *Backend {
+	return candidates[s.next.Add(1)%uint32(len(candidates))]
+}
+
+// leastOutstanding picks the backend with the fewest requests in flight,
+// breaking ties in turn so idle backends share the load.
+type leastOutstanding struct {
+	next atomic.Uint32
+}
+
+func (s *leastOutstanding) Name() string { return StrategyLeastOutstanding }
+
+func (s *leastOutstanding) Pick(candidates []*Backend) *Backend {
+	offset := int(s.next.Add(1))
+	var best *Backend
+	for i := range candidates {
+		b := candidates[(offset+i)%len(candidates)]
+		if best == nil || b.InFlight() < best.InFlight() {
+			best = b
+		}
+	}
+	return best
+}
+
+// p2cEWMA samples two backends at random and picks the one with the lower
+// expected wait, its latency average scaled by its requests in flight.
+type p2cEWMA struct{}
+
+func (s *p2cEWMA) Name() string { return StrategyP2CEWMA }
+
+func (s *p2cEWMA) Pick(candidates []*Backend) *Backend {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	i := rand.Intn(len(candidates))
+	j := rand.Intn(len(candidates) - 1)
+	if j >= i {
+		j++
+	}
+	a, b := candidates[i], candidates[j]
+	if b.score() < a.score() {
+		return b
+	}
+	return a
+}
+
+// weightedRoundRobin spreads requests in proportion to the backends'
+// weights, interleaving them smoothly instead of sending runs to one backend.
+type weightedRoundRobin struct {
+	mu sync.Mutex
+}
+
+func (s *weightedRoundRobin) Name() string { return StrategyWeighted }
+
+func (s *weightedRoundRobin) Pick(candidates []*Backend) *Backend {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var best *Backend
+	total := 0
+	for _, b := range candidates {
+		b.current += b.Weight
+		total += b.Weight
+		if best == nil || b.current > best.current {
+			best = b
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// KeyedStrategy is a Strategy that can also pick by key, so requests for
+// the same key go to the same backend.
+type KeyedStrategy interface {
+	Strategy
+	PickKey(key string, candidates []*Backend) *Backend
+}
+
+// loadBound is how far above the average in-flight count a backend may go
+// before keys it prefers spill over to their next choice.
+const loadBound = 1.25
+
+// consistentHash pins each key to a preferred backend with weighted
+// rendezvous hashing, so each node's cache sees a stable share of the keys
+// and a membership change only moves the keys of the backend that came or
+// went. A backend whose in-flight count exceeds loadBound times the average
+// passes its keys to their next-ranked backend. Requests without a key are
+// spread round-robin.
+type consistentHash struct {
+	roundRobin
+}
+
+func (s *consistentHash) Name() string { return StrategyConsistentHash }
+
+func (s *consistentHash) PickKey(key string, candidates []*Backend) *Backend {
+	keyHash := fnv.New64a()
+	keyHash.Write([]byte(key))
+	h := keyHash.Sum64()
+
+	ranked := make([]*Backend, len(candidates))
+	copy(ranked, candidates)
+	scores := make(map[*Backend]float64, len(ranked))
+	var total int64
+	for _, b := range ranked {
+		scores[b] = rendezvousScore(h, b)
+		total += b.InFlight()
+	}
+	sort.Slice(ranked, func(i, j int) bool { return scores[ranked[i]] > scores[ranked[j]] })
+
+	limit := int64(math.Ceil(loadBound * float64(total+1) / float64(len(ranked))))
+	for _, b := range ranked {
+		if b.InFlight() < limit {
+			return b
+		}
+	}
+	return ranked[0]
+}
+
+// rendezvousScore is the backend's weighted score for a key hash; the
+// backend with the highest score owns the key.
+func rendezvousScore(keyHash uint64, b *Backend) float64 {
+	// Map the combined hash to (0, 1) and weight it so a backend's share of
+	// keys is proportional to its weight.
+	u := (float64(splitmix64(keyHash^splitmix64(b.ID))>>11) + 0.5) / (1 << 53)
+	return float64(b.Weight) / -math.Log(u)
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
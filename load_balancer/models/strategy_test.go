@@ -0,0 +1,119 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func testBackends(weights ...int) []*Backend {
+	var out []*Backend
+	for i, w := range weights {
+		out = append(out, NewBackend(uint64(i+1), "", w, DefaultBreakerConfig))
+	}
+	return out
+}
+
+func countPicks(s Strategy, backends []*Backend, n int) map[uint64]int {
+	counts := make(map[uint64]int)
+	for i := 0; i < n; i++ {
+		counts[s.Pick(backends).ID]++
+	}
+	return counts
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	s, _ := NewStrategy(StrategyWeighted)
+	counts := countPicks(s, testBackends(3, 1, 2), 600)
+	if counts[1] != 300 || counts[2] != 100 || counts[3] != 200 {
+		t.Fatalf("picks = %v, want 300/100/200", counts)
+	}
+}
+
+func TestLeastOutstanding(t *testing.T) {
+	s, _ := NewStrategy(StrategyLeastOutstanding)
+	backends := testBackends(1, 1, 1)
+	backends[0].begin()
+	backends[1].begin()
+	if got := s.Pick(backends).ID; got != 3 {
+		t.Fatalf("picked %d, want the idle backend 3", got)
+	}
+
+	// Idle backends share the load.
+	backends[0].done(time.Now(), nil)
+	backends[1].done(time.Now(), nil)
+	if counts := countPicks(s, backends, 30); counts[1] != 10 || counts[2] != 10 || counts[3] != 10 {
+		t.Fatalf("picks = %v, want an even spread", counts)
+	}
+}
+
+func TestP2CEWMAAvoidsSlowBackend(t *testing.T) {
+	s, _ := NewStrategy(StrategyP2CEWMA)
+	backends := testBackends(1, 1, 1)
+	for _, b := range backends {
+		b.done(b.begin(), nil)
+	}
+	slow := backends[0]
+	slow.done(slow.begin().Add(-time.Second), nil)
+
+	// The two samples are distinct, so the slow backend always loses.
+	if counts := countPicks(s, backends, 1000); counts[1] != 0 || counts[2] == 0 || counts[3] == 0 {
+		t.Fatalf("picks = %v, want the slow backend avoided", counts)
+	}
+}
+
+func TestNewStrategyRejectsUnknownName(t *testing.T) {
+	if _, err := NewStrategy("random"); err == nil {
+		t.Fatalf("unknown strategy accepted")
+	}
+}
+
+func TestConsistentHashMovesOnlyRemovedKeys(t *testing.T) {
+	s := &consistentHash{}
+	backends := testBackends(1, 1, 1, 1)
+	before := make(map[string]uint64)
+	counts := make(map[uint64]int)
+	for i := 0; i < 4000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		before[key] = s.PickKey(key, backends).ID
+		counts[before[key]]++
+	}
+	for id, n := range counts {
+		if n < 800 || n > 1200 {
+			t.Fatalf("backend %d owns %d of 4000 keys, want about 1000", id, n)
+		}
+	}
+
+	// Removing backend 2 only moves the keys it owned.
+	remaining := []*Backend{backends[0], backends[2], backends[3]}
+	for key, owner := range before {
+		after := s.PickKey(key, remaining).ID
+		if owner != 2 && after != owner {
+			t.Fatalf("key %s moved from %d to %d", key, owner, after)
+		}
+	}
+}
+
+func TestConsistentHashHonorsWeights(t *testing.T) {
+	s := &consistentHash{}
+	backends := testBackends(3, 1)
+	counts := make(map[uint64]int)
+	for i := 0; i < 4000; i++ {
+		counts[s.PickKey(fmt.Sprintf("key-%d", i), backends).ID]++
+	}
+	if counts[1] < 2800 || counts[1] > 3200 {
+		t.Fatalf("weight 3 backend owns %d of 4000 keys, want about 3000", counts[1])
+	}
+}
+
+func TestConsistentHashSpillsOverWhenLoaded(t *testing.T) {
+	s := &consistentHash{}
+	backends := testBackends(1, 1, 1)
+	owner := s.PickKey("hot", backends)
+	for i := 0; i < 10; i++ {
+		owner.begin()
+	}
+	if got := s.PickKey("hot", backends); got == owner {
+		t.Fatalf("overloaded backend %d kept its key", owner.ID)
+	}
+}
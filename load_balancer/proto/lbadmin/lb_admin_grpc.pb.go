@@ -0,0 +1,369 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.20.3
+// source: proto/lb_admin.proto
+
+package lbadmin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// LBAdminClient is the client API for LBAdmin service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LBAdminClient interface {
+	// Lists the backends with their routing state and request statistics.
+	ListBackends(ctx context.Context, in *ListBackendsRequest, opts ...grpc.CallOption) (*ListBackendsResponse, error)
+	// Lists the server instances launched by the load balancer holding the
+	// membership lease, and their state.
+	ListInstances(ctx context.Context, in *ListInstancesRequest, opts ...grpc.CallOption) (*ListInstancesResponse, error)
+	// Takes a member out of the cluster and shuts it down, reporting each
+	// stage as it starts and ends. It runs on the load balancer holding the
+	// membership lease.
+	Decommission(ctx context.Context, in *DecommissionRequest, opts ...grpc.CallOption) (LBAdmin_DecommissionClient, error)
+	// Keeps a backend from new requests, or lets it take them again.
+	SetDraining(ctx context.Context, in *SetDrainingRequest, opts ...grpc.CallOption) (*SetDrainingResponse, error)
+	// Health-checks every backend now and lists the backends afterwards.
+	RecheckHealth(ctx context.Context, in *RecheckHealthRequest, opts ...grpc.CallOption) (*ListBackendsResponse, error)
+	// Changes the balancing strategy for reads.
+	SetStrategy(ctx context.Context, in *SetStrategyRequest, opts ...grpc.CallOption) (*SetStrategyResponse, error)
+	// Lists recent membership events, oldest first.
+	ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error)
+}
+
+type lBAdminClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLBAdminClient(cc grpc.ClientConnInterface) LBAdminClient {
+	return &lBAdminClient{cc}
+}
+
+func (c *lBAdminClient) ListBackends(ctx context.Context, in *ListBackendsRequest, opts ...grpc.CallOption) (*ListBackendsResponse, error) {
+	out := new(ListBackendsResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/ListBackends", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lBAdminClient) ListInstances(ctx context.Context, in *ListInstancesRequest, opts ...grpc.CallOption) (*ListInstancesResponse, error) {
+	out := new(ListInstancesResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/ListInstances", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lBAdminClient) Decommission(ctx context.Context, in *DecommissionRequest, opts ...grpc.CallOption) (LBAdmin_DecommissionClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LBAdmin_ServiceDesc.Streams[0], "/lbadmin.LBAdmin/Decommission", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &lBAdminDecommissionClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LBAdmin_DecommissionClient interface {
+	Recv() (*DecommissionStatus, error)
+	grpc.ClientStream
+}
+
+type lBAdminDecommissionClient struct {
+	grpc.ClientStream
+}
+
+func (x *lBAdminDecommissionClient) Recv() (*DecommissionStatus, error) {
+	m := new(DecommissionStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *lBAdminClient) SetDraining(ctx context.Context, in *SetDrainingRequest, opts ...grpc.CallOption) (*SetDrainingResponse, error) {
+	out := new(SetDrainingResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/SetDraining", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lBAdminClient) RecheckHealth(ctx context.Context, in *RecheckHealthRequest, opts ...grpc.CallOption) (*ListBackendsResponse, error) {
+	out := new(ListBackendsResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/RecheckHealth", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lBAdminClient) SetStrategy(ctx context.Context, in *SetStrategyRequest, opts ...grpc.CallOption) (*SetStrategyResponse, error) {
+	out := new(SetStrategyResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/SetStrategy", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *lBAdminClient) ListEvents(ctx context.Context, in *ListEventsRequest, opts ...grpc.CallOption) (*ListEventsResponse, error) {
+	out := new(ListEventsResponse)
+	err := c.cc.Invoke(ctx, "/lbadmin.LBAdmin/ListEvents", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LBAdminServer is the server API for LBAdmin service.
+// All implementations must embed UnimplementedLBAdminServer
+// for forward compatibility
+type LBAdminServer interface {
+	// Lists the backends with their routing state and request statistics.
+	ListBackends(context.Context, *ListBackendsRequest) (*ListBackendsResponse, error)
+	// Lists the server instances launched by the load balancer holding the
+	// membership lease, and their state.
+	ListInstances(context.Context, *ListInstancesRequest) (*ListInstancesResponse, error)
+	// Takes a member out of the cluster and shuts it down, reporting each
+	// stage as it starts and ends. It runs on the load balancer holding the
+	// membership lease.
+	Decommission(*DecommissionRequest, LBAdmin_DecommissionServer) error
+	// Keeps a backend from new requests, or lets it take them again.
+	SetDraining(context.Context, *SetDrainingRequest) (*SetDrainingResponse, error)
+	// Health-checks every backend now and lists the backends afterwards.
+	RecheckHealth(context.Context, *RecheckHealthRequest) (*ListBackendsResponse, error)
+	// Changes the balancing strategy for reads.
+	SetStrategy(context.Context, *SetStrategyRequest) (*SetStrategyResponse, error)
+	// Lists recent membership events, oldest first.
+	ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error)
+	mustEmbedUnimplementedLBAdminServer()
+}
+
+// UnimplementedLBAdminServer must be embedded to have forward compatible implementations.
+type UnimplementedLBAdminServer struct {
+}
+
+func (UnimplementedLBAdminServer) ListBackends(context.Context, *ListBackendsRequest) (*ListBackendsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListBackends not implemented")
+}
+func (UnimplementedLBAdminServer) ListInstances(context.Context, *ListInstancesRequest) (*ListInstancesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListInstances not implemented")
+}
+func (UnimplementedLBAdminServer) Decommission(*DecommissionRequest, LBAdmin_DecommissionServer) error {
+	return status.Errorf(codes.Unimplemented, "method Decommission not implemented")
+}
+func (UnimplementedLBAdminServer) SetDraining(context.Context, *SetDrainingRequest) (*SetDrainingResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetDraining not implemented")
+}
+func (UnimplementedLBAdminServer) RecheckHealth(context.Context, *RecheckHealthRequest) (*ListBackendsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RecheckHealth not implemented")
+}
+func (UnimplementedLBAdminServer) SetStrategy(context.Context, *SetStrategyRequest) (*SetStrategyResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetStrategy not implemented")
+}
+func (UnimplementedLBAdminServer) ListEvents(context.Context, *ListEventsRequest) (*ListEventsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListEvents not implemented")
+}
+func (UnimplementedLBAdminServer) mustEmbedUnimplementedLBAdminServer() {}
+
+// UnsafeLBAdminServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LBAdminServer will
+// result in compilation errors.
+type UnsafeLBAdminServer interface {
+	mustEmbedUnimplementedLBAdminServer()
+}
+
+func RegisterLBAdminServer(s grpc.ServiceRegistrar, srv LBAdminServer) {
+	s.RegisterService(&LBAdmin_ServiceDesc, srv)
+}
+
+func _LBAdmin_ListBackends_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListBackendsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).ListBackends(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/ListBackends",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).ListBackends(ctx, req.(*ListBackendsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LBAdmin_ListInstances_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListInstancesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).ListInstances(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/ListInstances",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).ListInstances(ctx, req.(*ListInstancesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LBAdmin_Decommission_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(DecommissionRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LBAdminServer).Decommission(m, &lBAdminDecommissionServer{stream})
+}
+
+type LBAdmin_DecommissionServer interface {
+	Send(*DecommissionStatus) error
+	grpc.ServerStream
+}
+
+type lBAdminDecommissionServer struct {
+	grpc.ServerStream
+}
+
+func (x *lBAdminDecommissionServer) Send(m *DecommissionStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _LBAdmin_SetDraining_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetDrainingRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).SetDraining(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/SetDraining",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).SetDraining(ctx, req.(*SetDrainingRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LBAdmin_RecheckHealth_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RecheckHealthRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).RecheckHealth(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/RecheckHealth",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).RecheckHealth(ctx, req.(*RecheckHealthRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LBAdmin_SetStrategy_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetStrategyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).SetStrategy(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/SetStrategy",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).SetStrategy(ctx, req.(*SetStrategyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LBAdmin_ListEvents_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListEventsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LBAdminServer).ListEvents(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/lbadmin.LBAdmin/ListEvents",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LBAdminServer).ListEvents(ctx, req.(*ListEventsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// LBAdmin_ServiceDesc is the grpc.ServiceDesc for LBAdmin service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LBAdmin_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "lbadmin.LBAdmin",
+	HandlerType: (*LBAdminServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListBackends",
+			Handler:    _LBAdmin_ListBackends_Handler,
+		},
+		{
+			MethodName: "ListInstances",
+			Handler:    _LBAdmin_ListInstances_Handler,
+		},
+		{
+			MethodName: "SetDraining",
+			Handler:    _LBAdmin_SetDraining_Handler,
+		},
+		{
+			MethodName: "RecheckHealth",
+			Handler:    _LBAdmin_RecheckHealth_Handler,
+		},
+		{
+			MethodName: "SetStrategy",
+			Handler:    _LBAdmin_SetStrategy_Handler,
+		},
+		{
+			MethodName: "ListEvents",
+			Handler:    _LBAdmin_ListEvents_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Decommission",
+			Handler:       _LBAdmin_Decommission_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "proto/lb_admin.proto",
+}
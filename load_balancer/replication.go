@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"load_balancer/consts"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	"load_balancer/utils"
+	"log"
+	"sync"
+	"time"
+)
+
+// forceLeaves decommissions each address received on forceLeaveC in its
+// own goroutine, so a decommission, which can take minutes, neither stalls
+// the health checks that report dead members nor holds up other removals.
+// Health checks report a dead member on every pass until it is removed, so
+// an address already being decommissioned is skipped.
+func forceLeaves(forceLeaveC <-chan string, leave func(address string)) {
+	var mu sync.Mutex
+	leaving := make(map[string]bool)
+	for address := range forceLeaveC {
+		mu.Lock()
+		busy := leaving[address]
+		leaving[address] = true
+		mu.Unlock()
+		if busy {
+			continue
+		}
+		go func(address string) {
+			defer func() {
+				mu.Lock()
+				delete(leaving, address)
+				mu.Unlock()
+			}()
+			leave(address)
+		}(address)
+	}
+}
+
+// replaceMember restores the replication factor after the member with the
+// given ID and address was force-removed. It adds a new instance through the
+// normal Start path as a learner, waits for it to catch up with the leader
+// and promotes it.
+func replaceMember(id uint64, address string) {
+	clusterEvents.Record(models.EventForceRemoved, id, address, "failed its health checks")
+	if replicationFactor <= 0 || replicationMet() {
+		return
+	}
+
+	// The removal was applied before Leave returned; raft would drop a conf
+	// change proposed while another is pending.
+	ctx, cancel := context.WithTimeout(context.Background(), catchUpTimeout)
+	defer cancel()
+	newId, err := allocateID(ctx)
+	if err != nil {
+		clusterEvents.Record(models.EventFailed, id, address, fmt.Sprintf("no ID for a replacement: %v", err))
+		return
+	}
+	newAddress := utils.GenKVAddr(newId)
+	clusterEvents.Record(models.EventProvisioning, newId, newAddress, fmt.Sprintf("replacing member %d as a learner", id))
+	if err := startNewInstance(ctx, newId, newAddress, true); err != nil {
+		abandonReplacement(newId, newAddress, err)
+		return
+	}
+	if err := waitForRegistry(ctx, func(members []*pb.Member) bool { return registered(members, newId) != nil }); err != nil {
+		abandonReplacement(newId, newAddress, fmt.Errorf("learner never registered: %v", err))
+		return
+	}
+	clusterEvents.Record(models.EventStarted, newId, newAddress, "learner instance launched")
+
+	resp, err := promoteWhenCaughtUp(ctx, newId)
+	if err != nil {
+		abandonReplacement(newId, newAddress, err)
+		return
+	}
+	clusterEvents.Record(models.EventCaughtUp, newId, newAddress, fmt.Sprintf("replicated %d of %d entries", resp.MatchIndex, resp.CommitIndex))
+	serverPool.AddServer(newId, newAddress)
+	clusterEvents.Record(models.EventPromoted, newId, newAddress, "voter, serving clients")
+	replicationMet()
+}
+
+// replicationMet records an event and returns true if the pool has at least
+// replicationFactor members.
+func replicationMet() bool {
+	members := len(serverPool.Backends())
+	if members < replicationFactor {
+		return false
+	}
+	clusterEvents.Record(models.EventReplicationMet, 0, "", fmt.Sprintf("%d members, target %d", members, replicationFactor))
+	return true
+}
+
+// waitForRegistry reads the member registry until done accepts it or ctx
+// is done.
+func waitForRegistry(ctx context.Context, done func([]*pb.Member) bool) error {
+	for {
+		if client := serverPool.LeaderClient(); client != nil {
+			if members, err := readRegistry(ctx, client); err == nil && done(members) {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(consts.CatchUpPollInterval):
+		}
+	}
+}
+
+// readRegistry returns the member registry as the backend sees it now.
+func readRegistry(ctx context.Context, client pb.KVStoreServiceClient) ([]*pb.Member, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Members(ctx, &pb.MembersRequest{})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Members, nil
+}
+
+func registered(members []*pb.Member, id uint64) *pb.Member {
+	for _, m := range members {
+		if m.Id == id {
+			return m
+		}
+	}
+	return nil
+}
+
+// promoteWhenCaughtUp asks the leader to promote learner id until it has
+// caught up or ctx is done.
+func promoteWhenCaughtUp(ctx context.Context, id uint64) (*pb.PromoteResponse, error) {
+	for {
+		resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.PromoteResponse, error) {
+			return client.Promote(ctx, &pb.PromoteRequest{Id: id})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to promote: %v", err)
+		}
+		switch resp.Status {
+		case consts.Success:
+			return resp, nil
+		case consts.NotCaughtUp:
+			log.Printf("Learner %d has replicated %d of %d entries\n", id, resp.MatchIndex, resp.CommitIndex)
+		default:
+			return nil, fmt.Errorf("failed to promote: status %d: %s", resp.Status, resp.Error)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("learner did not catch up: %v", ctx.Err())
+		case <-time.After(consts.CatchUpPollInterval):
+		}
+	}
+}
+
+// abandonReplacement removes a replacement that could not be promoted from
+// the cluster and stops its instance.
+func abandonReplacement(id uint64, address string, cause error) {
+	clusterEvents.Record(models.EventFailed, id, address, cause.Error())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := callLeader(ctx, func(client pb.KVStoreServiceClient) (*pb.LeaveResponse, error) {
+		return client.Leave(ctx, &pb.LeaveRequest{ServerName: address, Id: id})
+	})
+	if err != nil || resp.Status != consts.Success {
+		log.Printf("Failed to remove replacement %d from the cluster: %v\n", id, err)
+	}
+	instanceLauncher.Stop(id)
+}
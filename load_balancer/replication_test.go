@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestForceLeavesSkipsAddressBeingDecommissioned(t *testing.T) {
+	forceLeaveC := make(chan string)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	go forceLeaves(forceLeaveC, func(address string) {
+		mu.Lock()
+		calls[address]++
+		mu.Unlock()
+		<-release
+	})
+	count := func(address string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[address]
+	}
+
+	// Every send is received at once, though each leave is still running.
+	for i := 0; i < 3; i++ {
+		select {
+		case forceLeaveC <- "a":
+		case <-time.After(time.Second):
+			t.Fatal("forced leave of a not received while one is running")
+		}
+	}
+	forceLeaveC <- "b"
+	for deadline := time.Now().Add(time.Second); count("a") != 1 || count("b") != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("leaves of a, b = %d, %d; want 1 each", count("a"), count("b"))
+		}
+	}
+
+	// Once done, a member reported again is decommissioned again.
+	close(release)
+	for deadline := time.Now().Add(time.Second); count("a") < 2; time.Sleep(5 * time.Millisecond) {
+		forceLeaveC <- "a"
+		if time.Now().After(deadline) {
+			t.Fatalf("leaves of a = %d after the first finished, want another", count("a"))
+		}
+	}
+	close(forceLeaveC)
+}
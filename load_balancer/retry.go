@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errUnavailable is returned when no backend can take a request.
+var errUnavailable = status.Error(codes.Unavailable, "no healthy backends")
+
+// RetryPolicy controls how reads are retried and hedged.
+type RetryPolicy struct {
+	MaxAttempts int           // attempts per read, counting the first
+	Backoff     time.Duration // wait before the first retry, doubling after each
+	MaxBackoff  time.Duration
+	// HedgeQuantile, if above 0, sends a second read to another backend once
+	// the first has taken longer than this quantile of recent read latency.
+	HedgeQuantile float64
+}
+
+var (
+	getPolicy    RetryPolicy
+	getLatencies *models.LatencyTracker
+)
+
+// getWithRetries reads through one backend at a time, hedged, and retries
+// failed reads on other backends. Reads have no side effects, so any error
+// is retried while the caller's deadline leaves room for the backoff.
+func getWithRetries(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	var tried []uint64
+	backoff := getPolicy.Backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := hedgedGet(ctx, req, &tried)
+		if err == nil || err == errUnavailable || ctx.Err() != nil || attempt >= getPolicy.MaxAttempts {
+			return resp, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			return resp, err
+		}
+		log.Printf("Retrying get for key %s after attempt %d failed: %v\n", req.Key, attempt, err)
+		select {
+		case <-ctx.Done():
+			return resp, err
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, getPolicy.MaxBackoff)
+	}
+}
+
+// hedgedGet sends the read to one backend and, if it is slower than the
+// hedge delay, to a second one, returning the first successful response.
+// Backends used are added to tried.
+func hedgedGet(ctx context.Context, req *pb.GetRequest, tried *[]uint64) (*pb.GetResponse, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // abandons the slower read
+
+	type result struct {
+		resp *pb.GetResponse
+		err  error
+	}
+	results := make(chan result, 2)
+	send := func(hedge bool) bool {
+		id, client, ok := serverPool.Pick(req.Key, *tried)
+		if !ok || (hedge && slices.Contains(*tried, id)) {
+			return false
+		}
+		*tried = append(*tried, id)
+		go func() {
+			start := time.Now()
+			resp, err := client.Get(ctx, req)
+			if err == nil {
+				getLatencies.Observe(time.Since(start))
+			}
+			results <- result{resp, err}
+		}()
+		return true
+	}
+
+	if !send(false) {
+		return nil, errUnavailable
+	}
+	outstanding := 1
+	var hedge <-chan time.Time
+	if delay, ok := getLatencies.Percentile(); ok && getPolicy.HedgeQuantile > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		hedge = timer.C
+	}
+
+	var last result
+	for outstanding > 0 {
+		select {
+		case <-hedge:
+			hedge = nil
+			if send(true) {
+				outstanding++
+			}
+		case r := <-results:
+			outstanding--
+			if r.err == nil {
+				return r.resp, nil
+			}
+			last = r
+		}
+	}
+	return last.resp, last.err
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"load_balancer/consts"
+	"load_balancer/models"
+	pb "load_balancer/proto/kv739"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// setGetPolicy replaces the read policy for the test. If hedgeAfter is above
+// 0, the latency tracker already reports it as the hedge delay.
+func setGetPolicy(t *testing.T, policy RetryPolicy, hedgeAfter time.Duration) {
+	oldPolicy, oldLatencies := getPolicy, getLatencies
+	t.Cleanup(func() { getPolicy, getLatencies = oldPolicy, oldLatencies })
+	getPolicy = policy
+	getLatencies = models.NewLatencyTracker(policy.HedgeQuantile)
+	for i := 0; hedgeAfter > 0 && i < 64; i++ {
+		getLatencies.Observe(hedgeAfter)
+	}
+}
+
+func TestGetRetriesOtherBackends(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, 0)
+	failed := status.Error(codes.Internal, "disk error")
+	f.getErr[f.addresses[0]] = failed
+	f.getErr[f.addresses[1]] = failed
+
+	resp, err := (&server{}).Get(context.Background(), &pb.GetRequest{Key: "k"})
+	if err != nil || resp.Value != f.addresses[2] {
+		t.Fatalf("Get = %v, %v; want the read from the healthy backend", resp, err)
+	}
+	for _, address := range f.addresses {
+		if n := f.count(address, "get"); n > 1 {
+			t.Fatalf("%s was read %d times, want each backend tried once", address, n)
+		}
+	}
+}
+
+func TestGetStopsAtRetryBudget(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, 0)
+	failed := status.Error(codes.Internal, "disk error")
+	for _, address := range f.addresses {
+		f.getErr[address] = failed
+	}
+	s := &server{}
+
+	_, err := s.Get(context.Background(), &pb.GetRequest{Key: "k"})
+	if status.Code(err) != codes.Internal {
+		t.Fatalf("Get = %v, want the last backend's error", err)
+	}
+	if got := f.total("get"); got != 2 {
+		t.Fatalf("reads sent = %d, want 2", got)
+	}
+
+	// A deadline too close for the backoff ends the retries early.
+	getPolicy.Backoff = time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := s.Get(ctx, &pb.GetRequest{Key: "k"}); status.Code(err) != codes.Internal {
+		t.Fatalf("Get near the deadline = %v, want the first backend's error", err)
+	}
+	if got := f.total("get"); got != 3 {
+		t.Fatalf("reads sent = %d, want 1 more", got)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("Get took %v, want it to give up without waiting", elapsed)
+	}
+}
+
+func TestGetHedgesSlowRead(t *testing.T) {
+	f := newFakeCluster(t, 2)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 1, HedgeQuantile: 0.95}, 5*time.Millisecond)
+	f.firstGet = 10 * time.Second
+
+	start := time.Now()
+	resp, err := (&server{}).Get(context.Background(), &pb.GetRequest{Key: "k"})
+	if err != nil || resp.Status != consts.Success {
+		t.Fatalf("Get = %v, %v; want the hedged read", resp, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Get took %v, want the hedge to answer", elapsed)
+	}
+	if got := f.total("get"); got != 2 {
+		t.Fatalf("reads sent = %d, want the first and its hedge", got)
+	}
+	// The slow read is abandoned once the hedge answers.
+	for deadline := time.Now().Add(time.Second); f.abandoned() != 1; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("abandoned reads = %d, want the slow one cancelled", f.abandoned())
+		}
+	}
+}
+
+func TestGetWithoutHedgeDelayWaits(t *testing.T) {
+	f := newFakeCluster(t, 2)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 1, HedgeQuantile: 0.95}, 0)
+	f.firstGet = 50 * time.Millisecond
+
+	if _, err := (&server{}).Get(context.Background(), &pb.GetRequest{Key: "k"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.total("get"); got != 1 {
+		t.Fatalf("reads sent = %d, want no hedge before latencies are known", got)
+	}
+}
+
+func TestGetCancelledByCaller(t *testing.T) {
+	f := newFakeCluster(t, 2)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, MaxBackoff: time.Millisecond}, 0)
+	f.firstGet = 10 * time.Second
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := (&server{}).Get(ctx, &pb.GetRequest{Key: "k"}); status.Code(err) != codes.Canceled {
+		t.Fatalf("Get = %v, want Canceled", err)
+	}
+	if got := f.total("get"); got != 1 {
+		t.Fatalf("reads sent = %d, want no retry after the caller cancelled", got)
+	}
+}
+
+func TestWritesAreNotHedged(t *testing.T) {
+	f := newFakeCluster(t, 3)
+	setGetPolicy(t, RetryPolicy{MaxAttempts: 3, HedgeQuantile: 0.95}, time.Millisecond)
+	f.writeDelay = 100 * time.Millisecond
+	serverPool.SetLeader(1)
+	s := &server{}
+
+	if resp, err := s.Put(context.Background(), &pb.PutRequest{Key: "k", Value: "v"}); err != nil || resp.Status != consts.Success {
+		t.Fatalf("Put = %v, %v; want success", resp, err)
+	}
+	if got := f.total("put"); got != 1 {
+		t.Fatalf("puts sent = %d, want 1 however slow the leader", got)
+	}
+}
@@ -8,3 +8,7 @@ import (
 func GenRaftAddr(id uint64) string {
 	return fmt.Sprintf("http://127.0.0.1:%d", consts.RaftPortBase+id-1)
 }
+
+func GenKVAddr(id uint64) string {
+	return fmt.Sprintf("localhost:%d", consts.KVPortBase+id-1)
+}
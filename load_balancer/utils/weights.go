@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParseWeights parses "id=weight" pairs separated by commas.
+func ParseWeights(text string) (map[uint64]int, error) {
+	weights := make(map[uint64]int)
+	for _, pair := range strings.Split(text, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		idText, weightText, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid weight %q, want id=weight", pair)
+		}
+		id, err := strconv.ParseUint(idText, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid backend ID %q", idText)
+		}
+		weight, err := strconv.Atoi(weightText)
+		if err != nil || weight < 1 {
+			return nil, fmt.Errorf("invalid weight %q for backend %d", weightText, id)
+		}
+		weights[id] = weight
+	}
+	return weights, nil
+}
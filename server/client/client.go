@@ -0,0 +1,367 @@
+// Package client is a Go client for the key-value store that talks to the
+// servers directly, without the load balancer. It keeps a connection to every
+// server, sends writes to the leader, which it learns from Redirect responses
+// and caches, and spreads reads over all servers.
+//
+//	c, err := client.NewFromFile("config/kv_server_list", client.Options{})
+//	old, found, err := c.Put(ctx, "k", "v")
+//	value, err := c.Get(ctx, "k") // errors.Is(err, client.ErrNotFound) if missing
+package client
+
+import (
+	"bufio"
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	defaultTimeout  = 2 * time.Second
+	defaultAttempts = 5
+	defaultBackoff  = 100 * time.Millisecond
+)
+
+// Options configures a Client. Zero fields take their defaults.
+type Options struct {
+	// Timeout bounds each attempt; the caller's context bounds the whole
+	// operation. Defaults to 2s.
+	Timeout time.Duration
+	// Attempts is how many requests an operation sends, following redirects
+	// and retrying other servers, before it gives up. Defaults to 5.
+	Attempts int
+	// Backoff is the wait before retrying after a failed attempt. Defaults
+	// to 100ms.
+	Backoff time.Duration
+	// DialOptions are used for every connection. Defaults to insecure
+	// credentials.
+	DialOptions []grpc.DialOption
+}
+
+// CASResult is the outcome of a compare-and-swap.
+type CASResult struct {
+	Swapped bool
+	Value   string // the value afterwards
+	Found   bool   // whether the key exists afterwards
+}
+
+// Client is safe for concurrent use.
+type Client struct {
+	opts Options
+
+	mu        sync.Mutex
+	addresses []string // servers in the order reads go round
+	conns     map[string]*grpc.ClientConn
+	leader    string // "" while unknown
+	next      int    // index of the server the next read starts at
+	closed    bool
+}
+
+// New connects to every server in addresses.
+func New(addresses []string, opts Options) (*Client, error) {
+	if len(addresses) == 0 {
+		return nil, errors.New("no servers")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.Attempts <= 0 {
+		opts.Attempts = defaultAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaultBackoff
+	}
+	if len(opts.DialOptions) == 0 {
+		opts.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	c := &Client{opts: opts, conns: make(map[string]*grpc.ClientConn)}
+	for _, address := range addresses {
+		if _, err := c.dial(address); err != nil {
+			c.Close()
+			return nil, fmt.Errorf("dial %s: %w", address, err)
+		}
+	}
+	return c, nil
+}
+
+// NewFromFile connects to the servers listed in the file at path, as read
+// by ReadServerList.
+func NewFromFile(path string, opts Options) (*Client, error) {
+	addresses, err := ReadServerList(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(addresses, opts)
+}
+
+// ReadServerList reads a server list: one server per line, either as
+// "host:port" or as "id host:port" like the server configs. Blank lines and
+// lines starting with '#' are skipped.
+func ReadServerList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var addresses []string
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 1:
+			addresses = append(addresses, fields[0])
+		case 2:
+			addresses = append(addresses, fields[1])
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid line %q", path, lineNo, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("%s: no servers", path)
+	}
+	return addresses, nil
+}
+
+// Close closes every connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	var firstErr error
+	for address, conn := range c.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(c.conns, address)
+	}
+	return firstErr
+}
+
+// Leader returns the cached leader, or "" if it is not known.
+func (c *Client) Leader() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.leader
+}
+
+// Get returns the value of key, or ErrNotFound. Any server answers, so the
+// value may lag the latest write; a server that cannot be reached is retried
+// on the next one.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	var resp *pb.GetResponse
+	err := c.do(ctx, "get", false, true, func(ctx context.Context, kv pb.KVStoreServiceClient) (int32, string, error) {
+		var err error
+		resp, err = kv.Get(ctx, &pb.GetRequest{Key: key})
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.Status, "", nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// Put sets key to value and returns the value it replaced, if any. Setting a
+// key is idempotent, so Put is retried when the leader cannot be reached; if
+// an earlier attempt was applied, the returned old value is value itself.
+func (c *Client) Put(ctx context.Context, key, value string) (old string, found bool, err error) {
+	var resp *pb.PutResponse
+	err = c.do(ctx, "put", true, true, func(ctx context.Context, kv pb.KVStoreServiceClient) (int32, string, error) {
+		var err error
+		resp, err = kv.Put(ctx, &pb.PutRequest{Key: key, Value: value})
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.Status, resp.LeaderAddress, nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		// Put reports a key it created as not found.
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return resp.OldValue, true, nil
+}
+
+// Delete removes key and returns the value it had, or ErrNotFound. It is
+// not retried once a request may have reached the leader, as a retry would
+// report a deleted key as not found.
+func (c *Client) Delete(ctx context.Context, key string) (string, error) {
+	var resp *pb.DeleteResponse
+	err := c.do(ctx, "delete", true, false, func(ctx context.Context, kv pb.KVStoreServiceClient) (int32, string, error) {
+		var err error
+		resp, err = kv.Delete(ctx, &pb.DeleteRequest{Key: key})
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.Status, resp.LeaderAddress, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.OldValue, nil
+}
+
+// CompareAndSwap sets key to value if it holds expected, or if it is missing
+// and expectMissing is set. Like Delete, it is not retried once a request may
+// have reached the leader.
+func (c *Client) CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (CASResult, error) {
+	var resp *pb.CompareAndSwapResponse
+	err := c.do(ctx, "compare-and-swap", true, false, func(ctx context.Context, kv pb.KVStoreServiceClient) (int32, string, error) {
+		var err error
+		resp, err = kv.CompareAndSwap(ctx, &pb.CompareAndSwapRequest{Key: key, Expected: expected, ExpectMissing: expectMissing, Value: value})
+		if err != nil {
+			return 0, "", err
+		}
+		return resp.Status, resp.LeaderAddress, nil
+	})
+	if err != nil {
+		return CASResult{}, err
+	}
+	return CASResult{Swapped: resp.Swapped, Value: resp.CurrentValue, Found: resp.Found}, nil
+}
+
+// call sends one request to kv and returns the status and, with a Redirect,
+// the leader's address.
+type call func(ctx context.Context, kv pb.KVStoreServiceClient) (status int32, leader string, err error)
+
+// do runs fn against the leader if write is set, and otherwise against the
+// servers in turn. Redirects are followed for every operation; retry allows
+// another attempt after a request failed in transit.
+func (c *Client) do(ctx context.Context, op string, write, retry bool, fn call) error {
+	var lastErr error
+	for attempt := 0; attempt < c.opts.Attempts; attempt++ {
+		if attempt > 0 && lastErr != nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(c.opts.Backoff):
+			}
+		}
+		address, kv, err := c.pick(write)
+		if err != nil {
+			return err
+		}
+
+		attemptCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		status, leader, err := fn(attemptCtx, kv)
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.unreachable(address)
+			if !retry {
+				return fmt.Errorf("%s on %s: %w", op, address, err)
+			}
+			lastErr = fmt.Errorf("%w: %s on %s: %v", ErrUnavailable, op, address, err)
+			continue
+		}
+		if write && status != consts.Redirect {
+			// Only the leader answers writes.
+			c.setLeader(address)
+		}
+
+		switch status {
+		case consts.Success:
+			return nil
+		case consts.KeyNotFound:
+			return ErrNotFound
+		case consts.NoSpace:
+			return ErrNoSpace
+		case consts.Redirect:
+			if leader == "" || leader == address {
+				// An election is under way; ask another server after a pause.
+				c.unreachable(address)
+				lastErr = ErrNoLeader
+				continue
+			}
+			c.setLeader(leader)
+			lastErr = nil
+			continue
+		default:
+			return &StatusError{Op: op, Server: address, Status: status}
+		}
+	}
+	if lastErr == nil {
+		lastErr = ErrNoLeader
+	}
+	return lastErr
+}
+
+// pick returns the server the next attempt goes to: the cached leader for a
+// write, if known, and otherwise the next server in turn.
+func (c *Client) pick(write bool) (string, pb.KVStoreServiceClient, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return "", nil, ErrClosed
+	}
+	address := c.leader
+	if !write || address == "" {
+		address = c.addresses[c.next%len(c.addresses)]
+		c.next++
+	}
+	conn, err := c.dialLocked(address)
+	if err != nil {
+		return "", nil, err
+	}
+	return address, pb.NewKVStoreServiceClient(conn), nil
+}
+
+// setLeader caches address as the leader. A leader missing from the server
+// list, such as a member added since, joins it when pick first dials it.
+func (c *Client) setLeader(address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.leader = address
+}
+
+// unreachable forgets address as the leader after it failed a request.
+func (c *Client) unreachable(address string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.leader == address {
+		c.leader = ""
+	}
+}
+
+func (c *Client) dial(address string) (*grpc.ClientConn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dialLocked(address)
+}
+
+// dialLocked returns the connection to address, making it if needed. Dialing
+// does not wait for the server, which may come up later.
+func (c *Client) dialLocked(address string) (*grpc.ClientConn, error) {
+	if conn, ok := c.conns[address]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(address, c.opts.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[address] = conn
+	c.addresses = append(c.addresses, address)
+	return conn, nil
+}
@@ -0,0 +1,266 @@
+package client
+
+import (
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeCluster serves fake key-value servers over in-memory listeners. One of
+// them leads: the others redirect writes to it.
+type fakeCluster struct {
+	mu        sync.Mutex
+	data      map[string]string
+	leader    string
+	listeners map[string]*bufconn.Listener
+	servers   map[string]*grpc.Server
+	writes    map[string]int // write requests per server
+}
+
+func newFakeCluster(t *testing.T, addresses ...string) *fakeCluster {
+	f := &fakeCluster{
+		data:      make(map[string]string),
+		leader:    addresses[0],
+		listeners: make(map[string]*bufconn.Listener),
+		servers:   make(map[string]*grpc.Server),
+		writes:    make(map[string]int),
+	}
+	for _, address := range addresses {
+		listener := bufconn.Listen(1 << 20)
+		server := grpc.NewServer()
+		pb.RegisterKVStoreServiceServer(server, &fakeServer{cluster: f, address: address})
+		go server.Serve(listener)
+		f.listeners[address] = listener
+		f.servers[address] = server
+		t.Cleanup(server.Stop)
+	}
+	return f
+}
+
+func (f *fakeCluster) options() Options {
+	dialer := func(ctx context.Context, address string) (net.Conn, error) {
+		f.mu.Lock()
+		listener, ok := f.listeners[address]
+		f.mu.Unlock()
+		if !ok {
+			return nil, errors.New("unknown server " + address)
+		}
+		return listener.DialContext(ctx)
+	}
+	return Options{
+		Timeout: time.Second,
+		Backoff: time.Millisecond,
+		DialOptions: []grpc.DialOption{
+			grpc.WithContextDialer(dialer),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		},
+	}
+}
+
+func (f *fakeCluster) stop(address string) {
+	f.servers[address].Stop()
+}
+
+// redirect counts a write to address and returns the leader to redirect it
+// to, or "" if address leads.
+func (f *fakeCluster) redirect(address string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes[address]++
+	if f.leader == address {
+		return ""
+	}
+	return f.leader
+}
+
+type fakeServer struct {
+	pb.UnimplementedKVStoreServiceServer
+	cluster *fakeCluster
+	address string
+}
+
+func (s *fakeServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	if req.Key == "\x00reserved" {
+		return &pb.GetResponse{Status: consts.InternalError}, nil
+	}
+	value, ok := s.cluster.data[req.Key]
+	if !ok {
+		return &pb.GetResponse{Status: consts.KeyNotFound}, nil
+	}
+	return &pb.GetResponse{Status: consts.Success, Value: value}, nil
+}
+
+func (s *fakeServer) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	if leader := s.cluster.redirect(s.address); leader != "" {
+		return &pb.PutResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	if req.Key == "full" {
+		return &pb.PutResponse{Status: consts.NoSpace}, nil
+	}
+	old, ok := s.cluster.data[req.Key]
+	s.cluster.data[req.Key] = req.Value
+	if !ok {
+		return &pb.PutResponse{Status: consts.KeyNotFound}, nil
+	}
+	return &pb.PutResponse{Status: consts.Success, OldValue: old}, nil
+}
+
+func (s *fakeServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	if leader := s.cluster.redirect(s.address); leader != "" {
+		return &pb.DeleteResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	old, ok := s.cluster.data[req.Key]
+	if !ok {
+		return &pb.DeleteResponse{Status: consts.KeyNotFound}, nil
+	}
+	delete(s.cluster.data, req.Key)
+	return &pb.DeleteResponse{Status: consts.Success, OldValue: old}, nil
+}
+
+func (s *fakeServer) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.CompareAndSwapResponse, error) {
+	if leader := s.cluster.redirect(s.address); leader != "" {
+		return &pb.CompareAndSwapResponse{Status: consts.Redirect, LeaderAddress: leader}, nil
+	}
+	s.cluster.mu.Lock()
+	defer s.cluster.mu.Unlock()
+	old, ok := s.cluster.data[req.Key]
+	if (ok && old == req.Expected) || (!ok && req.ExpectMissing) {
+		s.cluster.data[req.Key] = req.Value
+		return &pb.CompareAndSwapResponse{Status: consts.Success, Swapped: true, CurrentValue: req.Value, Found: true}, nil
+	}
+	return &pb.CompareAndSwapResponse{Status: consts.Success, CurrentValue: old, Found: ok}, nil
+}
+
+func TestClientFollowsAndCachesLeader(t *testing.T) {
+	f := newFakeCluster(t, "a", "b", "c")
+	f.leader = "c"
+	c, err := New([]string{"a", "b"}, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if old, found, err := c.Put(ctx, "k", "v1"); err != nil || found || old != "" {
+		t.Fatalf("Put of a new key = %q, %v, %v; want not found", old, found, err)
+	}
+	if c.Leader() != "c" {
+		t.Fatalf("leader = %q, want c, which is not in the server list", c.Leader())
+	}
+	if old, found, err := c.Put(ctx, "k", "v2"); err != nil || !found || old != "v1" {
+		t.Fatalf("Put = %q, %v, %v; want old value v1", old, found, err)
+	}
+	if f.writes["a"] != 1 || f.writes["c"] != 2 {
+		t.Fatalf("writes = %v, want one redirected by a and both applied on c", f.writes)
+	}
+
+	result, err := c.CompareAndSwap(ctx, "k", "v2", false, "v3")
+	if err != nil || !result.Swapped || result.Value != "v3" {
+		t.Fatalf("CompareAndSwap = %+v, %v; want swapped to v3", result, err)
+	}
+	if old, err := c.Delete(ctx, "k"); err != nil || old != "v3" {
+		t.Fatalf("Delete = %q, %v; want v3", old, err)
+	}
+
+	// Leadership moves; the old leader redirects to the new one.
+	f.mu.Lock()
+	f.leader = "b"
+	f.mu.Unlock()
+	if _, _, err := c.Put(ctx, "k", "v4"); err != nil {
+		t.Fatal(err)
+	}
+	if c.Leader() != "b" {
+		t.Fatalf("leader = %q, want b", c.Leader())
+	}
+}
+
+func TestClientTypedErrors(t *testing.T) {
+	f := newFakeCluster(t, "a")
+	c, err := New([]string{"a"}, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing key: %v, want ErrNotFound", err)
+	}
+	if _, err := c.Delete(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Delete of a missing key: %v, want ErrNotFound", err)
+	}
+	if c.Leader() != "a" {
+		t.Fatalf("leader = %q, want a, which answered a write", c.Leader())
+	}
+	if _, _, err := c.Put(ctx, "full", "v"); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("Put without space: %v, want ErrNoSpace", err)
+	}
+	var statusErr *StatusError
+	if _, err := c.Get(ctx, "\x00reserved"); !errors.As(err, &statusErr) || statusErr.Status != consts.InternalError {
+		t.Fatalf("Get of a reserved key: %v, want a StatusError with InternalError", err)
+	}
+}
+
+func TestClientRetriesOtherServers(t *testing.T) {
+	f := newFakeCluster(t, "a", "b")
+	f.leader = "b"
+	c, err := New([]string{"a", "b"}, f.options())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+	if _, _, err := c.Put(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+
+	f.stop("a")
+	for i := 0; i < 4; i++ {
+		if value, err := c.Get(ctx, "k"); err != nil || value != "v" {
+			t.Fatalf("Get %d = %q, %v; want v from b", i, value, err)
+		}
+	}
+
+	// Without a leader to reach, writes give up once attempts run out.
+	f.stop("b")
+	_, _, err = c.Put(ctx, "k", "w")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Put with every server down: %v, want ErrUnavailable", err)
+	}
+	if _, err := c.Delete(ctx, "k"); err == nil || errors.Is(err, ErrUnavailable) {
+		t.Fatalf("Delete with every server down: %v, want the first attempt's error", err)
+	}
+}
+
+func TestReadServerList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "servers")
+	list := "# load balancers\nlocalhost:8080\n\n  2 localhost:6001  \n"
+	if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+		t.Fatal(err)
+	}
+	addresses, err := ReadServerList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"localhost:8080", "localhost:6001"}; !reflect.DeepEqual(addresses, want) {
+		t.Fatalf("addresses = %v, want %v", addresses, want)
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned for a key that does not exist.
+	ErrNotFound = errors.New("key not found")
+	// ErrNoSpace is returned for writes while the cluster is out of space.
+	ErrNoSpace = errors.New("storage quota exceeded")
+	// ErrNoLeader is returned for writes when no leader could be found.
+	ErrNoLeader = errors.New("no leader")
+	// ErrUnavailable is returned when no server could be reached.
+	ErrUnavailable = errors.New("no server available")
+	// ErrClosed is returned after Close.
+	ErrClosed = errors.New("client closed")
+)
+
+// StatusError is a status a server answered with that has no error of its
+// own, such as InternalError for a reserved key.
+type StatusError struct {
+	Op     string
+	Server string
+	Status int32
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s on %s: status %d", e.Op, e.Server, e.Status)
+}
@@ -0,0 +1,320 @@
+// Command backup saves a consistent backup of a running node, and seeds the
+// storage of a brand-new cluster from one.
+//
+//	backup save -addr localhost:50051 -o kv739.backup
+//	backup restore -i kv739.backup -id 1 -members 1,2,3
+//
+// restore runs once per member of the new cluster, from that member's
+// working directory, before the member is first started. Membership is
+// rewritten to -members and the old cluster's member registry is dropped
+// from the data, so the new cluster never contacts or redirects to the old
+// peers; their addresses come from the new cluster's config as usual.
+// Encrypted backups need the keys the old cluster used.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"cs739-kv-store/consts"
+	"cs739-kv-store/models"
+	pb "cs739-kv-store/proto/kv739"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// backupFile is the on-disk backup format.
+type backupFile struct {
+	AppliedIndex uint64
+	Term         uint64
+	Voters       []uint64 // membership of the cluster the backup was taken from
+	Learners     []uint64
+	Checksum     string // hex SHA-256 of Data
+	Data         []byte // snapshot payload, as produced by the storage engine
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "save":
+		err = runSave(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s save|restore [flags]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func runSave(args []string) error {
+	fs := flag.NewFlagSet("save", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:50051", "KV address of the node to back up")
+	out := fs.String("o", "kv739.backup", "Backup file to write")
+	timeout := fs.Duration("timeout", time.Minute, "Deadline for the whole backup")
+	fs.Parse(args)
+
+	conn, err := grpc.Dial(*addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	b, err := fetchBackup(ctx, pb.NewKVStoreServiceClient(conn))
+	if err != nil {
+		return err
+	}
+	if err := writeBackup(b, *out); err != nil {
+		return err
+	}
+	log.Printf("Saved backup of %d bytes at term %d and index %d to %s", len(b.Data), b.Term, b.AppliedIndex, *out)
+	return nil
+}
+
+func fetchBackup(ctx context.Context, client pb.KVStoreServiceClient) (*backupFile, error) {
+	stream, err := client.Backup(ctx, &pb.BackupRequest{})
+	if err != nil {
+		return nil, err
+	}
+	var b backupFile
+	var size uint64
+	for first := true; ; first = false {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first {
+			b.AppliedIndex, b.Term = chunk.AppliedIndex, chunk.Term
+			b.Voters, b.Learners = chunk.Voters, chunk.Learners
+			size = chunk.Size
+			b.Data = make([]byte, 0, size)
+		}
+		b.Data = append(b.Data, chunk.Data...)
+		if chunk.Checksum != "" {
+			b.Checksum = chunk.Checksum
+		}
+	}
+	if uint64(len(b.Data)) != size {
+		return nil, fmt.Errorf("backup truncated: got %d of %d bytes", len(b.Data), size)
+	}
+	if err := b.verify(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// writeBackup writes b to path, through a temporary file so a failed backup
+// never replaces a good one.
+func writeBackup(b *backupFile, path string) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readBackup reads and verifies the backup at path.
+func readBackup(path string) (*backupFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var b backupFile
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("read backup: %w", err)
+	}
+	return &b, b.verify()
+}
+
+func (b *backupFile) verify() error {
+	sum := sha256.Sum256(b.Data)
+	if hex.EncodeToString(sum[:]) != b.Checksum {
+		return errors.New("backup checksum mismatch")
+	}
+	return nil
+}
+
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("i", "kv739.backup", "Backup file to restore")
+	id := fs.Uint64("id", 1, "ID of the member to seed")
+	members := fs.String("members", "", "Comma-separated IDs of every member of the new cluster")
+	dir := fs.String("dir", "./storage", "Storage directory of the member")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "Keys of an encrypted backup; defaults to $"+consts.EncryptionKeysEnv)
+	compressThreshold := fs.Int("compress-threshold", 0, "Compress the restored snapshot if it is at least this many bytes, 0 to disable")
+	fs.Parse(args)
+
+	voters, err := parseMembers(*members)
+	if err != nil {
+		return err
+	}
+	if !contains(voters, *id) {
+		return fmt.Errorf("member %d is not in -members %s", *id, *members)
+	}
+	keyring, err := repository.LoadKeyring(*encryptionKeyFile, consts.EncryptionKeysEnv)
+	if err != nil {
+		return fmt.Errorf("load encryption keys: %w", err)
+	}
+
+	b, err := readBackup(*in)
+	if err != nil {
+		return err
+	}
+	// The AES codec decodes plaintext as-is, and refuses encrypted data without keys.
+	codec := repository.NewCodecRepo(nil, repository.NewFlateCodec(*compressThreshold), repository.NewAESGCMCodec(keyring))
+	if err := restore(b, *id, voters, *dir, codec); err != nil {
+		return err
+	}
+	log.Printf("Seeded member %d of %v from backup at term %d and index %d (taken from members %v)",
+		*id, voters, b.Term, b.AppliedIndex, b.Voters)
+	return nil
+}
+
+// restore seeds the storage directory dir of member id of a new cluster of
+// voters with the snapshot and WAL a member starts from. codec decodes and
+// re-encodes the snapshot payload.
+func restore(b *backupFile, id uint64, voters []uint64, dir string, codec *repository.CodecRepo) error {
+	snapdir := filepath.Join(dir, fmt.Sprintf("snap-%d", id))
+	waldir := filepath.Join(dir, fmt.Sprintf("wal-%d", id))
+	// An existing WAL or database would take precedence over the backup.
+	for _, path := range []string{
+		waldir,
+		filepath.Join(dir, fmt.Sprintf("kv739_%d.db", id)),
+		filepath.Join(dir, fmt.Sprintf("kv739_%d.bolt", id)),
+	} {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("%s already exists; restore only seeds new members", path)
+		}
+	}
+	data, dropped, err := withoutClusterState(b.Data, codec)
+	if err != nil {
+		return err
+	}
+	if dropped > 0 {
+		log.Printf("Dropped %d keys of the old cluster's member registry, alarms and load balancer state", dropped)
+	}
+	if err := os.MkdirAll(snapdir, 0750); err != nil {
+		return err
+	}
+
+	lg := zap.NewNop()
+	conf := raftpb.ConfState{Voters: voters}
+	snapshot := raftpb.Snapshot{
+		Data: data,
+		Metadata: raftpb.SnapshotMetadata{
+			ConfState: conf,
+			Index:     b.AppliedIndex,
+			Term:      b.Term,
+		},
+	}
+	if err := snap.New(lg, snapdir).SaveSnap(snapshot); err != nil {
+		return err
+	}
+
+	w, err := wal.Create(lg, waldir, nil)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	err = w.SaveSnapshot(walpb.Snapshot{Index: b.AppliedIndex, Term: b.Term, ConfState: &conf})
+	if err != nil {
+		return err
+	}
+	return w.Save(raftpb.HardState{Term: b.Term, Commit: b.AppliedIndex}, nil)
+}
+
+// withoutClusterState drops the keys that describe the old cluster rather
+// than its data from a snapshot payload, and returns the payload re-encoded,
+// with the number of keys dropped. The member registry names members the new
+// cluster must not redirect clients to or dial, an old NOSPACE alarm would
+// keep it read-only, and the load balancers' coordination state would hand
+// the new load balancers a foreign lease, peers and drained backends.
+func withoutClusterState(data []byte, codec *repository.CodecRepo) ([]byte, int, error) {
+	decoded, err := codec.Decode(data)
+	if err != nil {
+		return nil, 0, fmt.Errorf("decode backup: %w", err)
+	}
+	var pairs []models.KVPair
+	if err := json.Unmarshal(decoded, &pairs); err != nil {
+		return nil, 0, fmt.Errorf("decode backup: %w", err)
+	}
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if !service.IsMemberKey(pair.Key) && !service.IsAlarmKey(pair.Key) && !repository.IsCoordinationKey(pair.Key) {
+			kept = append(kept, pair)
+		}
+	}
+	dropped := len(pairs) - len(kept)
+	if decoded, err = json.Marshal(kept); err != nil {
+		return nil, 0, err
+	}
+	data, err = codec.Encode(decoded)
+	return data, dropped, err
+}
+
+func parseMembers(s string) ([]uint64, error) {
+	var ids []uint64
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid member ID %q", part)
+		}
+		if !contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("-members is required")
+	}
+	return ids, nil
+}
+
+func contains(ids []uint64, id uint64) bool {
+	for _, other := range ids {
+		if other == id {
+			return true
+		}
+	}
+	return false
+}
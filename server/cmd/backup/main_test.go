@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"cs739-kv-store/models"
+	pb "cs739-kv-store/proto/kv739"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"
+
+// oldClusterKeys hold alarms and load balancer state of the backed up cluster.
+var oldClusterKeys = []string{
+	repository.ReservedPrefix + "alarm/NOSPACE/2",
+	repository.ReservedPrefix + "alarm/CORRUPT/3",
+	repository.CoordinationPrefix + "lb/leader",
+	repository.CoordinationPrefix + "lb/next-id",
+	repository.CoordinationPrefix + "lb/peers",
+	repository.CoordinationPrefix + "lb/draining",
+}
+
+// newTestBackup returns a backup of a three member cluster holding the
+// given pairs, with its snapshot payload encoded by codecs.
+func newTestBackup(t *testing.T, codecs []repository.ValueCodec, pairs map[string]string) *backupFile {
+	t.Helper()
+	storage := repository.NewCodecRepo(repository.NewMapRepo(), codecs...)
+	for key, value := range pairs {
+		if err := storage.Put(key, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint64(1); id <= 3; id++ {
+		m := models.Member{ID: id, KVAddress: fmt.Sprintf("old-host:%d", 6000+id), RaftAddress: fmt.Sprintf("http://old-host:%d", 12000+id)}
+		if err := storage.Put(fmt.Sprintf("%smember/%d", repository.ReservedPrefix, id), string(m.Context())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if members, err := service.ReadMembers(storage); err != nil || len(members) != 3 {
+		t.Fatalf("registry of the old cluster = %v, %v; want 3 members", members, err)
+	}
+	for _, key := range oldClusterKeys {
+		if err := storage.Put(key, "old"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := storage.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return &backupFile{AppliedIndex: 42, Term: 3, Voters: []uint64{1, 2, 3}, Checksum: hex.EncodeToString(sum[:]), Data: data}
+}
+
+func TestRestoreDropsOldRegistry(t *testing.T) {
+	keyring, err := repository.ParseKeyring("k1 " + testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codecs := []repository.ValueCodec{repository.NewFlateCodec(0), repository.NewAESGCMCodec(keyring)}
+	codec := repository.NewCodecRepo(nil, codecs...)
+	b := newTestBackup(t, codecs, map[string]string{"a": "1", "b": "2"})
+
+	dir := t.TempDir()
+	if err := restore(b, 4, []uint64{4, 5}, dir, codec); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	snapshot, err := snap.New(zap.NewNop(), filepath.Join(dir, "snap-4")).Load()
+	if err != nil {
+		t.Fatalf("load snapshot: %v", err)
+	}
+	if voters := snapshot.Metadata.ConfState.Voters; !reflect.DeepEqual(voters, []uint64{4, 5}) {
+		t.Fatalf("snapshot voters = %v, want [4 5]", voters)
+	}
+
+	restored := repository.NewCodecRepo(repository.NewMapRepo(), codecs...)
+	if err := restored.Restore(snapshot.Data); err != nil {
+		t.Fatalf("decode restored snapshot: %v", err)
+	}
+	members, err := service.ReadMembers(restored)
+	if err != nil || len(members) != 0 {
+		t.Fatalf("registry after restore = %v, %v; want the old members dropped", members, err)
+	}
+	for _, key := range oldClusterKeys {
+		if _, found, _ := restored.Get(key); found {
+			t.Fatalf("%q survived the restore", key)
+		}
+	}
+	if value, _, _ := restored.Get("b"); value != "2" {
+		t.Fatalf("b = %q after restore, want 2", value)
+	}
+
+	// Without the keys the encrypted backup cannot be rewritten.
+	plain := repository.NewCodecRepo(nil, repository.NewFlateCodec(0), repository.NewAESGCMCodec(nil))
+	if err := restore(b, 5, []uint64{4, 5}, t.TempDir(), plain); err == nil {
+		t.Fatalf("restore of an encrypted backup without keys succeeded")
+	}
+}
+
+// backupServer streams a fixed backup in small chunks, as a node would.
+type backupServer struct {
+	pb.UnimplementedKVStoreServiceServer
+	backup *backupFile
+}
+
+func (s *backupServer) Backup(req *pb.BackupRequest, stream pb.KVStoreService_BackupServer) error {
+	const chunkSize = 7
+	data := s.backup.Data
+	for offset := 0; offset == 0 || offset < len(data); offset += chunkSize {
+		chunk := &pb.BackupChunk{Data: data[offset:min(offset+chunkSize, len(data))]}
+		if offset == 0 {
+			chunk.AppliedIndex, chunk.Term = s.backup.AppliedIndex, s.backup.Term
+			chunk.Voters, chunk.Size = s.backup.Voters, uint64(len(data))
+		}
+		if offset+chunkSize >= len(data) {
+			chunk.Checksum = s.backup.Checksum
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	codecs := []repository.ValueCodec{repository.NewFlateCodec(1)}
+	codec := repository.NewCodecRepo(nil, codecs...)
+	pairs := map[string]string{"a": "1", "b": strings.Repeat("compressible ", 20)}
+	original := newTestBackup(t, codecs, pairs)
+
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pb.RegisterKVStoreServiceServer(server, &backupServer{backup: original})
+	go server.Serve(listener)
+	defer server.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fetched, err := fetchBackup(context.Background(), pb.NewKVStoreServiceClient(conn))
+	if err != nil {
+		t.Fatalf("fetchBackup: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "kv739.backup")
+	if err := writeBackup(fetched, path); err != nil {
+		t.Fatalf("writeBackup: %v", err)
+	}
+	b, err := readBackup(path)
+	if err != nil {
+		t.Fatalf("readBackup: %v", err)
+	}
+	if b.AppliedIndex != 42 || b.Term != 3 || !reflect.DeepEqual(b.Voters, []uint64{1, 2, 3}) {
+		t.Fatalf("backup at index %d, term %d from %v; want index 42, term 3 from [1 2 3]", b.AppliedIndex, b.Term, b.Voters)
+	}
+
+	// Seed both members of a new cluster of different membership, then
+	// rebuild each one's storage from the snapshot and WAL, as a node does.
+	dir := t.TempDir()
+	newMembers := []uint64{7, 8}
+	for _, id := range newMembers {
+		if err := restore(b, id, newMembers, dir, codec); err != nil {
+			t.Fatalf("restore member %d: %v", id, err)
+		}
+	}
+	if err := restore(b, 7, newMembers, dir, codec); err == nil {
+		t.Fatalf("restore over an existing member succeeded")
+	}
+	for _, id := range newMembers {
+		waldir := filepath.Join(dir, fmt.Sprintf("wal-%d", id))
+		w, err := wal.Open(zap.NewNop(), waldir, walpb.Snapshot{Index: 42, Term: 3})
+		if err != nil {
+			t.Fatalf("open WAL of member %d: %v", id, err)
+		}
+		_, state, _, err := w.ReadAll()
+		w.Close()
+		if err != nil || state.Commit != 42 || state.Term != 3 {
+			t.Fatalf("WAL of member %d: hard state %+v, %v; want commit 42 at term 3", id, state, err)
+		}
+
+		storage := repository.NewCodecRepo(repository.NewMapRepo(), codecs...)
+		index, err := service.Rebuild(storage, filepath.Join(dir, fmt.Sprintf("snap-%d", id)), waldir, nil, 42)
+		if err != nil || index != 42 {
+			t.Fatalf("rebuild member %d = %d, %v; want index 42", id, index, err)
+		}
+		for key, want := range pairs {
+			if value, _, _ := storage.Get(key); value != want {
+				t.Fatalf("member %d: %s = %q, want %q", id, key, value, want)
+			}
+		}
+		if members, _ := service.ReadMembers(storage); len(members) != 0 {
+			t.Fatalf("member %d still has the old registry: %v", id, members)
+		}
+		for _, key := range oldClusterKeys {
+			if _, found, _ := storage.Get(key); found {
+				t.Fatalf("member %d still has %q", id, key)
+			}
+		}
+	}
+
+	// A damaged backup file is refused.
+	data, _ := os.ReadFile(path)
+	data[len(data)/2] ^= 1
+	os.WriteFile(path, data, 0600)
+	if _, err := readBackup(path); err == nil {
+		t.Fatalf("readBackup accepted a damaged file")
+	}
+}
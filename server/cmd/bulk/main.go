@@ -0,0 +1,235 @@
+// Command bulk loads key/value records into a cluster and dumps them out
+// again, in NDJSON or CSV.
+//
+//	bulk import -addr localhost:50051 -i data.ndjson
+//	bulk export -addr localhost:50051 -prefix user/ -format csv -o users.csv
+//
+// NDJSON records are {"key": ..., "value": ...} objects, one per line; CSV
+// records are key,value rows. Both read "-" as stdin or stdout.
+package main
+
+import (
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const sendChunkSize = 256 << 10
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(os.Args[2:])
+	case "export":
+		err = runExport(os.Args[2:])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s import|export [flags]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func parseFormat(name string) (pb.RecordFormat, error) {
+	switch name {
+	case "ndjson":
+		return pb.RecordFormat_NDJSON, nil
+	case "csv":
+		return pb.RecordFormat_CSV, nil
+	}
+	return 0, fmt.Errorf("unknown format %q, want ndjson or csv", name)
+}
+
+func dial(addr string) (pb.KVStoreServiceClient, *grpc.ClientConn, error) {
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, err
+	}
+	return pb.NewKVStoreServiceClient(conn), conn, nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:50051", "KV address of a node; imports follow the redirect to the leader")
+	in := fs.String("i", "-", "File of records to import, - for stdin")
+	formatName := fs.String("format", "ndjson", "Record format: ndjson or csv")
+	batchBytes := fs.Uint("batch-bytes", 0, "Bytes of records per raft entry, 0 for the server default")
+	timeout := fs.Duration("timeout", time.Hour, "Deadline for the whole import")
+	fs.Parse(args)
+
+	format, err := parseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	input := os.Stdin
+	if *in != "-" {
+		if input, err = os.Open(*in); err != nil {
+			return err
+		}
+		defer input.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	target := *addr
+	for redirects := 0; ; redirects++ {
+		resp, err := sendImport(ctx, target, input, format, uint32(*batchBytes))
+		if err != nil {
+			return err
+		}
+		if resp.Status == consts.Redirect && redirects == 0 {
+			// The leader answers before reading past the first message,
+			// so only a file can be sent again.
+			if _, err := input.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("%s is not the leader; rerun with -addr %s", target, resp.LeaderAddress)
+			}
+			log.Printf("Redirected to the leader at %s", resp.LeaderAddress)
+			target = resp.LeaderAddress
+			continue
+		}
+		return report(resp)
+	}
+}
+
+func sendImport(ctx context.Context, addr string, input io.Reader, format pb.RecordFormat, batchBytes uint32) (*pb.ImportResponse, error) {
+	client, conn, err := dial(addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stream, err := client.Import(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, sendChunkSize)
+	var sent int64
+	for first := true; ; first = false {
+		n, err := io.ReadFull(input, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		if n == 0 && !first {
+			break
+		}
+		req := &pb.ImportRequest{Data: buf[:n]}
+		if first {
+			req.Format, req.BatchBytes = format, batchBytes
+		}
+		if err := stream.Send(req); err == io.EOF {
+			// The server stopped reading; its response says why.
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if sent/(64<<20) != (sent+int64(n))/(64<<20) {
+			log.Printf("Sent %d MiB", (sent+int64(n))>>20)
+		}
+		sent += int64(n)
+		if n < len(buf) {
+			break
+		}
+	}
+	return stream.CloseAndRecv()
+}
+
+func report(resp *pb.ImportResponse) error {
+	for _, f := range resp.Failures {
+		log.Printf("Record %d failed: %s", f.Record, f.Error)
+	}
+	if int64(len(resp.Failures)) < resp.Failed {
+		log.Printf("... and %d more failed records", resp.Failed-int64(len(resp.Failures)))
+	}
+	log.Printf("Read %d records: %d imported in %d batches, %d failed", resp.Records, resp.Imported, resp.Batches, resp.Failed)
+	switch resp.Status {
+	case consts.Success:
+		return nil
+	case consts.NoSpace:
+		return fmt.Errorf("import stopped, the cluster is out of space: %s", resp.Error)
+	default:
+		return fmt.Errorf("import failed with status %d: %s", resp.Status, resp.Error)
+	}
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	addr := fs.String("addr", "localhost:50051", "KV address of the node to export from")
+	out := fs.String("o", "-", "File to write the records to, - for stdout")
+	prefix := fs.String("prefix", "", "Only export keys with this prefix")
+	formatName := fs.String("format", "ndjson", "Record format: ndjson or csv")
+	timeout := fs.Duration("timeout", time.Hour, "Deadline for the whole export")
+	fs.Parse(args)
+
+	format, err := parseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	client, conn, err := dial(*addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	stream, err := client.Export(ctx, &pb.ExportRequest{Prefix: *prefix, Format: format})
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	tmp := *out + ".tmp"
+	if *out != "-" {
+		// Write to a temporary file first so a failed export never replaces a good one.
+		if output, err = os.Create(tmp); err != nil {
+			return err
+		}
+		defer output.Close()
+	}
+	var records int64
+	var index uint64
+	for first := true; ; first = false {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if first {
+			index = chunk.AppliedIndex
+		}
+		if _, err := output.Write(chunk.Data); err != nil {
+			return err
+		}
+		records += chunk.Records
+	}
+	if *out != "-" {
+		if err := output.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, *out); err != nil {
+			return errors.Join(err, os.Remove(tmp))
+		}
+	}
+	log.Printf("Exported %d records at index %d", records, index)
+	return nil
+}
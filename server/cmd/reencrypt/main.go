@@ -0,0 +1,143 @@
+// Command reencrypt rewrites a stopped node's stored values and snapshot
+// files so they are sealed with the active encryption key, after which
+// retired keys are only needed to read older WAL entries.
+//
+// Run it with the same -data-dir, engine and key flags the node uses:
+//
+//	reencrypt -id 1 -data-dir ./storage -encryption-key-file ./keys
+package main
+
+import (
+	"cs739-kv-store/consts"
+	"cs739-kv-store/repository"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.uber.org/zap"
+)
+
+const batchSize = 1000
+
+func main() {
+	var (
+		nodeID            uint64
+		dataDir           string
+		engine            string
+		engineOptions     repository.EngineOptions
+		encryptionKeyFile string
+		dryRun            bool
+	)
+	flag.Uint64Var(&nodeID, "id", 1, "Node ID")
+	flag.StringVar(&dataDir, "data-dir", repository.DefaultDataDir, "Directory for the node's storage, WAL and snapshots")
+	flag.StringVar(&engine, "engine", repository.EngineSQLite, "Storage engine: sqlite or bolt")
+	flag.StringVar(&engineOptions.SQLite.JournalMode, "sqlite-journal-mode", "wal", "SQLite journal mode: wal, delete, truncate, persist, memory or off")
+	flag.StringVar(&engineOptions.SQLite.Synchronous, "sqlite-synchronous", "normal", "SQLite synchronous setting: off, normal, full or extra")
+	flag.StringVar(&encryptionKeyFile, "encryption-key-file", "", "Key file; defaults to $"+consts.EncryptionKeysEnv)
+	flag.BoolVar(&dryRun, "dry-run", false, "Only count what would be re-encrypted")
+	flag.Parse()
+
+	keyring, err := repository.LoadKeyring(encryptionKeyFile, consts.EncryptionKeysEnv)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatalf("No encryption keys configured")
+	}
+	codec := repository.NewAESGCMCodec(keyring)
+
+	path := repository.StoragePath(dataDir, engine, nodeID)
+	if path == "" {
+		log.Fatalf("Engine %s keeps no data on disk, nothing to re-encrypt", engine)
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalf("No storage for node %d: %v", nodeID, err)
+	}
+	storage, err := repository.OpenStorageEngineAt(engine, path, engineOptions)
+	if err != nil {
+		log.Fatalf("Failed to open storage engine: %v", err)
+	}
+	defer storage.Close()
+
+	values, err := reencryptValues(storage, codec, dryRun)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt values: %v", err)
+	}
+	snapshots, err := reencryptSnapshots(filepath.Join(dataDir, fmt.Sprintf("snap-%d", nodeID)), codec, dryRun)
+	if err != nil {
+		log.Fatalf("Failed to re-encrypt snapshots: %v", err)
+	}
+
+	log.Printf("Re-encrypted %d values and %d snapshots with key %q (dry run: %v)", values, snapshots, keyring.ActiveID(), dryRun)
+	log.Printf("WAL entries are not rewritten; keep retired keys until the WAL no longer holds entries sealed with them")
+}
+
+func reencryptValues(storage repository.StorageEngine, codec *repository.AESGCMCodec, dryRun bool) (int, error) {
+	// Collect first: some engines hold a read transaction open while ranging.
+	var ops []repository.Op
+	var reencryptErr error
+	err := storage.Range("", "", func(key, value string) bool {
+		out, changed, err := codec.Reencrypt([]byte(value))
+		if err != nil {
+			reencryptErr = fmt.Errorf("key %s: %w", key, err)
+			return false
+		}
+		if changed {
+			ops = append(ops, repository.Op{Type: repository.OpPut, Key: key, Value: string(out)})
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if reencryptErr != nil {
+		return 0, reencryptErr
+	}
+	if dryRun {
+		return len(ops), nil
+	}
+
+	for i := 0; i < len(ops); i += batchSize {
+		if err := storage.Batch(ops[i:min(i+batchSize, len(ops))]); err != nil {
+			return i, err
+		}
+	}
+	return len(ops), nil
+}
+
+func reencryptSnapshots(dir string, codec *repository.AESGCMCodec, dryRun bool) (int, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.snap"))
+	if err != nil {
+		return 0, err
+	}
+	lg := zap.NewNop()
+	snapshotter := snap.New(lg, dir)
+	var count int
+	for _, name := range names {
+		snapshot, err := snap.Read(lg, name)
+		if err != nil {
+			log.Printf("Skipping unreadable snapshot %s: %v", name, err)
+			continue
+		}
+		out, changed, err := codec.Reencrypt(snapshot.Data)
+		if err != nil {
+			return count, fmt.Errorf("%s: %w", name, err)
+		}
+		if !changed {
+			continue
+		}
+		count++
+		if dryRun {
+			continue
+		}
+		snapshot.Data = out
+		// SaveSnap names the file after the snapshot's term and index, so this replaces it.
+		if err := snapshotter.SaveSnap(*snapshot); err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,215 @@
+// Command walinspect reads a node's WAL and snapshot directories, without
+// modifying or locking them, to find out why a node does not start.
+//
+//	walinspect snapshots -id 1   list snapshots with their term, index and conf state
+//	walinspect entries -id 1     dump WAL records with decoded commands and conf changes
+//	walinspect verify -id 1      check CRCs and report where corruption begins
+package main
+
+import (
+	"cs739-kv-store/consts"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	nodeID := fs.Uint64("id", 1, "Node ID")
+	dir := fs.String("dir", "./storage", "Storage directory of the node")
+	from := fs.Uint64("from", 0, "entries: skip entries below this index")
+	encryptionKeyFile := fs.String("encryption-key-file", "", "entries: key file to decrypt proposals with; defaults to $"+consts.EncryptionKeysEnv)
+	fs.Parse(os.Args[2:])
+
+	waldir := filepath.Join(*dir, fmt.Sprintf("wal-%d", *nodeID))
+	snapdir := filepath.Join(*dir, fmt.Sprintf("snap-%d", *nodeID))
+
+	var ok bool
+	switch os.Args[1] {
+	case "snapshots":
+		ok = listSnapshots(snapdir, waldir)
+	case "entries":
+		keyring, err := repository.LoadKeyring(*encryptionKeyFile, consts.EncryptionKeysEnv)
+		if err != nil {
+			log.Fatalf("Failed to load encryption keys: %v", err)
+		}
+		ok = dumpEntries(waldir, *from, repository.NewAESGCMCodec(keyring))
+	case "verify":
+		ok = verify(snapdir, waldir)
+	default:
+		usage()
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s snapshots|entries|verify [-id N] [-dir ./storage]\n", os.Args[0])
+	os.Exit(2)
+}
+
+func listSnapshots(snapdir, waldir string) bool {
+	names, err := filepath.Glob(filepath.Join(snapdir, "*.snap"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	sort.Strings(names)
+
+	// Snapshots the WAL knows about; the node only loads one of these.
+	inWAL := make(map[uint64]bool)
+	walErr := readWAL(waldir, func(rec *walRecord) {
+		if rec.Type == snapshotType {
+			var s walpb.Snapshot
+			if rec.Data != nil && s.Unmarshal(rec.Data) == nil {
+				inWAL[s.Index] = true
+			}
+		}
+	})
+
+	ok := true
+	for _, name := range names {
+		s, err := snap.Read(zap.NewNop(), name)
+		if err != nil {
+			fmt.Printf("%s  BROKEN: %v\n", filepath.Base(name), err)
+			ok = false
+			continue
+		}
+		m := s.Metadata
+		fmt.Printf("%s  term=%d index=%d voters=%v learners=%v size=%d in_wal=%v\n",
+			filepath.Base(name), m.Term, m.Index, m.ConfState.Voters, m.ConfState.Learners, len(s.Data), inWAL[m.Index])
+	}
+	broken, _ := filepath.Glob(filepath.Join(snapdir, "*.snap.broken"))
+	for _, name := range broken {
+		fmt.Printf("%s  previously found broken\n", filepath.Base(name))
+	}
+	if len(names) == 0 {
+		fmt.Printf("no snapshots in %s\n", snapdir)
+	}
+	if walErr != nil {
+		fmt.Printf("WAL incomplete, snapshot references may be missing: %v\n", walErr)
+	}
+	return ok
+}
+
+func dumpEntries(waldir string, from uint64, codec repository.ValueCodec) bool {
+	err := readWAL(waldir, func(rec *walRecord) {
+		switch rec.Type {
+		case metadataType:
+			fmt.Printf("%s@%d  metadata (%d bytes)\n", filepath.Base(rec.file), rec.offset, len(rec.Data))
+		case stateType:
+			var st raftpb.HardState
+			if err := st.Unmarshal(rec.Data); err != nil {
+				fmt.Printf("hardstate  <undecodable: %v>\n", err)
+				return
+			}
+			fmt.Printf("hardstate  term=%d vote=%d commit=%d\n", st.Term, st.Vote, st.Commit)
+		case snapshotType:
+			var s walpb.Snapshot
+			if err := s.Unmarshal(rec.Data); err != nil {
+				fmt.Printf("snapshot  <undecodable: %v>\n", err)
+				return
+			}
+			fmt.Printf("snapshot  term=%d index=%d conf=%v\n", s.Term, s.Index, s.ConfState)
+		case entryType:
+			var e raftpb.Entry
+			if err := e.Unmarshal(rec.Data); err != nil {
+				fmt.Printf("entry  <undecodable: %v>\n", err)
+				return
+			}
+			if e.Index >= from {
+				fmt.Printf("%d  term=%d  %s\n", e.Index, e.Term, describeEntry(e, codec))
+			}
+		}
+	})
+	if err != nil {
+		fmt.Printf("CORRUPT: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func describeEntry(e raftpb.Entry, codec repository.ValueCodec) string {
+	switch e.Type {
+	case raftpb.EntryNormal:
+		if len(e.Data) == 0 {
+			return "empty"
+		}
+		desc, err := service.DescribeCommand(e.Data, codec)
+		if err != nil {
+			return fmt.Sprintf("<undecodable command: %v>", err)
+		}
+		return desc
+	case raftpb.EntryConfChange:
+		var cc raftpb.ConfChange
+		if err := cc.Unmarshal(e.Data); err != nil {
+			return fmt.Sprintf("<undecodable conf change: %v>", err)
+		}
+		return fmt.Sprintf("conf change %s node=%d context=%q", cc.Type, cc.NodeID, cc.Context)
+	case raftpb.EntryConfChangeV2:
+		var cc raftpb.ConfChangeV2
+		if err := cc.Unmarshal(e.Data); err != nil {
+			return fmt.Sprintf("<undecodable conf change: %v>", err)
+		}
+		return fmt.Sprintf("conf change v2 %v context=%q", cc.Changes, cc.Context)
+	default:
+		return e.Type.String()
+	}
+}
+
+func verify(snapdir, waldir string) bool {
+	ok := true
+	records := make(map[string]int)
+	var lastIndex uint64
+	err := readWAL(waldir, func(rec *walRecord) {
+		records[rec.file]++
+		if rec.Type == entryType {
+			var e raftpb.Entry
+			if e.Unmarshal(rec.Data) == nil {
+				lastIndex = e.Index
+			}
+		}
+	})
+	files, _ := walFiles(waldir)
+	for _, file := range files {
+		fmt.Printf("%s  %d valid records\n", filepath.Base(file), records[file])
+	}
+	var walErr *walError
+	switch {
+	case errors.As(err, &walErr):
+		fmt.Printf("WAL CORRUPT: %v (last good entry index %d)\n", walErr, lastIndex)
+		ok = false
+	case err != nil:
+		fmt.Printf("WAL unreadable: %v\n", err)
+		ok = false
+	default:
+		fmt.Printf("WAL ok, last entry index %d\n", lastIndex)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(snapdir, "*.snap"))
+	sort.Strings(names)
+	for _, name := range names {
+		if _, err := snap.Read(zap.NewNop(), name); err != nil {
+			fmt.Printf("%s  CORRUPT: %v\n", filepath.Base(name), err)
+			ok = false
+		}
+	}
+	if ok {
+		fmt.Printf("%d snapshots ok\n", len(names))
+	}
+	return ok
+}
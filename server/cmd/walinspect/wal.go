@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+)
+
+// WAL record types, as written by go.etcd.io/etcd/server/v3/wal.
+const (
+	metadataType int64 = iota + 1
+	entryType
+	stateType
+	crcType
+	snapshotType
+)
+
+const frameSizeBytes = 8
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// walRecord is a decoded record and where it was found.
+type walRecord struct {
+	file   string
+	offset int64 // offset of the record's length field
+	walpb.Record
+}
+
+// walError pinpoints the first record that could not be read.
+type walError struct {
+	file   string
+	offset int64
+	err    error
+}
+
+func (e *walError) Error() string {
+	return fmt.Sprintf("%s at offset %d: %v", e.file, e.offset, e.err)
+}
+
+func (e *walError) Unwrap() error {
+	return e.err
+}
+
+var (
+	errCRCMismatch = errors.New("crc mismatch")
+	errTornWrite   = errors.New("torn write: a sector of the record is zeroed")
+	errTruncated   = errors.New("record extends past the end of the file")
+)
+
+// walFiles returns the WAL files in dir in sequence order.
+func walFiles(dir string) ([]string, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names) // names are zero-padded hex sequence and index
+	return names, nil
+}
+
+// readWAL decodes every record of the WAL in dir, verifying the CRC chain,
+// and calls fn for each one. It stops at the first record that fails to
+// decode or verify and returns a *walError describing where.
+func readWAL(dir string, fn func(rec *walRecord)) error {
+	files, err := walFiles(dir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no WAL files in %s", dir)
+	}
+
+	var crc uint32
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var offset int64
+		for offset+frameSizeBytes <= int64(len(data)) {
+			lenField := int64(binary.LittleEndian.Uint64(data[offset:]))
+			if lenField == 0 {
+				break // preallocated space
+			}
+			recBytes, padBytes := decodeFrameSize(lenField)
+			start := offset + frameSizeBytes
+			if start+recBytes+padBytes > int64(len(data)) {
+				return &walError{file, offset, errTruncated}
+			}
+			frame := data[start : start+recBytes+padBytes]
+
+			rec := &walRecord{file: file, offset: offset}
+			if err := rec.Unmarshal(frame[:recBytes]); err != nil {
+				if isTorn(frame, start) {
+					err = errTornWrite
+				}
+				return &walError{file, offset, err}
+			}
+
+			if rec.Type == crcType {
+				// Each file starts by carrying over the CRC of the previous one.
+				if crc != 0 && rec.Crc != crc {
+					return &walError{file, offset, fmt.Errorf("%w: file continues from crc %08x, previous file ended at %08x", errCRCMismatch, rec.Crc, crc)}
+				}
+				crc = rec.Crc
+			} else {
+				crc = crc32.Update(crc, crcTable, rec.Data)
+				if rec.Crc != crc {
+					err := fmt.Errorf("%w: record has %08x, computed %08x", errCRCMismatch, rec.Crc, crc)
+					if isTorn(frame, start) {
+						err = errTornWrite
+					}
+					return &walError{file, offset, err}
+				}
+			}
+			fn(rec)
+			offset = start + recBytes + padBytes
+		}
+		if tail := data[offset:]; len(tail) > 0 && !allZero(tail) {
+			return &walError{file, offset, io.ErrUnexpectedEOF}
+		}
+	}
+	return nil
+}
+
+func decodeFrameSize(lenField int64) (recBytes int64, padBytes int64) {
+	// the record size is stored in the lower 56 bits of the 64-bit length
+	recBytes = int64(uint64(lenField) & ^(uint64(0xff) << 56))
+	// non-zero padding is indicated by set MSb / a negative length
+	if lenField < 0 {
+		// padding is stored in lower 3 bits of length MSB
+		padBytes = int64((uint64(lenField) >> 56) & 0x7)
+	}
+	return recBytes, padBytes
+}
+
+// isTorn reports whether any 512 byte sector spanned by a frame starting at
+// file offset start is entirely zero, which is how a partial write looks.
+func isTorn(frame []byte, start int64) bool {
+	const sectorSize = 512
+	for off := 0; off < len(frame); {
+		n := int(sectorSize - (start+int64(off))%sectorSize)
+		if n > len(frame)-off {
+			n = len(frame) - off
+		}
+		if allZero(frame[off : off+n]) {
+			return true
+		}
+		off += n
+	}
+	return false
+}
+
+func allZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
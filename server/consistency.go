@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"cs739-kv-store/raft"
+	"cs739-kv-store/service"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// startConsistencyChecker periodically compares the state hashes of all
+// members while this node is the leader, and raises a CORRUPT alarm for
+// every member that disagrees with the majority.
+func startConsistencyChecker(kv *service.Kvstore, raftNode *raft.RaftNode, interval time.Duration) {
+	conns := make(map[uint64]*grpc.ClientConn)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if !raftNode.IsLeader() {
+			continue
+		}
+		checkConsistency(kv, raftNode, conns, interval)
+	}
+}
+
+// memberLister lists the IDs of the raft members, voters and learners alike.
+type memberLister interface {
+	Members() []uint64
+}
+
+func checkConsistency(kv *service.Kvstore, raftNode memberLister, conns map[uint64]*grpc.ClientConn, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	index, leaderHash := kv.StateHash()
+	hashes := map[uint64]uint64{nodeID: leaderHash}
+	for _, id := range raftNode.Members() {
+		if id == nodeID {
+			continue
+		}
+		hash, err := memberHash(ctx, kv, conns, id, index)
+		if err != nil {
+			log.Printf("Consistency check: no hash from member %d at index %d: %v\n", id, index, err)
+			continue
+		}
+		hashes[id] = hash
+	}
+
+	// The hash most members agree on is taken as correct, with the leader breaking ties.
+	votes := make(map[uint64]int)
+	for _, hash := range hashes {
+		votes[hash]++
+	}
+	majority := leaderHash
+	for hash, n := range votes {
+		if n > votes[majority] {
+			majority = hash
+		}
+	}
+
+	for id, hash := range hashes {
+		if hash == majority {
+			continue
+		}
+		detail := fmt.Sprintf("state hash %x at index %d, %d of %d members have %x", hash, index, votes[majority], len(hashes), majority)
+		log.Printf("Consistency check: member %d diverged: %s\n", id, detail)
+		if err := kv.RaiseAlarm(service.AlarmCorrupt, id, detail); err != nil {
+			log.Printf("Consistency check: failed to raise alarm for member %d: %v\n", id, err)
+		}
+	}
+}
+
+func memberHash(ctx context.Context, kv *service.Kvstore, conns map[uint64]*grpc.ClientConn, id uint64, index uint64) (uint64, error) {
+	conn, ok := conns[id]
+	if !ok {
+		address, ok := memberAddress(kv, id)
+		if !ok {
+			return 0, fmt.Errorf("no address for member %d", id)
+		}
+		var err error
+		if conn, err = grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials())); err != nil {
+			return 0, err
+		}
+		conns[id] = conn
+	}
+	resp, err := pb.NewKVStoreServiceClient(conn).HashKV(ctx, &pb.HashKVRequest{Index: index})
+	if err != nil {
+		return 0, err
+	}
+	if resp.Status != consts.Success {
+		return 0, fmt.Errorf("status %d", resp.Status)
+	}
+	return resp.Hash, nil
+}
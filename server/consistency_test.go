@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"cs739-kv-store/raft"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
+	"net"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// newCommittedStore returns a store whose proposals pass through a commit
+// channel, as raft would deliver them, one entry per commit.
+func newCommittedStore(t *testing.T) *service.Kvstore {
+	proposeC := make(chan string)
+	commitC := make(chan *raft.Commit)
+	errorC := make(chan error)
+	kv := service.NewKVStore(snap.New(zap.NewNop(), t.TempDir()), proposeC, commitC, errorC,
+		repository.NewMapRepo(), service.Options{Cache: repository.CacheConfig{TTL: time.Minute}})
+
+	go func() {
+		var index uint64
+		for data := range proposeC {
+			index++
+			done := make(chan struct{})
+			commitC <- &raft.Commit{Data: []string{data}, Indexes: []uint64{index}, ApplyDoneC: done}
+			<-done
+		}
+		close(commitC)
+		close(errorC)
+	}()
+	t.Cleanup(func() { close(proposeC) })
+	return kv
+}
+
+// waitApplied proposes a marker and waits until it is applied, so every
+// proposal made before it is applied as well.
+func waitApplied(t *testing.T, kv *service.Kvstore) {
+	kv.Propose("marker", "")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+		if _, found, _ := kv.Get("marker"); found {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("proposal not applied")
+		}
+	}
+}
+
+type fakeHashServer struct {
+	pb.UnimplementedKVStoreServiceServer
+	hash uint64
+}
+
+func (s *fakeHashServer) HashKV(ctx context.Context, req *pb.HashKVRequest) (*pb.HashKVResponse, error) {
+	return &pb.HashKVResponse{Status: consts.Success, Hash: s.hash}, nil
+}
+
+type fixedMembers []uint64
+
+func (m fixedMembers) Members() []uint64 { return m }
+
+// runConsistencyCheck checks a cluster whose leader is member 1 and whose
+// other members report hashes[id], or cannot be reached if absent.
+func runConsistencyCheck(t *testing.T, kv *service.Kvstore, members fixedMembers, hashes map[uint64]uint64) {
+	oldNodeID, oldAddresses := nodeID, kvAddresses
+	t.Cleanup(func() { nodeID, kvAddresses = oldNodeID, oldAddresses })
+	nodeID, kvAddresses = 1, make(map[uint64]string)
+
+	for _, id := range members[1:] {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		kvAddresses[id] = lis.Addr().String()
+		hash, ok := hashes[id]
+		if !ok {
+			lis.Close()
+			continue
+		}
+		server := grpc.NewServer()
+		pb.RegisterKVStoreServiceServer(server, &fakeHashServer{hash: hash})
+		go server.Serve(lis)
+		t.Cleanup(server.Stop)
+	}
+
+	conns := make(map[uint64]*grpc.ClientConn)
+	checkConsistency(kv, members, conns, 5*time.Second)
+	for _, conn := range conns {
+		conn.Close()
+	}
+	waitApplied(t, kv)
+}
+
+func TestConsistencyCheckRaisesAlarmForMinority(t *testing.T) {
+	kv := newCommittedStore(t)
+	_, hash := kv.StateHash()
+
+	runConsistencyCheck(t, kv, fixedMembers{1, 2, 3}, map[uint64]uint64{2: hash, 3: hash + 1})
+
+	alarms, err := kv.Alarms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alarms) != 1 || alarms[0].Type != service.AlarmCorrupt || alarms[0].Member != 3 {
+		t.Fatalf("alarms = %+v, want CORRUPT for member 3", alarms)
+	}
+}
+
+func TestConsistencyCheckMatchingMajorityRaisesNothing(t *testing.T) {
+	kv := newCommittedStore(t)
+	_, hash := kv.StateHash()
+
+	runConsistencyCheck(t, kv, fixedMembers{1, 2, 3}, map[uint64]uint64{2: hash, 3: hash})
+
+	if alarms, err := kv.Alarms(); err != nil || len(alarms) != 0 {
+		t.Fatalf("alarms = %+v, %v; want none", alarms, err)
+	}
+}
+
+func TestConsistencyCheckSkipsUnreachableMember(t *testing.T) {
+	kv := newCommittedStore(t)
+	_, hash := kv.StateHash()
+
+	// Member 3 is down: it is neither a mismatch nor a vote.
+	runConsistencyCheck(t, kv, fixedMembers{1, 2, 3}, map[uint64]uint64{2: hash})
+
+	if alarms, err := kv.Alarms(); err != nil || len(alarms) != 0 {
+		t.Fatalf("alarms = %+v, %v; want none", alarms, err)
+	}
+}
@@ -1,12 +1,12 @@
 package consts
 
-import "time"
-
 const (
 	Success       = 0
 	InternalError = -1
 	KeyNotFound   = 1
 	Redirect      = 2
+	NoSpace       = 3
+	NotCaughtUp   = 4 // a learner is too far behind the leader to be promoted
 )
 
 const (
@@ -14,12 +14,10 @@ const (
 )
 
 const (
-	KVStoreCapacity    = 20
-	TTL                = 10
-	KVStoreEvictionTTL = 10 * time.Second
+	RaftServerListFileName = "./config/raft_server_list"
+	KVServerListFileName   = "./config/kv_server_list"
 )
 
 const (
-	RaftServerListFileName = "./config/raft_server_list"
-	KVServerListFileName   = "./config/kv_server_list"
+	EncryptionKeysEnv = "KV739_ENCRYPTION_KEYS"
 )
@@ -3,29 +3,121 @@ package main
 import (
 	"bufio"
 	"cs739-kv-store/consts"
-	"database/sql"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 )
 
-func initDB(nodeID uint64) {
+func initStorage(nodeID uint64) {
+	if err := os.MkdirAll(dataDir, 0750); err != nil {
+		log.Fatalf("Failed to create data directory: %v", err)
+	}
+
 	var err error
-	db, err = sql.Open("sqlite3", fmt.Sprintf("./storage/kv739_%d.db", nodeID))
+	keyring, err = repository.LoadKeyring(encryptionKeyFile, consts.EncryptionKeysEnv)
 	if err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		log.Fatalf("Failed to load encryption keys: %v", err)
 	}
 
-	// Create table if it doesn't exist
-	createTableSQL := `CREATE TABLE IF NOT EXISTS kv (
-        key TEXT PRIMARY KEY,
-        value TEXT
-    );`
+	if rebuild {
+		rebuildStorage(nodeID)
+	}
 
-	_, err = db.Exec(createTableSQL)
+	storage, err = openStorage(repository.StoragePath(dataDir, engine, nodeID))
 	if err != nil {
-		log.Fatalf("Failed to create table: %v", err)
+		log.Fatalf("Failed to open storage engine: %v", err)
+	}
+}
+
+// openStorage opens the configured engine at path, wrapped in the codecs.
+func openStorage(path string) (repository.StorageEngine, error) {
+	engineStorage, err := repository.OpenStorageEngineAt(engine, path, engineOptions)
+	if err != nil {
+		return nil, err
+	}
+	// Always decode compressed and encrypted values, even when producing them
+	// is disabled. Without a keyring, encrypted values fail to decode with
+	// ErrNoEncryptionKey instead of being served as they are stored.
+	return repository.NewCodecRepo(engineStorage,
+		repository.NewFlateCodec(compressThreshold),
+		repository.NewAESGCMCodec(keyring)), nil
+}
+
+// proposalCodec returns the codec raft proposals pass through, nil without
+// encryption keys.
+func proposalCodec() repository.ValueCodec {
+	if keyring == nil {
+		return nil
+	}
+	return repository.NewAESGCMCodec(keyring)
+}
+
+// rebuildStorage recreates the node's storage from its snapshots and WAL.
+// The new data is built in a separate file and only replaces the old one
+// if it reaches at least the applied index the old file recorded.
+func rebuildStorage(nodeID uint64) {
+	path := repository.StoragePath(dataDir, engine, nodeID)
+	if path == "" {
+		log.Printf("Engine %s keeps no data on disk, nothing to rebuild\n", engine)
+		return
+	}
+
+	// The old file may be corrupt; its applied index is only used as a check.
+	oldIndex, oldErr := readAppliedIndex(path)
+	if oldErr != nil {
+		log.Printf("Rebuild: cannot read applied index of %s, skipping the check: %v\n", path, oldErr)
+	}
+
+	tmpPath := path + ".rebuild"
+	removeStorageFiles(tmpPath)
+	tmp, err := openStorage(tmpPath)
+	if err != nil {
+		log.Fatalf("Rebuild: failed to create %s: %v", tmpPath, err)
+	}
+	index, err := service.Rebuild(tmp,
+		fmt.Sprintf("%s/snap-%d", dataDir, nodeID),
+		fmt.Sprintf("%s/wal-%d", dataDir, nodeID),
+		proposalCodec(),
+		oldIndex)
+	tmp.Close()
+	if err != nil {
+		removeStorageFiles(tmpPath)
+		log.Fatalf("Rebuild failed, %s left untouched: %v", path, err)
+	}
+	if oldErr == nil && index < oldIndex {
+		removeStorageFiles(tmpPath)
+		log.Fatalf("Rebuild reached index %d but %s was at index %d; the raft log is missing entries, %s left untouched",
+			index, path, oldIndex, path)
+	}
+
+	removeStorageFiles(path)
+	if err := os.Rename(tmpPath, path); err != nil {
+		log.Fatalf("Rebuild: failed to replace %s: %v", path, err)
+	}
+	log.Printf("Rebuilt %s up to index %d (previously at index %d)\n", path, index, oldIndex)
+}
+
+func readAppliedIndex(path string) (uint64, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	old, err := openStorage(path)
+	if err != nil {
+		return 0, err
+	}
+	defer old.Close()
+	return repository.ReadAppliedIndex(old)
+}
+
+// removeStorageFiles deletes an engine file along with SQLite's side files.
+func removeStorageFiles(path string) {
+	for _, suffix := range []string{"", "-journal", "-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			log.Fatalf("Failed to remove %s: %v", path+suffix, err)
+		}
 	}
 }
 
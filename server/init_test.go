@@ -0,0 +1,145 @@
+package main
+
+import (
+	"cs739-kv-store/models"
+	"cs739-kv-store/repository"
+	"cs739-kv-store/service"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+func TestRebuildStorageSwitchesEngineAndCodec(t *testing.T) {
+	oldDataDir, oldEngine, oldKeyring, oldThreshold := dataDir, engine, keyring, compressThreshold
+	t.Cleanup(func() { dataDir, engine, keyring, compressThreshold = oldDataDir, oldEngine, oldKeyring, oldThreshold })
+
+	// The log was written by a node keeping compressed, unencrypted values.
+	source := repository.NewCodecRepo(repository.NewMapRepo(), repository.NewFlateCodec(1))
+	err := source.Batch([]repository.Op{
+		{Type: repository.OpPut, Key: "a", Value: "1"},
+		{Type: repository.OpPut, Key: "b", Value: "2"},
+		repository.AppliedIndexOp(3),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := source.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	member := models.Member{ID: 2, KVAddress: "localhost:6001", RaftAddress: "http://127.0.0.1:5001"}
+	cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 2, Context: member.Context()}
+	ccData, err := cc.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dataDir = t.TempDir()
+	lg := zap.NewNop()
+	snapdir, waldir := fmt.Sprintf("%s/snap-1", dataDir), fmt.Sprintf("%s/wal-1", dataDir)
+	if err := os.MkdirAll(snapdir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	conf := raftpb.ConfState{Voters: []uint64{1}}
+	snapshot := raftpb.Snapshot{Data: data, Metadata: raftpb.SnapshotMetadata{Index: 3, Term: 1, ConfState: conf}}
+	if err := snap.New(lg, snapdir).SaveSnap(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	w, err := wal.Create(lg, waldir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.SaveSnapshot(walpb.Snapshot{Index: 3, Term: 1, ConfState: &conf})
+	entry := raftpb.Entry{Term: 1, Index: 4, Type: raftpb.EntryConfChange, Data: ccData}
+	if err := w.Save(raftpb.HardState{Term: 1, Commit: 4}, []raftpb.Entry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// The node now runs on bolt with encryption, and its old file is damaged.
+	engine = repository.EngineBolt
+	compressThreshold = 0
+	if keyring, err = repository.ParseKeyring("k1 000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"); err != nil {
+		t.Fatal(err)
+	}
+	path := repository.StoragePath(dataDir, engine, 1)
+	old, err := openStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Batch([]repository.Op{{Type: repository.OpPut, Key: "a", Value: "damaged"}, repository.AppliedIndexOp(2)})
+	old.Close()
+
+	rebuildStorage(1)
+
+	if _, err := os.Stat(path + ".rebuild"); !os.IsNotExist(err) {
+		t.Fatalf("temporary rebuild file left behind: %v", err)
+	}
+	rebuilt, err := openStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rebuilt.Close()
+	if index, _ := repository.ReadAppliedIndex(rebuilt); index != 4 {
+		t.Fatalf("applied index = %d, want 4", index)
+	}
+	for key, want := range map[string]string{"a": "1", "b": "2"} {
+		if value, _, _ := rebuilt.Get(key); value != want {
+			t.Fatalf("%s = %q, want %q", key, value, want)
+		}
+	}
+	if members, _ := service.ReadMembers(rebuilt); len(members) != 1 || members[0] != member {
+		t.Fatalf("members = %v, want %v", members, member)
+	}
+	if raw, _, _ := rebuilt.(*repository.CodecRepo).Unwrap().Get("a"); raw == "1" {
+		t.Fatalf("value stored in plaintext, want it encrypted")
+	}
+}
+
+func TestOpenStorageWithoutKeyRefusesEncryptedValues(t *testing.T) {
+	oldDataDir, oldEngine, oldKeyring, oldThreshold := dataDir, engine, keyring, compressThreshold
+	t.Cleanup(func() { dataDir, engine, keyring, compressThreshold = oldDataDir, oldEngine, oldKeyring, oldThreshold })
+	dataDir, engine, compressThreshold = t.TempDir(), repository.EngineBolt, 0
+	path := repository.StoragePath(dataDir, engine, 1)
+
+	var err error
+	if keyring, err = repository.ParseKeyring("k1 000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"); err != nil {
+		t.Fatal(err)
+	}
+	encrypted, err := openStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := encrypted.Put("a", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	encrypted.Close()
+
+	// Restarted without its key, the node still writes plaintext but
+	// refuses to serve or snapshot what it cannot decrypt.
+	keyring = nil
+	storage, err := openStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer storage.Close()
+	if value, _, err := storage.Get("a"); !errors.Is(err, repository.ErrNoEncryptionKey) {
+		t.Fatalf("Get = %q, %v; want ErrNoEncryptionKey", value, err)
+	}
+	if _, err := storage.Snapshot(); !errors.Is(err, repository.ErrNoEncryptionKey) {
+		t.Fatalf("Snapshot = %v, want ErrNoEncryptionKey", err)
+	}
+	if err := storage.Put("b", "plain"); err != nil {
+		t.Fatal(err)
+	}
+	if raw, _, _ := storage.(*repository.CodecRepo).Unwrap().Get("b"); raw != "plain" {
+		t.Fatalf("b stored as %q, want plaintext", raw)
+	}
+}
@@ -1,14 +1,22 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"cs739-kv-store/consts"
+	"cs739-kv-store/models"
 	pb "cs739-kv-store/proto/kv739" // Import the generated package
 	"cs739-kv-store/raft"
+	"cs739-kv-store/repository"
 	"cs739-kv-store/service"
 	"cs739-kv-store/utils"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"go.etcd.io/etcd/raft/v3/raftpb"
 	"google.golang.org/grpc"
+	"io"
 	"log"
 	"net"
 	"os"
@@ -19,11 +27,13 @@ import (
 // Define a struct that implements the KeyValueServiceServer interface.
 type server struct {
 	pb.UnimplementedKVStoreServiceServer
-	mutex sync.Mutex
+	mutex   sync.Mutex
+	closing bool // guarded by mutex
 
 	kv          *service.Kvstore
 	confChangeC chan<- raftpb.ConfChange
 	raftNode    *raft.RaftNode
+	grpcServer  *grpc.Server
 	//raftWrapper *raft.Wrapper
 }
 
@@ -40,6 +50,7 @@ func startKVServer(kv *service.Kvstore, address string, raftNode *raft.RaftNode,
 		kv:          kv,
 		confChangeC: confChangeC,
 		raftNode:    raftNode,
+		grpcServer:  grpcServer,
 	})
 
 	go func() {
@@ -66,6 +77,9 @@ func (s *server) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse,
 	//}
 
 	log.Printf("Processing get request for key: %s, id: %d\n", req.Key, nodeID)
+	if repository.IsReservedKey(req.Key) && !repository.IsCoordinationKey(req.Key) {
+		return &pb.GetResponse{Status: consts.InternalError}, nil
+	}
 	value, found, err := s.kv.Get(req.Key)
 	if err != nil {
 		return &pb.GetResponse{Status: consts.InternalError}, err
@@ -97,12 +111,17 @@ func (s *server) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse,
 	//if !found {
 	//	return &pb.PutResponse{Status: consts.KeyNotFound}, nil
 	//}
+	if repository.IsReservedKey(req.Key) {
+		return &pb.PutResponse{Status: consts.InternalError}, nil
+	}
 	if !s.raftNode.IsLeader() {
 		// Redirect client to the leader
-		leader := s.raftNode.GetLeader()
-		return &pb.PutResponse{Status: consts.Redirect, LeaderAddress: kvAddresses[leader]}, nil
+		return &pb.PutResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
 	}
 	oldValue, found, err := s.kv.Put(req.Key, req.Value)
+	if errors.Is(err, service.ErrNoSpace) {
+		return &pb.PutResponse{Status: consts.NoSpace}, nil
+	}
 	if err != nil {
 		return &pb.PutResponse{Status: consts.InternalError}, nil
 	}
@@ -112,29 +131,96 @@ func (s *server) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse,
 	return &pb.PutResponse{Status: consts.Success, OldValue: oldValue}, nil
 }
 
+// Delete removes a key. It keeps working while writes are rejected for lack of space.
+func (s *server) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	log.Printf("Processing delete request for key: %s\n", req.Key)
+	if repository.IsReservedKey(req.Key) {
+		return &pb.DeleteResponse{Status: consts.InternalError}, nil
+	}
+	if !s.raftNode.IsLeader() {
+		// Redirect client to the leader
+		return &pb.DeleteResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
+	}
+	oldValue, found, err := s.kv.Delete(req.Key)
+	if err != nil {
+		return &pb.DeleteResponse{Status: consts.InternalError}, nil
+	}
+	if !found {
+		return &pb.DeleteResponse{Status: consts.KeyNotFound}, nil
+	}
+	return &pb.DeleteResponse{Status: consts.Success, OldValue: oldValue}, nil
+}
+
+// casTimeout bounds how long CompareAndSwap waits for its command to apply.
+const casTimeout = 5 * time.Second
+
+func (s *server) CompareAndSwap(ctx context.Context, req *pb.CompareAndSwapRequest) (*pb.CompareAndSwapResponse, error) {
+	log.Printf("Processing compare-and-swap request for key: %s\n", req.Key)
+	if repository.IsReservedKey(req.Key) && !repository.IsCoordinationKey(req.Key) {
+		return &pb.CompareAndSwapResponse{Status: consts.InternalError}, nil
+	}
+	if !s.raftNode.IsLeader() {
+		// Redirect client to the leader
+		return &pb.CompareAndSwapResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, casTimeout)
+	defer cancel()
+	result, err := s.kv.CompareAndSwap(ctx, req.Key, req.Expected, req.ExpectMissing, req.Value)
+	if errors.Is(err, service.ErrNoSpace) {
+		return &pb.CompareAndSwapResponse{Status: consts.NoSpace}, nil
+	}
+	if err != nil {
+		return &pb.CompareAndSwapResponse{Status: consts.InternalError}, err
+	}
+	return &pb.CompareAndSwapResponse{
+		Status:       consts.Success,
+		Swapped:      result.Swapped,
+		CurrentValue: result.Value,
+		Found:        result.Found,
+	}, nil
+}
+
 func (s *server) Ping(ctx context.Context, req *pb.PingRequest) (*pb.PingResponse, error) {
 	return &pb.PingResponse{Message: "pong"}, nil
 }
 
+// closeTimeout is how long a graceful Close waits for requests in flight.
+const closeTimeout = 5 * time.Second
+
 func (s *server) Close(ctx context.Context, req *pb.CloseRequest) (*pb.CloseResponse, error) {
 	if req.Clean == 1 {
 		// Graceful termination
 		log.Println("Graceful termination initiated...")
 
-		// Lock to prevent new requests while shutting down
 		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		if s.closing {
+			return &pb.CloseResponse{Status: consts.Success}, nil
+		}
 
 		// Flush any in-memory state (this is just an example, actual logic would depend on your state handling)
 		if err := s.kv.Flush(); err != nil {
 			return &pb.CloseResponse{Status: consts.InternalError}, err
 		}
-		s.raftNode.Stop()
+		s.closing = true
 
-		// Log shutdown and exit after a short delay to allow cleanup
+		// Stop taking requests and let the ones in flight, this one included,
+		// finish before raft goes down.
 		log.Println("Shutting down gracefully...")
 		go func() {
-			time.Sleep(1 * time.Second) // Give some time for cleanup
-			os.Exit(0)                  // Exit after cleanup
+			stopped := make(chan struct{})
+			go func() {
+				s.grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-time.After(closeTimeout):
+				// Streams such as Members never end on their own.
+				s.grpcServer.Stop()
+			}
+			s.raftNode.Stop()
+			os.Exit(0)
 		}()
 
 		return &pb.CloseResponse{Status: consts.Success}, nil
@@ -150,21 +236,34 @@ func (s *server) Close(ctx context.Context, req *pb.CloseRequest) (*pb.CloseResp
 	}
 }
 
+// leaderAddress returns the KV address of the leader, for redirects.
+func (s *server) leaderAddress() string {
+	address, _ := memberAddress(s.kv, s.raftNode.GetLeader())
+	return address
+}
+
 func (s *server) Start(ctx context.Context, req *pb.StartRequest) (*pb.StartResponse, error) {
 	// Start the cluster
 	if !s.raftNode.IsLeader() {
 		// Redirect client to the leader
-		leader := s.raftNode.GetLeader()
-		return &pb.StartResponse{Status: consts.Redirect, LeaderAddress: kvAddresses[leader]}, nil
+		return &pb.StartResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
 	}
 	if req.New != 1 {
 		return &pb.StartResponse{Status: consts.InternalError}, nil
 	}
 
+	raftAddress := req.RaftAddress
+	if raftAddress == "" {
+		raftAddress = utils.GenRaftAddr(req.Id)
+	}
+	member := models.Member{ID: req.Id, KVAddress: req.ServerName, RaftAddress: raftAddress, Learner: req.Learner}
 	cc := raftpb.ConfChange{
 		Type:    raftpb.ConfChangeAddNode,
 		NodeID:  req.Id,
-		Context: []byte(utils.GenRaftAddr(req.Id)),
+		Context: member.Context(),
+	}
+	if req.Learner {
+		cc.Type = raftpb.ConfChangeAddLearnerNode
 	}
 	s.confChangeC <- cc
 
@@ -176,8 +275,7 @@ func (s *server) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResp
 	if !s.raftNode.IsLeader() {
 
 		// Redirect client to the leader
-		leader := s.raftNode.GetLeader()
-		return &pb.LeaveResponse{Status: consts.Redirect, LeaderAddress: kvAddresses[leader]}, nil
+		return &pb.LeaveResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
 	}
 
 	cc := raftpb.ConfChange{
@@ -200,3 +298,406 @@ func (s *server) Leave(ctx context.Context, req *pb.LeaveRequest) (*pb.LeaveResp
 	}
 	return &pb.LeaveResponse{Status: consts.Success}, nil
 }
+
+// TransferLeader moves leadership away from member req.Id if it leads, so it
+// can leave without an election.
+func (s *server) TransferLeader(ctx context.Context, req *pb.TransferLeaderRequest) (*pb.TransferLeaderResponse, error) {
+	if !s.raftNode.IsLeader() {
+		// Redirect client to the leader
+		return &pb.TransferLeaderResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
+	}
+	if req.Id != nodeID {
+		return &pb.TransferLeaderResponse{Status: consts.Success, LeaderAddress: s.leaderAddress()}, nil
+	}
+	if _, err := s.raftNode.TransferLeadership(ctx); err != nil {
+		return &pb.TransferLeaderResponse{Status: consts.InternalError}, err
+	}
+	return &pb.TransferLeaderResponse{Status: consts.Success, LeaderAddress: s.leaderAddress()}, nil
+}
+
+// maxPromoteLag is how many entries a learner may be behind the leader's
+// commit index and still be promoted.
+const maxPromoteLag = 100
+
+// Promote makes a learner a voter once it has replicated the log up to
+// within maxPromoteLag entries of the commit index, and returns NotCaughtUp
+// before that.
+func (s *server) Promote(ctx context.Context, req *pb.PromoteRequest) (*pb.PromoteResponse, error) {
+	if !s.raftNode.IsLeader() {
+		// Redirect client to the leader
+		return &pb.PromoteResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()}, nil
+	}
+	match, commit, learner, ok := s.raftNode.Progress(req.Id)
+	resp := &pb.PromoteResponse{MatchIndex: match, CommitIndex: commit}
+	if !ok || !learner {
+		resp.Status = consts.InternalError
+		resp.Error = fmt.Sprintf("member %d is not a learner", req.Id)
+		return resp, nil
+	}
+	// A learner that has not answered the leader yet has a match of 0.
+	if match == 0 || match+maxPromoteLag < commit {
+		resp.Status = consts.NotCaughtUp
+		return resp, nil
+	}
+
+	member, ok, err := s.kv.Member(req.Id)
+	if err != nil || !ok {
+		resp.Status = consts.InternalError
+		resp.Error = fmt.Sprintf("member %d is not registered: %v", req.Id, err)
+		return resp, nil
+	}
+	member.Learner = false
+	log.Printf("Promoting learner %d at index %d of %d\n", req.Id, match, commit)
+	s.confChangeC <- raftpb.ConfChange{
+		Type:    raftpb.ConfChangeAddNode,
+		NodeID:  req.Id,
+		Context: member.Context(),
+	}
+	resp.Status = consts.Success
+	return resp, nil
+}
+
+func (s *server) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
+	alarms, err := s.kv.Alarms()
+	if err != nil {
+		return nil, err
+	}
+	storageBytes, err := s.kv.StorageSize()
+	if err != nil {
+		return nil, err
+	}
+	appliedIndex, stateHash := s.kv.StateHash()
+	cache := s.kv.CacheStats()
+	resp := &pb.StatusResponse{
+		Id:           nodeID,
+		LeaderId:     s.raftNode.GetLeader(),
+		AppliedIndex: appliedIndex,
+		Cache: &pb.CacheStats{
+			Hits:         cache.Hits,
+			NegativeHits: cache.NegativeHits,
+			Misses:       cache.Misses,
+			Evictions:    cache.Evictions,
+			Expirations:  cache.Expirations,
+			Rejections:   cache.Rejections,
+			Entries:      int64(cache.Entries),
+			Bytes:        cache.Bytes,
+		},
+		StateHash:    stateHash,
+		Alarms:       alarmsToProto(alarms),
+		StorageBytes: storageBytes,
+	}
+	return resp, nil
+}
+
+func alarmsToProto(alarms []service.Alarm) []*pb.Alarm {
+	var out []*pb.Alarm
+	for _, a := range alarms {
+		out = append(out, &pb.Alarm{MemberId: a.Member, Type: a.Type, Detail: a.Detail})
+	}
+	return out
+}
+
+// Alarm lists the active alarms, or clears the ones matching the request and
+// waits for the clear to be applied.
+func (s *server) Alarm(ctx context.Context, req *pb.AlarmRequest) (*pb.AlarmResponse, error) {
+	alarms, err := s.kv.Alarms()
+	if err != nil {
+		return &pb.AlarmResponse{Status: consts.InternalError}, err
+	}
+	if req.Action != pb.AlarmRequest_CLEAR {
+		return &pb.AlarmResponse{Status: consts.Success, Alarms: alarmsToProto(alarms)}, nil
+	}
+
+	matches := func(a service.Alarm) bool {
+		return (req.MemberId == 0 || a.Member == req.MemberId) && (req.Type == "" || a.Type == req.Type)
+	}
+	for _, a := range alarms {
+		if matches(a) {
+			log.Printf("Clearing alarm %s for member %d\n", a.Type, a.Member)
+			s.kv.ClearAlarm(a.Type, a.Member)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if alarms, err = s.kv.Alarms(); err != nil {
+			return &pb.AlarmResponse{Status: consts.InternalError}, err
+		}
+		cleared := true
+		for _, a := range alarms {
+			cleared = cleared && !matches(a)
+		}
+		if cleared {
+			return &pb.AlarmResponse{Status: consts.Success, Alarms: alarmsToProto(alarms)}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return &pb.AlarmResponse{Status: consts.InternalError, Alarms: alarmsToProto(alarms)}, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *server) HashKV(ctx context.Context, req *pb.HashKVRequest) (*pb.HashKVResponse, error) {
+	hash, err := s.kv.HashAt(ctx, req.Index)
+	if err != nil {
+		log.Printf("Failed to get state hash at index %d: %v\n", req.Index, err)
+		return &pb.HashKVResponse{Status: consts.InternalError}, nil
+	}
+	return &pb.HashKVResponse{Status: consts.Success, Hash: hash}, nil
+}
+
+const defaultBackupChunkSize = 1 << 20
+
+func (s *server) Backup(req *pb.BackupRequest, stream pb.KVStoreService_BackupServer) error {
+	data, index, err := s.kv.Backup()
+	if err != nil {
+		return err
+	}
+	term, conf := s.raftNode.BackupMetadata(index)
+	log.Printf("Streaming backup of %d bytes at term %d and index %d\n", len(data), term, index)
+
+	chunkSize := int(req.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = defaultBackupChunkSize
+	}
+	sum := sha256.Sum256(data)
+	for offset := 0; offset == 0 || offset < len(data); offset += chunkSize {
+		chunk := &pb.BackupChunk{Data: data[offset:min(offset+chunkSize, len(data))]}
+		if offset == 0 {
+			chunk.AppliedIndex = index
+			chunk.Term = term
+			chunk.Voters = conf.Voters
+			chunk.Learners = conf.Learners
+			chunk.Size = uint64(len(data))
+		}
+		if offset+chunkSize >= len(data) {
+			chunk.Checksum = hex.EncodeToString(sum[:])
+		}
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *server) Vacuum(ctx context.Context, req *pb.VacuumRequest) (*pb.VacuumResponse, error) {
+	before, err := s.kv.StorageSize()
+	if err != nil {
+		return &pb.VacuumResponse{Status: consts.InternalError, Error: err.Error()}, nil
+	}
+	log.Printf("Vacuuming storage of %d bytes, incremental: %v\n", before, req.Incremental)
+	reclaimed, err := s.kv.Vacuum(req.Incremental)
+	if err != nil {
+		log.Printf("Vacuum failed: %v\n", err)
+		return &pb.VacuumResponse{Status: consts.InternalError, BytesBefore: before, Error: err.Error()}, nil
+	}
+	log.Printf("Vacuum reclaimed %d bytes\n", reclaimed)
+	return &pb.VacuumResponse{
+		Status:         consts.Success,
+		BytesBefore:    before,
+		BytesAfter:     before - reclaimed,
+		BytesReclaimed: reclaimed,
+	}, nil
+}
+
+const (
+	defaultImportBatchBytes = 512 << 10
+	maxImportBatchBytes     = 900 << 10 // keeps a batch within raft's 1 MiB message limit
+	maxImportFailures       = 100
+)
+
+// importReader reads the data of an Import stream as one input.
+type importReader struct {
+	stream pb.KVStoreService_ImportServer
+	buf    []byte
+}
+
+func (r *importReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = req.Data
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Import parses the records of the stream and proposes them in batches of up
+// to batch_bytes, one raft entry each. Malformed records are reported and
+// skipped; the import stops early only if writes are rejected.
+func (s *server) Import(stream pb.KVStoreService_ImportServer) error {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(&pb.ImportResponse{Status: consts.Success})
+	}
+	if err != nil {
+		return err
+	}
+	if !s.raftNode.IsLeader() {
+		// Redirect client to the leader
+		return stream.SendAndClose(&pb.ImportResponse{Status: consts.Redirect, LeaderAddress: s.leaderAddress()})
+	}
+	records, err := service.NewRecordReader(&importReader{stream: stream, buf: first.Data}, service.RecordFormat(first.Format))
+	if err != nil {
+		return stream.SendAndClose(&pb.ImportResponse{Status: consts.InternalError, Error: err.Error()})
+	}
+	batchBytes := int(first.BatchBytes)
+	if batchBytes <= 0 {
+		batchBytes = defaultImportBatchBytes
+	}
+	batchBytes = min(batchBytes, maxImportBatchBytes)
+	log.Printf("Importing %s records in batches of %d bytes\n", first.Format, batchBytes)
+
+	resp := &pb.ImportResponse{Status: consts.Success}
+	fail := func(record int64, err error) {
+		resp.Failed++
+		if len(resp.Failures) < maxImportFailures {
+			resp.Failures = append(resp.Failures, &pb.ImportFailure{Record: record, Error: err.Error()})
+		}
+	}
+	var batch []service.Pair
+	var size int
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := s.kv.PutBatch(batch); err != nil {
+			return err
+		}
+		resp.Imported += int64(len(batch))
+		resp.Batches++
+		if resp.Batches%100 == 0 {
+			log.Printf("Imported %d records in %d batches so far\n", resp.Imported, resp.Batches)
+		}
+		batch, size = nil, 0
+		return nil
+	}
+
+	finish := func(err error) error {
+		if errors.Is(err, service.ErrNoSpace) {
+			resp.Status, resp.Error = consts.NoSpace, err.Error()
+		} else if err != nil {
+			resp.Status, resp.Error = consts.InternalError, err.Error()
+		}
+		log.Printf("Import read %d records: %d imported in %d batches, %d failed\n", resp.Records, resp.Imported, resp.Batches, resp.Failed)
+		return stream.SendAndClose(resp)
+	}
+
+	for {
+		pair, err := records.Next()
+		if err == io.EOF {
+			break
+		}
+		var recordErr *service.RecordError
+		if errors.As(err, &recordErr) {
+			resp.Records++
+			fail(resp.Records, recordErr.Err)
+			continue
+		}
+		if err != nil {
+			log.Printf("Import stream failed after %d records: %v\n", resp.Records, err)
+			return err
+		}
+		resp.Records++
+		if repository.IsReservedKey(pair.Key) {
+			fail(resp.Records, errors.New("key is reserved"))
+			continue
+		}
+		pairSize := len(pair.Key) + len(pair.Value)
+		if size+pairSize > batchBytes {
+			if err := flush(); err != nil {
+				return finish(err)
+			}
+		}
+		batch = append(batch, pair)
+		size += pairSize
+	}
+	return finish(flush())
+}
+
+const defaultExportChunkSize = 1 << 20
+
+// Export streams the pairs under req.Prefix as of a single applied index,
+// in chunks of whole records.
+func (s *server) Export(req *pb.ExportRequest, stream pb.KVStoreService_ExportServer) error {
+	var buf bytes.Buffer
+	w, err := service.NewRecordWriter(&buf, service.RecordFormat(req.Format))
+	if err != nil {
+		return err
+	}
+	chunkSize := int(req.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = defaultExportChunkSize
+	}
+
+	var index uint64
+	var records int
+	chunk := &pb.ExportChunk{}
+	send := func() error {
+		chunk.Data = buf.Bytes()
+		err := stream.Send(chunk)
+		buf.Reset()
+		chunk = &pb.ExportChunk{}
+		return err
+	}
+	err = s.kv.Export(req.Prefix, func(at uint64) error {
+		index = at
+		chunk.AppliedIndex = at
+		log.Printf("Exporting keys with prefix %q at index %d\n", req.Prefix, at)
+		return nil
+	}, func(p service.Pair) error {
+		if err := w.Write(p); err != nil {
+			return err
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		chunk.Records++
+		records++
+		if buf.Len() >= chunkSize {
+			return send()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// The last chunk, or the only one, carrying the index, if nothing matched.
+	if chunk.Records > 0 || records == 0 {
+		if err := send(); err != nil {
+			return err
+		}
+	}
+	log.Printf("Exported %d keys with prefix %q at index %d\n", records, req.Prefix, index)
+	return nil
+}
+
+// Members streams the member registry, then the whole registry again after
+// every change, until the client goes away.
+func (s *server) Members(req *pb.MembersRequest, stream pb.KVStoreService_MembersServer) error {
+	for {
+		members, index, changed, err := clusterMembers(s.kv, s.raftNode)
+		if err != nil {
+			return err
+		}
+		resp := &pb.MembersResponse{AppliedIndex: index}
+		for _, m := range members {
+			resp.Members = append(resp.Members, &pb.Member{Id: m.ID, KvAddress: m.KVAddress, RaftAddress: m.RaftAddress, Learner: m.Learner})
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-changed:
+		}
+	}
+}
@@ -1,35 +1,81 @@
 package main
 
 import (
+	"cs739-kv-store/consts"
 	"cs739-kv-store/raft"
+	"cs739-kv-store/repository"
 	"cs739-kv-store/service"
-	"database/sql"
 	"flag"
-	_ "github.com/mattn/go-sqlite3"
 	"go.etcd.io/etcd/raft/v3/raftpb"
 	"log"
+	"time"
 )
 
 var (
-	port        int
-	serverIp    string
-	nodeID      uint64
-	kvAddresses map[uint64]string
-	raftPeers   map[uint64]string
-	join        bool
-	db          *sql.DB
+	port          int
+	serverIp      string
+	nodeID        uint64
+	kvAddress     string
+	raftAddress   string
+	dataDir       string
+	kvAddresses   map[uint64]string
+	raftPeers     map[uint64]string
+	join          bool
+	rebuild       bool
+	engine        string
+	engineOptions repository.EngineOptions
+	storage       repository.StorageEngine
+	cacheConfig   repository.CacheConfig
+
+	compressThreshold int
+	encryptionKeyFile string
+	keyring           *repository.Keyring
+
+	consistencyCheckInterval time.Duration
+	quotaBytes               int64
 )
 
+// validateFlags exits, naming the flag, if a setting the node cannot run
+// with was given.
+func validateFlags() {
+	switch {
+	case cacheConfig.MaxBytes < 0:
+		log.Fatalf("-cache-bytes must not be negative, got %d", cacheConfig.MaxBytes)
+	case cacheConfig.TTL <= 0:
+		log.Fatalf("-cache-ttl must be positive, got %v", cacheConfig.TTL)
+	case cacheConfig.NegativeTTL < 0:
+		log.Fatalf("-cache-negative-ttl must be zero, to disable negative caching, or positive, got %v", cacheConfig.NegativeTTL)
+	case !repository.IsCachePolicy(cacheConfig.Policy):
+		log.Fatalf("-cache-policy must be %s, %s or %s, got %q", repository.PolicyLRU, repository.PolicyLFU, repository.PolicyTinyLFU, cacheConfig.Policy)
+	}
+}
+
 func main() {
 	// Parse command-line arguments
 	flag.IntVar(&port, "port", 50051, "Server port")
 	flag.StringVar(&serverIp, "ip", "localhost", "Server IP")
 	flag.Uint64Var(&nodeID, "id", 1, "Node ID")
 	flag.BoolVar(&join, "join", false, "Whether to join a new node")
+	flag.StringVar(&kvAddress, "kv-addr", "", "KV address of this node, by default the one in the member registry or config file")
+	flag.StringVar(&raftAddress, "raft-addr", "", "Raft peer URL of this node, by default the one in the member registry or config file")
+	flag.StringVar(&dataDir, "data-dir", repository.DefaultDataDir, "Directory for the node's storage, WAL and snapshots")
+	flag.BoolVar(&rebuild, "rebuild", false, "Recreate the storage engine's data from the snapshots and WAL before starting")
+	flag.StringVar(&engine, "engine", repository.EngineSQLite, "Storage engine: sqlite, bolt or memory")
+	flag.StringVar(&engineOptions.SQLite.JournalMode, "sqlite-journal-mode", "wal", "SQLite journal mode: wal, delete, truncate, persist, memory or off")
+	flag.StringVar(&engineOptions.SQLite.Synchronous, "sqlite-synchronous", "normal", "SQLite synchronous setting: off, normal, full or extra")
+	flag.IntVar(&compressThreshold, "compress-threshold", 0, "Compress values and snapshots of at least this many bytes, 0 to disable")
+	flag.StringVar(&encryptionKeyFile, "encryption-key-file", "", "File of \"<id> <hex key>\" lines to encrypt data at rest with; the first key is active. Defaults to $"+consts.EncryptionKeysEnv)
+	flag.Int64Var(&cacheConfig.MaxBytes, "cache-bytes", 4<<20, "Maximum size of the in-memory cache in bytes")
+	flag.StringVar(&cacheConfig.Policy, "cache-policy", repository.PolicyLRU, "Cache eviction policy: lru, lfu or tinylfu")
+	flag.DurationVar(&cacheConfig.TTL, "cache-ttl", 10*time.Second, "Lifetime of a cached value")
+	flag.DurationVar(&cacheConfig.NegativeTTL, "cache-negative-ttl", 1*time.Second, "Lifetime of a cached missing key, 0 to disable")
+	flag.DurationVar(&consistencyCheckInterval, "consistency-check-interval", time.Minute, "How often the leader compares state hashes across members, 0 to disable")
+	flag.Int64Var(&quotaBytes, "quota-bytes", 2<<30, "Storage size past which the node raises a NOSPACE alarm that stops writes, 0 for no quota")
 	flag.Parse()
-	log.Printf("Node ID: %d, join: %v\n", nodeID, join)
+	validateFlags()
+	log.Printf("Node ID: %d, join: %v, engine: %s\n", nodeID, join, engine)
 
-	initDB(nodeID)
+	initStorage(nodeID)
 	initRaftConfig()
 	initKVConfig()
 
@@ -40,9 +86,20 @@ func main() {
 
 	var kvs *service.Kvstore
 	getSnapshot := func() ([]byte, error) { return kvs.GetSnapshot() }
-	raftNode, commitC, errorC := raft.NewRaftNode(nodeID, raftPeers, join, getSnapshot, proposeC, confChangeC)
-	kvs = service.NewKVStore(<-raftNode.SnapshotterReady, proposeC, commitC, errorC, db)
-	startKVServer(kvs, kvAddresses[nodeID], raftNode, confChangeC, errorC)
+	peers := initialMembers()
+	raftNode, commitC, errorC := raft.NewRaftNode(nodeID, peers, join, dataDir, getSnapshot, proposeC, confChangeC)
+	kvs = service.NewKVStore(<-raftNode.SnapshotterReady, proposeC, commitC, errorC, storage, service.Options{
+		Cache:         cacheConfig,
+		ProposalCodec: proposalCodec(), // keeps the WAL encrypted
+	})
+	if consistencyCheckInterval > 0 {
+		go startConsistencyChecker(kvs, raftNode, consistencyCheckInterval)
+	}
+	if quotaBytes > 0 {
+		go startQuotaMonitor(kvs, quotaBytes)
+	}
+	go syncRaftPeers(kvs, raftNode)
+	startKVServer(kvs, peers[nodeID].KVAddress, raftNode, confChangeC, errorC)
 
 	// Block and wait for exit signals or errors
 	select {}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"cs739-kv-store/models"
+	"cs739-kv-store/raft"
+	"cs739-kv-store/service"
+	"log"
+	"sort"
+	"time"
+)
+
+// initialMembers returns the members raft starts with: those in the config
+// files, overridden by the member registry in storage, and this node with
+// the addresses given by its flags.
+func initialMembers() map[uint64]models.Member {
+	members := make(map[uint64]models.Member, len(raftPeers))
+	for id, address := range raftPeers {
+		members[id] = models.Member{ID: id, KVAddress: kvAddresses[id], RaftAddress: address}
+	}
+	registered, err := service.ReadMembers(storage)
+	if err != nil {
+		log.Fatalf("Failed to read the member registry: %v", err)
+	}
+	for _, m := range registered {
+		members[m.ID] = m
+	}
+
+	self := members[nodeID]
+	self.ID = nodeID
+	if kvAddress != "" {
+		self.KVAddress = kvAddress
+	}
+	if raftAddress != "" {
+		self.RaftAddress = raftAddress
+	}
+	if self.KVAddress == "" || self.RaftAddress == "" {
+		log.Fatalf("No addresses known for node %d, pass -kv-addr and -raft-addr", nodeID)
+	}
+	members[nodeID] = self
+	return members
+}
+
+// syncRaftPeers connects raft to every registered member whenever the
+// registry changes, so a node that caught up from a snapshot reaches the
+// members it only knows from the snapshot's registry.
+func syncRaftPeers(kv *service.Kvstore, raftNode *raft.RaftNode) {
+	for {
+		members, _, changed, err := kv.Members()
+		if err != nil {
+			log.Printf("Failed to read the member registry: %v\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		raftNode.AddPeers(members)
+		<-changed
+	}
+}
+
+// clusterMembers returns the members of the current configuration in ID
+// order. Members added before the registry existed are taken from the
+// config file.
+func clusterMembers(kv *service.Kvstore, raftNode *raft.RaftNode) ([]models.Member, uint64, <-chan struct{}, error) {
+	members, index, changed, err := kv.Members()
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	registered := make(map[uint64]bool, len(members))
+	for _, m := range members {
+		registered[m.ID] = true
+	}
+	for _, id := range raftNode.Members() {
+		if address, ok := kvAddresses[id]; ok && !registered[id] {
+			members = append(members, models.Member{ID: id, KVAddress: address, RaftAddress: raftPeers[id]})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, index, changed, nil
+}
+
+// memberAddress returns the KV address of a member, for redirects and
+// calls between members.
+func memberAddress(kv *service.Kvstore, id uint64) (string, bool) {
+	if m, ok, err := kv.Member(id); err == nil && ok {
+		return m.KVAddress, true
+	}
+	address, ok := kvAddresses[id]
+	return address, ok
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Member is a node of the cluster, as recorded in the member registry.
+type Member struct {
+	ID          uint64 `json:"id"`
+	KVAddress   string `json:"kv_address"`
+	RaftAddress string `json:"raft_address"`
+	Learner     bool   `json:"learner,omitempty"` // replicates the log but does not vote or serve clients yet
+}
+
+// Context encodes the member as the context of the conf change that adds it.
+func (m Member) Context() []byte {
+	data, _ := json.Marshal(m)
+	return data
+}
+
+// ParseMemberContext decodes the context of a conf change adding node id.
+// Contexts written before the registry existed hold only the raft address,
+// and the bootstrap entries of such clusters hold nothing.
+func ParseMemberContext(id uint64, context []byte) Member {
+	var m Member
+	if len(context) > 0 && context[0] == '{' && json.Unmarshal(context, &m) == nil {
+		m.ID = id
+		return m
+	}
+	return Member{ID: id, RaftAddress: strings.TrimSpace(string(context))}
+}
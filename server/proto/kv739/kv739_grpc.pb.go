@@ -26,10 +26,35 @@ type KVStoreServiceClient interface {
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	// Performs a get operation and then stores the specified value.
 	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// Removes a key, returning its previous value.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// Sets a key to a value if it holds the expected value, or if it is
+	// missing and expect_missing is set. It answers once the outcome is applied.
+	CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error)
 	Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error)
 	Close(ctx context.Context, in *CloseRequest, opts ...grpc.CallOption) (*CloseResponse, error)
 	Start(ctx context.Context, in *StartRequest, opts ...grpc.CallOption) (*StartResponse, error)
 	Leave(ctx context.Context, in *LeaveRequest, opts ...grpc.CallOption) (*LeaveResponse, error)
+	// Makes a learner that has caught up with the leader a voting member.
+	Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*PromoteResponse, error)
+	// Moves leadership away from a member to the most up-to-date other voter.
+	TransferLeader(ctx context.Context, in *TransferLeaderRequest, opts ...grpc.CallOption) (*TransferLeaderResponse, error)
+	// Reports node-local runtime information.
+	Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error)
+	// Returns the node's state hash as of a raft index, once it is applied.
+	HashKV(ctx context.Context, in *HashKVRequest, opts ...grpc.CallOption) (*HashKVResponse, error)
+	// Streams a consistent backup of the node's state and raft metadata.
+	Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (KVStoreService_BackupClient, error)
+	// Lists the cluster's active alarms, or clears some of them.
+	Alarm(ctx context.Context, in *AlarmRequest, opts ...grpc.CallOption) (*AlarmResponse, error)
+	// Reclaims free space in the node's own storage.
+	Vacuum(ctx context.Context, in *VacuumRequest, opts ...grpc.CallOption) (*VacuumResponse, error)
+	// Loads a stream of key/value records through raft in large batches.
+	Import(ctx context.Context, opts ...grpc.CallOption) (KVStoreService_ImportClient, error)
+	// Streams a consistent dump of the key space, optionally filtered by prefix.
+	Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (KVStoreService_ExportClient, error)
+	// Streams the cluster's member registry, once now and again on every change.
+	Members(ctx context.Context, in *MembersRequest, opts ...grpc.CallOption) (KVStoreService_MembersClient, error)
 }
 
 type kVStoreServiceClient struct {
@@ -58,6 +83,24 @@ func (c *kVStoreServiceClient) Put(ctx context.Context, in *PutRequest, opts ...
 	return out, nil
 }
 
+func (c *kVStoreServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Delete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) CompareAndSwap(ctx context.Context, in *CompareAndSwapRequest, opts ...grpc.CallOption) (*CompareAndSwapResponse, error) {
+	out := new(CompareAndSwapResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/CompareAndSwap", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *kVStoreServiceClient) Ping(ctx context.Context, in *PingRequest, opts ...grpc.CallOption) (*PingResponse, error) {
 	out := new(PingResponse)
 	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Ping", in, out, opts...)
@@ -94,6 +137,190 @@ func (c *kVStoreServiceClient) Leave(ctx context.Context, in *LeaveRequest, opts
 	return out, nil
 }
 
+func (c *kVStoreServiceClient) Promote(ctx context.Context, in *PromoteRequest, opts ...grpc.CallOption) (*PromoteResponse, error) {
+	out := new(PromoteResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Promote", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) TransferLeader(ctx context.Context, in *TransferLeaderRequest, opts ...grpc.CallOption) (*TransferLeaderResponse, error) {
+	out := new(TransferLeaderResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/TransferLeader", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) Status(ctx context.Context, in *StatusRequest, opts ...grpc.CallOption) (*StatusResponse, error) {
+	out := new(StatusResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Status", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) HashKV(ctx context.Context, in *HashKVRequest, opts ...grpc.CallOption) (*HashKVResponse, error) {
+	out := new(HashKVResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/HashKV", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) Backup(ctx context.Context, in *BackupRequest, opts ...grpc.CallOption) (KVStoreService_BackupClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KVStoreService_ServiceDesc.Streams[0], "/kv739.KVStoreService/Backup", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVStoreServiceBackupClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVStoreService_BackupClient interface {
+	Recv() (*BackupChunk, error)
+	grpc.ClientStream
+}
+
+type kVStoreServiceBackupClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVStoreServiceBackupClient) Recv() (*BackupChunk, error) {
+	m := new(BackupChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVStoreServiceClient) Alarm(ctx context.Context, in *AlarmRequest, opts ...grpc.CallOption) (*AlarmResponse, error) {
+	out := new(AlarmResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Alarm", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) Vacuum(ctx context.Context, in *VacuumRequest, opts ...grpc.CallOption) (*VacuumResponse, error) {
+	out := new(VacuumResponse)
+	err := c.cc.Invoke(ctx, "/kv739.KVStoreService/Vacuum", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kVStoreServiceClient) Import(ctx context.Context, opts ...grpc.CallOption) (KVStoreService_ImportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KVStoreService_ServiceDesc.Streams[1], "/kv739.KVStoreService/Import", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVStoreServiceImportClient{stream}
+	return x, nil
+}
+
+type KVStoreService_ImportClient interface {
+	Send(*ImportRequest) error
+	CloseAndRecv() (*ImportResponse, error)
+	grpc.ClientStream
+}
+
+type kVStoreServiceImportClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVStoreServiceImportClient) Send(m *ImportRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *kVStoreServiceImportClient) CloseAndRecv() (*ImportResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVStoreServiceClient) Export(ctx context.Context, in *ExportRequest, opts ...grpc.CallOption) (KVStoreService_ExportClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KVStoreService_ServiceDesc.Streams[2], "/kv739.KVStoreService/Export", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVStoreServiceExportClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVStoreService_ExportClient interface {
+	Recv() (*ExportChunk, error)
+	grpc.ClientStream
+}
+
+type kVStoreServiceExportClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVStoreServiceExportClient) Recv() (*ExportChunk, error) {
+	m := new(ExportChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *kVStoreServiceClient) Members(ctx context.Context, in *MembersRequest, opts ...grpc.CallOption) (KVStoreService_MembersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &KVStoreService_ServiceDesc.Streams[3], "/kv739.KVStoreService/Members", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &kVStoreServiceMembersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type KVStoreService_MembersClient interface {
+	Recv() (*MembersResponse, error)
+	grpc.ClientStream
+}
+
+type kVStoreServiceMembersClient struct {
+	grpc.ClientStream
+}
+
+func (x *kVStoreServiceMembersClient) Recv() (*MembersResponse, error) {
+	m := new(MembersResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // KVStoreServiceServer is the server API for KVStoreService service.
 // All implementations must embed UnimplementedKVStoreServiceServer
 // for forward compatibility
@@ -102,10 +329,35 @@ type KVStoreServiceServer interface {
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	// Performs a get operation and then stores the specified value.
 	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// Removes a key, returning its previous value.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// Sets a key to a value if it holds the expected value, or if it is
+	// missing and expect_missing is set. It answers once the outcome is applied.
+	CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error)
 	Ping(context.Context, *PingRequest) (*PingResponse, error)
 	Close(context.Context, *CloseRequest) (*CloseResponse, error)
 	Start(context.Context, *StartRequest) (*StartResponse, error)
 	Leave(context.Context, *LeaveRequest) (*LeaveResponse, error)
+	// Makes a learner that has caught up with the leader a voting member.
+	Promote(context.Context, *PromoteRequest) (*PromoteResponse, error)
+	// Moves leadership away from a member to the most up-to-date other voter.
+	TransferLeader(context.Context, *TransferLeaderRequest) (*TransferLeaderResponse, error)
+	// Reports node-local runtime information.
+	Status(context.Context, *StatusRequest) (*StatusResponse, error)
+	// Returns the node's state hash as of a raft index, once it is applied.
+	HashKV(context.Context, *HashKVRequest) (*HashKVResponse, error)
+	// Streams a consistent backup of the node's state and raft metadata.
+	Backup(*BackupRequest, KVStoreService_BackupServer) error
+	// Lists the cluster's active alarms, or clears some of them.
+	Alarm(context.Context, *AlarmRequest) (*AlarmResponse, error)
+	// Reclaims free space in the node's own storage.
+	Vacuum(context.Context, *VacuumRequest) (*VacuumResponse, error)
+	// Loads a stream of key/value records through raft in large batches.
+	Import(KVStoreService_ImportServer) error
+	// Streams a consistent dump of the key space, optionally filtered by prefix.
+	Export(*ExportRequest, KVStoreService_ExportServer) error
+	// Streams the cluster's member registry, once now and again on every change.
+	Members(*MembersRequest, KVStoreService_MembersServer) error
 	mustEmbedUnimplementedKVStoreServiceServer()
 }
 
@@ -119,6 +371,12 @@ func (UnimplementedKVStoreServiceServer) Get(context.Context, *GetRequest) (*Get
 func (UnimplementedKVStoreServiceServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
 }
+func (UnimplementedKVStoreServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedKVStoreServiceServer) CompareAndSwap(context.Context, *CompareAndSwapRequest) (*CompareAndSwapResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSwap not implemented")
+}
 func (UnimplementedKVStoreServiceServer) Ping(context.Context, *PingRequest) (*PingResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
@@ -131,6 +389,36 @@ func (UnimplementedKVStoreServiceServer) Start(context.Context, *StartRequest) (
 func (UnimplementedKVStoreServiceServer) Leave(context.Context, *LeaveRequest) (*LeaveResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Leave not implemented")
 }
+func (UnimplementedKVStoreServiceServer) Promote(context.Context, *PromoteRequest) (*PromoteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Promote not implemented")
+}
+func (UnimplementedKVStoreServiceServer) TransferLeader(context.Context, *TransferLeaderRequest) (*TransferLeaderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TransferLeader not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Status(context.Context, *StatusRequest) (*StatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Status not implemented")
+}
+func (UnimplementedKVStoreServiceServer) HashKV(context.Context, *HashKVRequest) (*HashKVResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method HashKV not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Backup(*BackupRequest, KVStoreService_BackupServer) error {
+	return status.Errorf(codes.Unimplemented, "method Backup not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Alarm(context.Context, *AlarmRequest) (*AlarmResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Alarm not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Vacuum(context.Context, *VacuumRequest) (*VacuumResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Vacuum not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Import(KVStoreService_ImportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Import not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Export(*ExportRequest, KVStoreService_ExportServer) error {
+	return status.Errorf(codes.Unimplemented, "method Export not implemented")
+}
+func (UnimplementedKVStoreServiceServer) Members(*MembersRequest, KVStoreService_MembersServer) error {
+	return status.Errorf(codes.Unimplemented, "method Members not implemented")
+}
 func (UnimplementedKVStoreServiceServer) mustEmbedUnimplementedKVStoreServiceServer() {}
 
 // UnsafeKVStoreServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -180,6 +468,42 @@ func _KVStoreService_Put_Handler(srv interface{}, ctx context.Context, dec func(
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KVStoreService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/Delete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_CompareAndSwap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompareAndSwapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).CompareAndSwap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/CompareAndSwap",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).CompareAndSwap(ctx, req.(*CompareAndSwapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _KVStoreService_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(PingRequest)
 	if err := dec(in); err != nil {
@@ -252,6 +576,203 @@ func _KVStoreService_Leave_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _KVStoreService_Promote_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PromoteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).Promote(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/Promote",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).Promote(ctx, req.(*PromoteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_TransferLeader_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TransferLeaderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).TransferLeader(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/TransferLeader",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).TransferLeader(ctx, req.(*TransferLeaderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_Status_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).Status(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/Status",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).Status(ctx, req.(*StatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_HashKV_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HashKVRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).HashKV(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/HashKV",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).HashKV(ctx, req.(*HashKVRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_Backup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(BackupRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVStoreServiceServer).Backup(m, &kVStoreServiceBackupServer{stream})
+}
+
+type KVStoreService_BackupServer interface {
+	Send(*BackupChunk) error
+	grpc.ServerStream
+}
+
+type kVStoreServiceBackupServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVStoreServiceBackupServer) Send(m *BackupChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KVStoreService_Alarm_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AlarmRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).Alarm(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/Alarm",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).Alarm(ctx, req.(*AlarmRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_Vacuum_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(VacuumRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KVStoreServiceServer).Vacuum(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/kv739.KVStoreService/Vacuum",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KVStoreServiceServer).Vacuum(ctx, req.(*VacuumRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KVStoreService_Import_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(KVStoreServiceServer).Import(&kVStoreServiceImportServer{stream})
+}
+
+type KVStoreService_ImportServer interface {
+	SendAndClose(*ImportResponse) error
+	Recv() (*ImportRequest, error)
+	grpc.ServerStream
+}
+
+type kVStoreServiceImportServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVStoreServiceImportServer) SendAndClose(m *ImportResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *kVStoreServiceImportServer) Recv() (*ImportRequest, error) {
+	m := new(ImportRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _KVStoreService_Export_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVStoreServiceServer).Export(m, &kVStoreServiceExportServer{stream})
+}
+
+type KVStoreService_ExportServer interface {
+	Send(*ExportChunk) error
+	grpc.ServerStream
+}
+
+type kVStoreServiceExportServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVStoreServiceExportServer) Send(m *ExportChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _KVStoreService_Members_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MembersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KVStoreServiceServer).Members(m, &kVStoreServiceMembersServer{stream})
+}
+
+type KVStoreService_MembersServer interface {
+	Send(*MembersResponse) error
+	grpc.ServerStream
+}
+
+type kVStoreServiceMembersServer struct {
+	grpc.ServerStream
+}
+
+func (x *kVStoreServiceMembersServer) Send(m *MembersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // KVStoreService_ServiceDesc is the grpc.ServiceDesc for KVStoreService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -267,6 +788,14 @@ var KVStoreService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Put",
 			Handler:    _KVStoreService_Put_Handler,
 		},
+		{
+			MethodName: "Delete",
+			Handler:    _KVStoreService_Delete_Handler,
+		},
+		{
+			MethodName: "CompareAndSwap",
+			Handler:    _KVStoreService_CompareAndSwap_Handler,
+		},
 		{
 			MethodName: "Ping",
 			Handler:    _KVStoreService_Ping_Handler,
@@ -283,7 +812,52 @@ var KVStoreService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Leave",
 			Handler:    _KVStoreService_Leave_Handler,
 		},
+		{
+			MethodName: "Promote",
+			Handler:    _KVStoreService_Promote_Handler,
+		},
+		{
+			MethodName: "TransferLeader",
+			Handler:    _KVStoreService_TransferLeader_Handler,
+		},
+		{
+			MethodName: "Status",
+			Handler:    _KVStoreService_Status_Handler,
+		},
+		{
+			MethodName: "HashKV",
+			Handler:    _KVStoreService_HashKV_Handler,
+		},
+		{
+			MethodName: "Alarm",
+			Handler:    _KVStoreService_Alarm_Handler,
+		},
+		{
+			MethodName: "Vacuum",
+			Handler:    _KVStoreService_Vacuum_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Backup",
+			Handler:       _KVStoreService_Backup_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Import",
+			Handler:       _KVStoreService_Import_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Export",
+			Handler:       _KVStoreService_Export_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Members",
+			Handler:       _KVStoreService_Members_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/kv739.proto",
 }
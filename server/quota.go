@@ -0,0 +1,38 @@
+package main
+
+import (
+	"cs739-kv-store/service"
+	"fmt"
+	"log"
+	"time"
+)
+
+// quotaCheckInterval is how often a node compares its storage size to the quota.
+const quotaCheckInterval = 5 * time.Second
+
+// startQuotaMonitor raises a NOSPACE alarm for this node whenever its
+// storage is larger than quota. The alarm stops writes across the cluster;
+// an operator clears it once space has been reclaimed, and it is raised
+// again on the next check if the storage is still too large.
+func startQuotaMonitor(kv *service.Kvstore, quota int64) {
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		checkQuota(kv, quota)
+	}
+}
+
+func checkQuota(kv *service.Kvstore, quota int64) {
+	size, err := kv.StorageSize()
+	if err != nil {
+		log.Printf("Quota check: failed to get storage size: %v\n", err)
+		return
+	}
+	if size <= quota {
+		return
+	}
+	detail := fmt.Sprintf("storage is %d bytes, quota is %d bytes", size, quota)
+	if err := kv.RaiseAlarm(service.AlarmNoSpace, nodeID, detail); err != nil {
+		log.Printf("Quota check: failed to raise alarm: %v\n", err)
+	}
+}
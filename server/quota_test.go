@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"cs739-kv-store/consts"
+	pb "cs739-kv-store/proto/kv739"
+	"cs739-kv-store/service"
+	"errors"
+	"testing"
+)
+
+func TestQuotaAlarmStopsWritesUntilCleared(t *testing.T) {
+	oldNodeID := nodeID
+	t.Cleanup(func() { nodeID = oldNodeID })
+	nodeID = 1
+	kv := newCommittedStore(t)
+	if _, _, err := kv.Put("k", "value"); err != nil {
+		t.Fatal(err)
+	}
+	waitApplied(t, kv)
+
+	checkQuota(kv, 1<<20)
+	waitApplied(t, kv)
+	if noSpace, _ := kv.HasAlarm(service.AlarmNoSpace); noSpace {
+		t.Fatal("NOSPACE raised under the quota")
+	}
+
+	checkQuota(kv, 1)
+	waitApplied(t, kv)
+	alarms, err := kv.Alarms()
+	if err != nil || len(alarms) != 1 || alarms[0].Type != service.AlarmNoSpace || alarms[0].Member != 1 {
+		t.Fatalf("alarms = %+v, %v; want NOSPACE for member 1", alarms, err)
+	}
+	if _, _, err := kv.Put("k", "bigger value"); !errors.Is(err, service.ErrNoSpace) {
+		t.Fatalf("Put over the quota = %v, want ErrNoSpace", err)
+	}
+
+	resp, err := (&server{kv: kv}).Alarm(context.Background(), &pb.AlarmRequest{Action: pb.AlarmRequest_CLEAR, Type: service.AlarmNoSpace})
+	if err != nil || resp.Status != consts.Success || len(resp.Alarms) != 0 {
+		t.Fatalf("Alarm clear = %v, %v; want success with no alarms left", resp, err)
+	}
+	if _, _, err := kv.Put("k", "bigger value"); err != nil {
+		t.Fatalf("Put after clearing the alarm = %v", err)
+	}
+}
@@ -2,12 +2,14 @@ package raft
 
 import (
 	"context"
+	"cs739-kv-store/models"
 	"fmt"
 	"go.etcd.io/etcd/raft/v3"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"sync"
 	"time"
 
 	"go.etcd.io/etcd/client/pkg/v3/fileutil"
@@ -23,8 +25,13 @@ import (
 )
 
 type Commit struct {
-	Data       []string
-	ApplyDoneC chan<- struct{}
+	Data    []string
+	Indexes []uint64 // raft index of each entry in Data
+	// ConfChanges is nil unless the commit holds conf changes. Where it has
+	// one, the entry at the same position is that conf change and its Data
+	// is empty.
+	ConfChanges []*raftpb.ConfChange
+	ApplyDoneC  chan<- struct{}
 }
 
 // A key-value stream backed by raft
@@ -34,14 +41,15 @@ type RaftNode struct {
 	CommitC     chan<- *Commit           // entries committed to log (k,v)
 	ErrorC      chan<- error             // errors from raft session
 
-	id          uint64            // client ID for raft session
-	peers       map[uint64]string // raft peer URLs
-	join        bool              // node is joining an existing cluster
-	waldir      string            // path to WAL directory
-	snapdir     string            // path to snapshot directory
+	id          uint64                   // client ID for raft session
+	peers       map[uint64]models.Member // initial members, and this node
+	join        bool                     // node is joining an existing cluster
+	waldir      string                   // path to WAL directory
+	snapdir     string                   // path to snapshot directory
 	getSnapshot func() ([]byte, error)
 
 	confState     raftpb.ConfState
+	removed       sync.Map // IDs of members removed from the cluster
 	snapshotIndex uint64
 	appliedIndex  uint64
 
@@ -53,11 +61,12 @@ type RaftNode struct {
 	snapshotter      *snap.Snapshotter
 	SnapshotterReady chan *snap.Snapshotter // signals when snapshotter is ready
 
-	snapCount uint64
-	transport *rafthttp.Transport
-	stopc     chan struct{} // signals proposal channel closed
-	httpstopc chan struct{} // signals http server to shutdown
-	httpdonec chan struct{} // signals http server shutdown complete
+	snapCount      uint64
+	transport      *rafthttp.Transport
+	transportReady chan struct{} // closed once transport is set up
+	stopc          chan struct{} // signals proposal channel closed
+	httpstopc      chan struct{} // signals http server to shutdown
+	httpdonec      chan struct{} // signals http server shutdown complete
 
 	logger *zap.Logger
 }
@@ -69,7 +78,7 @@ var defaultSnapshotCount uint64 = 10000
 // provided the proposal channel. All log entries are replayed over the
 // Commit channel, followed by a nil message (to indicate the channel is
 // current), then new log entries. To shutdown, close proposeC and read ErrorC.
-func NewRaftNode(id uint64, peers map[uint64]string, join bool, getSnapshot func() ([]byte, error), proposeC <-chan string,
+func NewRaftNode(id uint64, peers map[uint64]models.Member, join bool, dataDir string, getSnapshot func() ([]byte, error), proposeC <-chan string,
 	confChangeC <-chan raftpb.ConfChange) (*RaftNode, <-chan *Commit, <-chan error) {
 	commitC := make(chan *Commit)
 	errorC := make(chan error)
@@ -82,14 +91,16 @@ func NewRaftNode(id uint64, peers map[uint64]string, join bool, getSnapshot func
 		id:          id,
 		peers:       peers,
 		join:        join,
-		waldir:      fmt.Sprintf("./storage/wal-%d", id),
-		snapdir:     fmt.Sprintf("./storage/snap-%d", id),
+		waldir:      fmt.Sprintf("%s/wal-%d", dataDir, id),
+		snapdir:     fmt.Sprintf("%s/snap-%d", dataDir, id),
 		getSnapshot: getSnapshot,
 		snapCount:   defaultSnapshotCount,
 		stopc:       make(chan struct{}),
 		httpstopc:   make(chan struct{}),
 		httpdonec:   make(chan struct{}),
 
+		transportReady: make(chan struct{}),
+
 		logger: zap.NewExample(),
 
 		SnapshotterReady: make(chan *snap.Snapshotter, 1),
@@ -139,6 +150,8 @@ func (rc *RaftNode) publishEntries(ents []raftpb.Entry) (<-chan struct{}, bool)
 	}
 
 	data := make([]string, 0, len(ents))
+	indexes := make([]uint64, 0, len(ents))
+	var confChanges []*raftpb.ConfChange
 	for i := range ents {
 		switch ents[i].Type {
 		case raftpb.EntryNormal:
@@ -148,22 +161,40 @@ func (rc *RaftNode) publishEntries(ents []raftpb.Entry) (<-chan struct{}, bool)
 			}
 			s := string(ents[i].Data)
 			data = append(data, s)
+			indexes = append(indexes, ents[i].Index)
+			if confChanges != nil {
+				confChanges = append(confChanges, nil)
+			}
 		case raftpb.EntryConfChange:
 			var cc raftpb.ConfChange
 			cc.Unmarshal(ents[i].Data)
 			rc.confState = *rc.node.ApplyConfChange(cc)
 			switch cc.Type {
-			case raftpb.ConfChangeAddNode:
-				if len(cc.Context) > 0 {
-					rc.transport.AddPeer(types.ID(cc.NodeID), []string{string(cc.Context)})
+			case raftpb.ConfChangeAddNode, raftpb.ConfChangeAddLearnerNode:
+				member := models.ParseMemberContext(cc.NodeID, cc.Context)
+				rc.removed.Delete(cc.NodeID)
+				if member.RaftAddress != "" && cc.NodeID != rc.id {
+					rc.transport.AddPeer(types.ID(cc.NodeID), []string{member.RaftAddress})
 				}
 			case raftpb.ConfChangeRemoveNode:
 				if cc.NodeID == rc.id {
 					log.Println("I've been removed from the cluster! Shutting down.")
 					return nil, false
 				}
-				rc.transport.RemovePeer(types.ID(cc.NodeID))
+				rc.removed.Store(cc.NodeID, true)
+				// Members that never had an address, or were removed before
+				// they were added, are unknown to the transport.
+				if rc.transport.Get(types.ID(cc.NodeID)) != nil {
+					rc.transport.RemovePeer(types.ID(cc.NodeID))
+				}
 			}
+			// The state machine keeps the member registry.
+			if confChanges == nil {
+				confChanges = make([]*raftpb.ConfChange, len(data), len(ents))
+			}
+			data = append(data, "")
+			indexes = append(indexes, ents[i].Index)
+			confChanges = append(confChanges, &cc)
 		}
 	}
 
@@ -172,7 +203,7 @@ func (rc *RaftNode) publishEntries(ents []raftpb.Entry) (<-chan struct{}, bool)
 	if len(data) > 0 {
 		applyDoneC = make(chan struct{}, 1)
 		select {
-		case rc.CommitC <- &Commit{data, applyDoneC}:
+		case rc.CommitC <- &Commit{data, indexes, confChanges, applyDoneC}:
 		case <-rc.stopc:
 			return nil, false
 		}
@@ -270,8 +301,8 @@ func (rc *RaftNode) startRaft() {
 	rc.SnapshotterReady <- rc.snapshotter
 
 	var rpeers []raft.Peer
-	for id, _ := range rc.peers {
-		rpeers = append(rpeers, raft.Peer{ID: id})
+	for id, member := range rc.peers {
+		rpeers = append(rpeers, raft.Peer{ID: id, Context: member.Context()})
 	}
 	c := &raft.Config{
 		ID:                        rc.id,
@@ -300,11 +331,12 @@ func (rc *RaftNode) startRaft() {
 	}
 
 	rc.transport.Start()
-	for id, addr := range rc.peers {
+	for id, member := range rc.peers {
 		if id != rc.id {
-			rc.transport.AddPeer(types.ID(id), []string{addr})
+			rc.transport.AddPeer(types.ID(id), []string{member.RaftAddress})
 		}
 	}
+	close(rc.transportReady)
 
 	go rc.serveRaft()
 	go rc.serveChannels()
@@ -458,6 +490,13 @@ func (rc *RaftNode) serveChannels() {
 			rc.node.Advance()
 
 		case err := <-rc.transport.ErrorC:
+			if err.Error() == memberRemovedMessage {
+				// The leader stops replicating to a member once it removes
+				// it, so this node may never apply its own removal.
+				log.Println("A peer reports I've been removed from the cluster! Shutting down.")
+				rc.Stop()
+				os.Exit(0)
+			}
 			rc.writeError(err)
 			return
 
@@ -481,7 +520,7 @@ func (rc *RaftNode) processMessages(ms []raftpb.Message) []raftpb.Message {
 }
 
 func (rc *RaftNode) serveRaft() {
-	url, err := url.Parse(rc.peers[rc.id])
+	url, err := url.Parse(rc.peers[rc.id].RaftAddress)
 	if err != nil {
 		log.Fatalf("raft: Failed parsing URL (%v)", err)
 	}
@@ -500,6 +539,17 @@ func (rc *RaftNode) serveRaft() {
 	close(rc.httpdonec)
 }
 
+// AddPeers connects the transport to members it does not know yet, such as
+// those a restored snapshot's registry lists.
+func (rc *RaftNode) AddPeers(members []models.Member) {
+	<-rc.transportReady
+	for _, m := range members {
+		if m.ID != rc.id && m.RaftAddress != "" && rc.transport.Get(types.ID(m.ID)) == nil {
+			rc.transport.AddPeer(types.ID(m.ID), []string{m.RaftAddress})
+		}
+	}
+}
+
 func (rc *RaftNode) GetId() uint64 {
 	return rc.id
 }
@@ -512,10 +562,114 @@ func (rc *RaftNode) GetLeader() uint64 {
 	return rc.node.Status().Lead
 }
 
+// TransferLeadership hands leadership to the voter whose log is most up to
+// date and waits until it has taken over. It returns the new leader.
+func (rc *RaftNode) TransferLeadership(ctx context.Context) (uint64, error) {
+	status := rc.node.Status()
+	if status.Lead != rc.id {
+		return status.Lead, fmt.Errorf("node %d is not the leader", rc.id)
+	}
+	var transferee, match uint64
+	for id, pr := range status.Progress {
+		if id != rc.id && !pr.IsLearner && (transferee == 0 || pr.Match > match) {
+			transferee, match = id, pr.Match
+		}
+	}
+	if transferee == 0 {
+		return rc.id, fmt.Errorf("no other voter to transfer leadership to")
+	}
+
+	log.Printf("Transferring leadership to %d\n", transferee)
+	rc.node.TransferLeadership(ctx, rc.id, transferee)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return rc.GetLeader(), fmt.Errorf("leadership transfer to %d: %w", transferee, ctx.Err())
+		case <-ticker.C:
+			if lead := rc.GetLeader(); lead != rc.id && lead != raft.None {
+				return lead, nil
+			}
+		}
+	}
+}
+
+// BackupMetadata returns the term of the entry at index, or the current term
+// if that entry was compacted, and the current membership.
+func (rc *RaftNode) BackupMetadata(index uint64) (uint64, raftpb.ConfState) {
+	status := rc.node.Status()
+	term, err := rc.raftStorage.Term(index)
+	if err != nil {
+		term = status.Term
+	}
+	conf := raftpb.ConfState{
+		Voters:         status.Config.Voters[0].Slice(),
+		VotersOutgoing: status.Config.Voters[1].Slice(),
+		AutoLeave:      status.Config.AutoLeave,
+	}
+	for id := range status.Config.Learners {
+		conf.Learners = append(conf.Learners, id)
+	}
+	return term, conf
+}
+
+// Members returns the IDs of the voters and learners in the current configuration.
+func (rc *RaftNode) Members() []uint64 {
+	status := rc.node.Status()
+	ids := make([]uint64, 0, len(status.Config.Voters[0])+len(status.Config.Learners))
+	for id := range status.Config.Voters.IDs() {
+		ids = append(ids, id)
+	}
+	for id := range status.Config.Learners {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Progress returns how far the leader knows member id has replicated the
+// log, the leader's commit index, and whether id is a learner. It returns ok
+// false unless this node is the leader and id is a member.
+func (rc *RaftNode) Progress(id uint64) (match, commit uint64, learner, ok bool) {
+	status := rc.node.Status()
+	pr, ok := status.Progress[id]
+	if !ok {
+		return 0, status.Commit, false, false
+	}
+	return pr.Match, status.Commit, pr.IsLearner, true
+}
+
+// memberRemovedMessage is the error rafthttp reports, without exporting it,
+// once a peer rejects this node as removed.
+const memberRemovedMessage = "the member has been permanently removed from the cluster"
+
+// removedError rejects a message from a removed member. rafthttp writes it
+// as 403 Forbidden, which the sender reports as its removal.
+type removedError struct{ from uint64 }
+
+func (e removedError) Error() string {
+	return fmt.Sprintf("message from removed member %x", e.from)
+}
+
+func (e removedError) WriteTo(w http.ResponseWriter) {
+	http.Error(w, e.Error(), http.StatusForbidden)
+}
+
 func (rc *RaftNode) Process(ctx context.Context, m raftpb.Message) error {
+	if rc.IsIDRemoved(m.From) {
+		return removedError{m.From}
+	}
 	return rc.node.Step(ctx, m)
 }
-func (rc *RaftNode) IsIDRemoved(_ uint64) bool   { return false }
+
+// IsIDRemoved reports whether id was removed from the cluster. rafthttp
+// turns away its streams, so a removed member learns it even though it never
+// applies its own removal.
+func (rc *RaftNode) IsIDRemoved(id uint64) bool {
+	_, ok := rc.removed.Load(id)
+	return ok
+}
+
 func (rc *RaftNode) ReportUnreachable(id uint64) { rc.node.ReportUnreachable(id) }
 func (rc *RaftNode) ReportSnapshot(id uint64, status raft.SnapshotStatus) {
 	rc.node.ReportSnapshot(id, status)
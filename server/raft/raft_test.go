@@ -1,6 +1,9 @@
 package raft
 
 import (
+	"context"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
 
@@ -114,3 +117,23 @@ func TestProcessMessages(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessRejectsRemovedMember(t *testing.T) {
+	rc := &RaftNode{}
+	rc.removed.Store(uint64(3), true)
+
+	err := rc.Process(context.Background(), raftpb.Message{Type: raftpb.MsgHeartbeatResp, From: 3, To: 1})
+	rejection, ok := err.(interface{ WriteTo(http.ResponseWriter) })
+	if !ok {
+		t.Fatalf("Process = %v, want an error rafthttp writes as the response", err)
+	}
+	// rafthttp reports 403 Forbidden to the sender as its removal.
+	w := httptest.NewRecorder()
+	rejection.WriteTo(w)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+	if rc.IsIDRemoved(2) {
+		t.Fatal("member 2 is reported removed")
+	}
+}
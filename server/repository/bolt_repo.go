@@ -0,0 +1,175 @@
+package repository
+
+import (
+	"bytes"
+	"cs739-kv-store/models"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var kvBucket = []byte("kv")
+
+// boltInitialMmapSize is mapped up front so that, until the file outgrows
+// it, writers never remap the file and so never wait for open views.
+const boltInitialMmapSize = 1 << 30
+
+// BoltRepo implements StorageEngine on top of a bbolt database file.
+type BoltRepo struct {
+	db *bolt.DB
+}
+
+// OpenBoltRepo opens the bbolt database at path and creates the kv bucket if needed.
+func OpenBoltRepo(path string) (*BoltRepo, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second, InitialMmapSize: boltInitialMmapSize})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(kvBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltRepo{db: db}, nil
+}
+
+func (r *BoltRepo) Get(key string) (string, bool, error) {
+	var value string
+	var found bool
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if v := tx.Bucket(kvBucket).Get([]byte(key)); v != nil {
+			value, found = string(v), true
+		}
+		return nil
+	})
+	return value, found, err
+}
+
+func (r *BoltRepo) Put(key, value string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvBucket).Put([]byte(key), []byte(value))
+	})
+}
+
+func (r *BoltRepo) Delete(key string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvBucket).Delete([]byte(key))
+	})
+}
+
+func (r *BoltRepo) Range(start, end string, fn func(key, value string) bool) error {
+	return r.db.View(func(tx *bolt.Tx) error {
+		rangeBucket(tx, start, end, fn)
+		return nil
+	})
+}
+
+func rangeBucket(tx *bolt.Tx, start, end string, fn func(key, value string) bool) {
+	c := tx.Bucket(kvBucket).Cursor()
+	for k, v := c.Seek([]byte(start)); k != nil; k, v = c.Next() {
+		if end != "" && bytes.Compare(k, []byte(end)) >= 0 {
+			break
+		}
+		if !fn(string(k), string(v)) {
+			break
+		}
+	}
+}
+
+// View holds a read transaction. Writes go on, but once the file outgrows
+// boltInitialMmapSize, one that needs to grow it waits for the view to close.
+func (r *BoltRepo) View() (View, error) {
+	tx, err := r.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return boltView{tx: tx}, nil
+}
+
+type boltView struct {
+	tx *bolt.Tx
+}
+
+func (v boltView) Range(start, end string, fn func(key, value string) bool) error {
+	rangeBucket(v.tx, start, end, fn)
+	return nil
+}
+
+func (v boltView) Close() error {
+	return v.tx.Rollback()
+}
+
+func (r *BoltRepo) Batch(ops []Op) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(kvBucket)
+		for _, op := range ops {
+			var err error
+			switch op.Type {
+			case OpPut:
+				err = b.Put([]byte(op.Key), []byte(op.Value))
+			case OpDelete:
+				err = b.Delete([]byte(op.Key))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot serializes all data to JSON, in the same format as RDSRepo.
+func (r *BoltRepo) Snapshot() ([]byte, error) {
+	var kvPairs []models.KVPair
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(kvBucket).ForEach(func(k, v []byte) error {
+			kvPairs = append(kvPairs, models.KVPair{Key: string(k), Value: string(v)})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(kvPairs)
+}
+
+// Restore replaces the contents of the bucket with the JSON data.
+func (r *BoltRepo) Restore(data []byte) error {
+	var kvPairs []models.KVPair
+	if err := json.Unmarshal(data, &kvPairs); err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(kvBucket); err != nil {
+			return err
+		}
+		b, err := tx.CreateBucket(kvBucket)
+		if err != nil {
+			return err
+		}
+		for _, kv := range kvPairs {
+			if err := b.Put([]byte(kv.Key), []byte(kv.Value)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *BoltRepo) Size() (int64, error) {
+	var size int64
+	err := r.db.View(func(tx *bolt.Tx) error {
+		size = tx.Size()
+		return nil
+	})
+	return size, err
+}
+
+func (r *BoltRepo) Close() error {
+	return r.db.Close()
+}
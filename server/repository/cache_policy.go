@@ -0,0 +1,268 @@
+package repository
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+)
+
+const (
+	PolicyLRU     = "lru"
+	PolicyLFU     = "lfu"
+	PolicyTinyLFU = "tinylfu"
+)
+
+// evictionPolicy decides which cached key MemoryRepo drops when it runs out of room.
+// MemoryRepo serializes all calls.
+type evictionPolicy interface {
+	// record notes a lookup of key, whether or not it is cached.
+	record(key string)
+	// add starts tracking a newly cached key.
+	add(key string)
+	// touch notes an access to a cached key.
+	touch(key string)
+	// remove stops tracking key.
+	remove(key string)
+	// victim returns the key that should be evicted next.
+	victim() (string, bool)
+	// admit reports whether candidate is worth caching at the cost of evicting victim.
+	admit(candidate, victim string) bool
+	// reset stops tracking all keys.
+	reset()
+}
+
+// IsCachePolicy reports whether name is an eviction policy, "" meaning lru.
+func IsCachePolicy(name string) bool {
+	switch name {
+	case PolicyLRU, PolicyLFU, PolicyTinyLFU, "":
+		return true
+	}
+	return false
+}
+
+func newEvictionPolicy(name string, expectedEntries int) (evictionPolicy, error) {
+	switch name {
+	case PolicyLRU, "":
+		return newLRUPolicy(), nil
+	case PolicyLFU:
+		return newLFUPolicy(), nil
+	case PolicyTinyLFU:
+		return newTinyLFUPolicy(expectedEntries), nil
+	default:
+		return nil, fmt.Errorf("unknown cache eviction policy: %s", name)
+	}
+}
+
+// lruPolicy evicts the least recently used key.
+type lruPolicy struct {
+	order *list.List
+	elems map[string]*list.Element
+}
+
+func newLRUPolicy() *lruPolicy {
+	return &lruPolicy{
+		order: list.New(),
+		elems: make(map[string]*list.Element),
+	}
+}
+
+func (p *lruPolicy) record(string) {}
+
+func (p *lruPolicy) add(key string) {
+	p.elems[key] = p.order.PushFront(key)
+}
+
+func (p *lruPolicy) touch(key string) {
+	if elem, ok := p.elems[key]; ok {
+		p.order.MoveToFront(elem)
+	}
+}
+
+func (p *lruPolicy) remove(key string) {
+	if elem, ok := p.elems[key]; ok {
+		p.order.Remove(elem)
+		delete(p.elems, key)
+	}
+}
+
+func (p *lruPolicy) victim() (string, bool) {
+	elem := p.order.Back()
+	if elem == nil {
+		return "", false
+	}
+	return elem.Value.(string), true
+}
+
+func (p *lruPolicy) admit(string, string) bool { return true }
+
+func (p *lruPolicy) reset() {
+	p.order.Init()
+	p.elems = make(map[string]*list.Element)
+}
+
+// lfuPolicy evicts the least frequently used key, breaking ties by recency.
+type lfuPolicy struct {
+	freqs   map[int]*list.List // access count -> keys, most recent first
+	elems   map[string]*list.Element
+	counts  map[string]int
+	minFreq int
+}
+
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{
+		freqs:  make(map[int]*list.List),
+		elems:  make(map[string]*list.Element),
+		counts: make(map[string]int),
+	}
+}
+
+func (p *lfuPolicy) record(string) {}
+
+func (p *lfuPolicy) add(key string) {
+	p.push(key, 1)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) touch(key string) {
+	count, ok := p.counts[key]
+	if !ok {
+		return
+	}
+	p.unlink(key)
+	if count == p.minFreq && p.freqs[count] == nil {
+		p.minFreq++
+	}
+	p.push(key, count+1)
+}
+
+func (p *lfuPolicy) remove(key string) {
+	if _, ok := p.counts[key]; ok {
+		p.unlink(key)
+	}
+}
+
+func (p *lfuPolicy) victim() (string, bool) {
+	if len(p.counts) == 0 {
+		return "", false
+	}
+	for p.freqs[p.minFreq] == nil {
+		p.minFreq++
+	}
+	return p.freqs[p.minFreq].Back().Value.(string), true
+}
+
+func (p *lfuPolicy) admit(string, string) bool { return true }
+
+func (p *lfuPolicy) reset() {
+	p.freqs = make(map[int]*list.List)
+	p.elems = make(map[string]*list.Element)
+	p.counts = make(map[string]int)
+	p.minFreq = 0
+}
+
+func (p *lfuPolicy) push(key string, count int) {
+	l, ok := p.freqs[count]
+	if !ok {
+		l = list.New()
+		p.freqs[count] = l
+	}
+	p.elems[key] = l.PushFront(key)
+	p.counts[key] = count
+}
+
+func (p *lfuPolicy) unlink(key string) {
+	count := p.counts[key]
+	l := p.freqs[count]
+	l.Remove(p.elems[key])
+	if l.Len() == 0 {
+		delete(p.freqs, count)
+	}
+	delete(p.elems, key)
+	delete(p.counts, key)
+}
+
+// tinyLFUPolicy keeps keys in LRU order but only admits a new key when a
+// frequency sketch of recent lookups says it is more popular than the key it
+// would evict, so one-off scans cannot flush the hot set.
+type tinyLFUPolicy struct {
+	*lruPolicy
+	sketch *countMinSketch
+}
+
+func newTinyLFUPolicy(expectedEntries int) *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		lruPolicy: newLRUPolicy(),
+		sketch:    newCountMinSketch(expectedEntries),
+	}
+}
+
+func (p *tinyLFUPolicy) record(key string) {
+	p.sketch.increment(key)
+}
+
+func (p *tinyLFUPolicy) admit(candidate, victim string) bool {
+	return p.sketch.estimate(candidate) > p.sketch.estimate(victim)
+}
+
+// countMinSketch is a 4-row count-min sketch of 4-bit counters that halves
+// all counters periodically so old popularity fades.
+type countMinSketch struct {
+	rows      [4][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newCountMinSketch(expectedEntries int) *countMinSketch {
+	width := 64
+	for width < expectedEntries {
+		width <<= 1
+	}
+	s := &countMinSketch{
+		mask:    uint64(width - 1),
+		resetAt: 10 * width,
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, width)
+	}
+	return s
+}
+
+func (s *countMinSketch) indexes(key string) [4]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	lo, hi := sum, sum>>32|1
+	var idx [4]uint64
+	for i := range idx {
+		idx[i] = (lo + uint64(i)*hi) & s.mask
+	}
+	return idx
+}
+
+func (s *countMinSketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < 15 {
+			s.rows[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		for i := range s.rows {
+			for j := range s.rows[i] {
+				s.rows[i][j] >>= 1
+			}
+		}
+		s.additions /= 2
+	}
+}
+
+func (s *countMinSketch) estimate(key string) uint8 {
+	min := uint8(15)
+	for i, idx := range s.indexes(key) {
+		if s.rows[i][idx] < min {
+			min = s.rows[i][idx]
+		}
+	}
+	return min
+}
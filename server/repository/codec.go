@@ -0,0 +1,286 @@
+package repository
+
+import (
+	"bytes"
+	"compress/flate"
+	"cs739-kv-store/models"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Header bytes that mark encoded values and snapshot payloads. 0xC0, 0xC1
+// and 0xF5 to 0xFF never occur in valid UTF-8, and of those only 0xF8 to
+// 0xFF can start a gob stream (as a message length of two or more bytes).
+// Values written before codecs existed, which are UTF-8 or JSON, and plain
+// raft proposals therefore never start with a header byte and are passed
+// through as-is.
+const (
+	headerRaw    byte = 0xC0 // an unencoded value that would otherwise look like it has a header
+	headerFlate  byte = 0xC1 // a DEFLATE-compressed value
+	headerAESGCM byte = 0xF5 // a value sealed by AESGCMCodec
+
+	// 0xF6 and 0xF7 are reserved for further codecs.
+	headerReservedMax byte = 0xF7
+)
+
+func hasHeader(value []byte) bool {
+	if len(value) == 0 {
+		return false
+	}
+	b := value[0]
+	return b == headerRaw || b == headerFlate || (b >= headerAESGCM && b <= headerReservedMax)
+}
+
+// ValueCodec transforms values on their way into and out of a storage engine.
+// Decode must accept anything Encode produced as well as values without a header.
+type ValueCodec interface {
+	Encode(value []byte) ([]byte, error)
+	Decode(value []byte) ([]byte, error)
+}
+
+// FlateCodec compresses values of at least Threshold bytes with DEFLATE,
+// keeping the compressed form only when it is smaller. A Threshold of 0
+// disables compression but still decodes compressed values.
+type FlateCodec struct {
+	Threshold int
+}
+
+func NewFlateCodec(threshold int) *FlateCodec {
+	return &FlateCodec{Threshold: threshold}
+}
+
+func (c *FlateCodec) Encode(value []byte) ([]byte, error) {
+	if c.Threshold > 0 && len(value) >= c.Threshold {
+		var buf bytes.Buffer
+		buf.WriteByte(headerFlate)
+		w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(value); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(value) {
+			return buf.Bytes(), nil
+		}
+	}
+	if hasHeader(value) {
+		return append([]byte{headerRaw}, value...), nil
+	}
+	return value, nil
+}
+
+func (c *FlateCodec) Decode(value []byte) ([]byte, error) {
+	if len(value) == 0 {
+		return value, nil
+	}
+	switch value[0] {
+	case headerFlate:
+		r := flate.NewReader(bytes.NewReader(value[1:]))
+		defer r.Close()
+		out, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("decompress value: %w", err)
+		}
+		return out, nil
+	case headerRaw:
+		return value[1:], nil
+	default:
+		return value, nil
+	}
+}
+
+// CodecRepo wraps a StorageEngine and passes every value, and every snapshot
+// payload, through a chain of codecs. Codecs encode in order and decode in
+// reverse order.
+type CodecRepo struct {
+	engine StorageEngine
+	codecs []ValueCodec
+}
+
+func NewCodecRepo(engine StorageEngine, codecs ...ValueCodec) *CodecRepo {
+	return &CodecRepo{
+		engine: engine,
+		codecs: codecs,
+	}
+}
+
+// Unwrap returns the wrapped engine.
+func (r *CodecRepo) Unwrap() StorageEngine {
+	return r.engine
+}
+
+// Encode runs value through the codec chain.
+func (r *CodecRepo) Encode(value []byte) ([]byte, error) {
+	var err error
+	for _, c := range r.codecs {
+		if value, err = c.Encode(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// Decode reverses Encode.
+func (r *CodecRepo) Decode(value []byte) ([]byte, error) {
+	var err error
+	for i := len(r.codecs) - 1; i >= 0; i-- {
+		if value, err = r.codecs[i].Decode(value); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+func (r *CodecRepo) encodeString(value string) (string, error) {
+	out, err := r.Encode([]byte(value))
+	return string(out), err
+}
+
+func (r *CodecRepo) decodeString(value string) (string, error) {
+	out, err := r.Decode([]byte(value))
+	return string(out), err
+}
+
+func (r *CodecRepo) Get(key string) (string, bool, error) {
+	value, found, err := r.engine.Get(key)
+	if err != nil || !found {
+		return "", found, err
+	}
+	value, err = r.decodeString(value)
+	if err != nil {
+		return "", false, fmt.Errorf("key %s: %w", key, err)
+	}
+	return value, true, nil
+}
+
+func (r *CodecRepo) Put(key, value string) error {
+	encoded, err := r.encodeString(value)
+	if err != nil {
+		return err
+	}
+	return r.engine.Put(key, encoded)
+}
+
+func (r *CodecRepo) Delete(key string) error {
+	return r.engine.Delete(key)
+}
+
+func (r *CodecRepo) Range(start, end string, fn func(key, value string) bool) error {
+	return r.decodeRange(r.engine, start, end, fn)
+}
+
+// decodeRange runs Range on the wrapped engine or a view of it, decoding values.
+func (r *CodecRepo) decodeRange(source interface {
+	Range(start, end string, fn func(key, value string) bool) error
+}, start, end string, fn func(key, value string) bool) error {
+	var decodeErr error
+	err := source.Range(start, end, func(key, value string) bool {
+		value, decodeErr = r.decodeString(value)
+		if decodeErr != nil {
+			decodeErr = fmt.Errorf("key %s: %w", key, decodeErr)
+			return false
+		}
+		return fn(key, value)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+// View opens a view of the wrapped engine that decodes values.
+func (r *CodecRepo) View() (View, error) {
+	viewer, ok := r.engine.(Viewer)
+	if !ok {
+		return nil, ErrViewUnsupported
+	}
+	view, err := viewer.View()
+	if err != nil {
+		return nil, err
+	}
+	return codecView{repo: r, view: view}, nil
+}
+
+type codecView struct {
+	repo *CodecRepo
+	view View
+}
+
+func (v codecView) Range(start, end string, fn func(key, value string) bool) error {
+	return v.repo.decodeRange(v.view, start, end, fn)
+}
+
+func (v codecView) Close() error {
+	return v.view.Close()
+}
+
+func (r *CodecRepo) Batch(ops []Op) error {
+	encoded := make([]Op, len(ops))
+	for i, op := range ops {
+		encoded[i] = op
+		if op.Type == OpPut {
+			value, err := r.encodeString(op.Value)
+			if err != nil {
+				return err
+			}
+			encoded[i].Value = value
+		}
+	}
+	return r.engine.Batch(encoded)
+}
+
+// Snapshot serializes the decoded data to JSON and encodes the whole payload.
+func (r *CodecRepo) Snapshot() ([]byte, error) {
+	var kvPairs []models.KVPair
+	err := r.Range("", "", func(key, value string) bool {
+		kvPairs = append(kvPairs, models.KVPair{Key: key, Value: value})
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(kvPairs)
+	if err != nil {
+		return nil, err
+	}
+	return r.Encode(data)
+}
+
+// Restore decodes a payload produced by Snapshot, or a plain JSON snapshot,
+// and replaces the wrapped engine's data with it in one batch.
+func (r *CodecRepo) Restore(data []byte) error {
+	data, err := r.Decode(data)
+	if err != nil {
+		return fmt.Errorf("decode snapshot: %w", err)
+	}
+	var kvPairs []models.KVPair
+	if err := json.Unmarshal(data, &kvPairs); err != nil {
+		return err
+	}
+
+	var ops []Op
+	err = r.engine.Range("", "", func(key, _ string) bool {
+		ops = append(ops, Op{Type: OpDelete, Key: key})
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, kv := range kvPairs {
+		ops = append(ops, Op{Type: OpPut, Key: kv.Key, Value: kv.Value})
+	}
+	return r.Batch(ops)
+}
+
+func (r *CodecRepo) Size() (int64, error) {
+	return r.engine.Size()
+}
+
+func (r *CodecRepo) Close() error {
+	return r.engine.Close()
+}
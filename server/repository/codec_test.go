@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFlateCodecRoundTrip(t *testing.T) {
+	c := NewFlateCodec(16)
+	cases := map[string][]byte{
+		"empty":            {},
+		"short":            []byte("abc"),
+		"compressible":     []byte(strings.Repeat(`{"field":"value"},`, 100)),
+		"incompressible":   []byte("0123456789abcdefghij"),
+		"header lookalike": {headerFlate, 'x'},
+	}
+	for name, value := range cases {
+		t.Run(name, func(t *testing.T) {
+			encoded, err := c.Encode(value)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			decoded, err := c.Decode(encoded)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if !bytes.Equal(decoded, value) {
+				t.Fatalf("round trip = %q, want %q", decoded, value)
+			}
+		})
+	}
+
+	encoded, _ := c.Encode(cases["compressible"])
+	if encoded[0] != headerFlate || len(encoded) >= len(cases["compressible"]) {
+		t.Fatalf("compressible value was not compressed")
+	}
+}
+
+func TestFlateCodecDisabledStillDecodes(t *testing.T) {
+	value := []byte(strings.Repeat("a", 1000))
+	encoded, _ := NewFlateCodec(1).Encode(value)
+
+	off := NewFlateCodec(0)
+	if out, _ := off.Encode(value); !bytes.Equal(out, value) {
+		t.Fatalf("disabled codec compressed a value")
+	}
+	decoded, err := off.Decode(encoded)
+	if err != nil || !bytes.Equal(decoded, value) {
+		t.Fatalf("disabled codec failed to decode a compressed value: %v", err)
+	}
+}
+
+func TestCodecRepoReadsLegacyData(t *testing.T) {
+	inner, err := OpenRDSRepo(filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	defer inner.Close()
+
+	legacy := strings.Repeat("legacy value ", 50)
+	inner.Put("old", legacy)
+	snapshot, err := inner.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	r := NewCodecRepo(inner, NewFlateCodec(64))
+	if value, found, err := r.Get("old"); err != nil || !found || value != legacy {
+		t.Fatalf("Get legacy = %q, %v, %v", value, found, err)
+	}
+
+	r.Put("new", legacy)
+	if raw, _, _ := inner.Get("new"); raw[0] != headerFlate {
+		t.Fatalf("new value was not stored compressed")
+	}
+
+	compressed, err := r.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	if compressed[0] != headerFlate {
+		t.Fatalf("snapshot payload was not compressed")
+	}
+
+	// Legacy plain JSON snapshots still restore.
+	if err := r.Restore(snapshot); err != nil {
+		t.Fatalf("Restore legacy snapshot: %v", err)
+	}
+	if _, found, _ := r.Get("new"); found {
+		t.Fatalf("restore kept a key missing from the snapshot")
+	}
+	if err := r.Restore(compressed); err != nil {
+		t.Fatalf("Restore compressed snapshot: %v", err)
+	}
+	if value, found, _ := r.Get("new"); !found || value != legacy {
+		t.Fatalf("Get after restore = %q, %v", value, found)
+	}
+}
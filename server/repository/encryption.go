@@ -0,0 +1,240 @@
+package repository
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	ErrNoEncryptionKey = errors.New("value is encrypted but no encryption key is configured")
+	ErrUnknownKeyID    = errors.New("value is encrypted with an unknown key id")
+)
+
+// Keyring holds the key-encryption keys, by ID. New values are sealed with
+// the active key; older keys stay around so existing values can be opened.
+type Keyring struct {
+	activeID string
+	keys     map[string]cipher.AEAD
+}
+
+// NewKeyring builds a keyring from 16, 24 or 32 byte AES keys.
+func NewKeyring(activeID string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[activeID]; !ok {
+		return nil, fmt.Errorf("active key %q is not in the keyring", activeID)
+	}
+	k := &Keyring{
+		activeID: activeID,
+		keys:     make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keys[id] = aead
+	}
+	return k, nil
+}
+
+// ParseKeyring parses "<id> <hex key>" entries separated by newlines or
+// commas, with "<id>:<hex key>" also accepted. The first entry is the active key.
+func ParseKeyring(text string) (*Keyring, error) {
+	keys := make(map[string][]byte)
+	var activeID string
+	scanner := bufio.NewScanner(strings.NewReader(strings.ReplaceAll(text, ",", "\n")))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(strings.Replace(line, ":", " ", 1))
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid key entry: %q", line)
+		}
+		key, err := hex.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("key %q is not hex: %w", parts[0], err)
+		}
+		if activeID == "" {
+			activeID = parts[0]
+		}
+		keys[parts[0]] = key
+	}
+	if activeID == "" {
+		return nil, errors.New("no encryption keys found")
+	}
+	return NewKeyring(activeID, keys)
+}
+
+// LoadKeyring reads the keyring from path, or from the environment variable
+// env when path is empty. It returns nil if neither is set.
+func LoadKeyring(path, env string) (*Keyring, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return ParseKeyring(string(data))
+	}
+	if text := os.Getenv(env); text != "" {
+		return ParseKeyring(text)
+	}
+	return nil, nil
+}
+
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// AESGCMCodec envelope-encrypts values: each value is sealed with a fresh
+// data key, and the data key is sealed with the keyring's active key.
+//
+// Layout: header | id length | key id | wrapped key length | wrapped key | sealed value,
+// where both sealed parts are a GCM nonce followed by ciphertext.
+//
+// With a nil keyring it leaves new values in plaintext and refuses to decode
+// encrypted ones. Plaintext is not escaped, so it must never start with a
+// header byte; chain it after a FlateCodec, which escapes such values.
+type AESGCMCodec struct {
+	keyring *Keyring
+}
+
+func NewAESGCMCodec(keyring *Keyring) *AESGCMCodec {
+	return &AESGCMCodec{keyring: keyring}
+}
+
+func (c *AESGCMCodec) Encode(value []byte) ([]byte, error) {
+	if c.keyring == nil {
+		return value, nil
+	}
+
+	id := c.keyring.activeID
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	wrapped, err := seal(c.keyring.keys[id], dataKey, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(aead, value, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, 3+len(id)+len(wrapped)+len(sealed))
+	out = append(out, headerAESGCM, byte(len(id)))
+	out = append(out, id...)
+	out = append(out, byte(len(wrapped)))
+	out = append(out, wrapped...)
+	return append(out, sealed...), nil
+}
+
+func (c *AESGCMCodec) Decode(value []byte) ([]byte, error) {
+	if len(value) == 0 || value[0] != headerAESGCM {
+		return value, nil
+	}
+	id, wrapped, sealed, err := splitEnvelope(value)
+	if err != nil {
+		return nil, err
+	}
+	if c.keyring == nil {
+		return nil, ErrNoEncryptionKey
+	}
+	kek, ok := c.keyring.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, id)
+	}
+	dataKey, err := open(kek, wrapped, []byte(id))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return open(aead, sealed, nil)
+}
+
+// KeyID returns the ID of the key that sealed value, or "" if value is not encrypted.
+func (c *AESGCMCodec) KeyID(value []byte) (string, error) {
+	if len(value) == 0 || value[0] != headerAESGCM {
+		return "", nil
+	}
+	id, _, _, err := splitEnvelope(value)
+	return id, err
+}
+
+func splitEnvelope(value []byte) (id string, wrapped, sealed []byte, err error) {
+	errCorrupt := errors.New("corrupt encrypted value")
+	rest := value[1:]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return "", nil, nil, errCorrupt
+	}
+	id, rest = string(rest[1:1+int(rest[0])]), rest[1+int(rest[0]):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0]) {
+		return "", nil, nil, errCorrupt
+	}
+	wrapped, sealed = rest[1:1+int(rest[0])], rest[1+int(rest[0]):]
+	return id, wrapped, sealed, nil
+}
+
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed value too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// Reencrypt reseals value with the active key. It reports false, and
+// returns value unchanged, if value is already sealed with the active key.
+// Plaintext values get encrypted.
+func (c *AESGCMCodec) Reencrypt(value []byte) ([]byte, bool, error) {
+	if c.keyring == nil {
+		return nil, false, ErrNoEncryptionKey
+	}
+	id, err := c.KeyID(value)
+	if err != nil {
+		return nil, false, err
+	}
+	if id == c.keyring.activeID {
+		return value, false, nil
+	}
+	plaintext, err := c.Decode(value)
+	if err != nil {
+		return nil, false, err
+	}
+	out, err := c.Encode(plaintext)
+	return out, err == nil, err
+}
@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const (
+	testKey1 = "000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"
+	testKey2 = "101112131415161718191a1b1c1d1e1f101112131415161718191a1b1c1d1e1f"
+)
+
+func mustParseKeyring(t *testing.T, text string) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(text)
+	if err != nil {
+		t.Fatalf("ParseKeyring: %v", err)
+	}
+	return k
+}
+
+func TestAESGCMCodecRoundTrip(t *testing.T) {
+	codec := NewAESGCMCodec(mustParseKeyring(t, "k1 "+testKey1))
+	for _, value := range [][]byte{nil, []byte("v"), bytes.Repeat([]byte("abc"), 1000)} {
+		encoded, err := codec.Encode(value)
+		if err != nil {
+			t.Fatalf("Encode: %v", err)
+		}
+		// Short values can turn up in random ciphertext by chance.
+		if len(value) > 16 && bytes.Contains(encoded, value[:16]) {
+			t.Fatalf("encoded value contains the plaintext")
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		if !bytes.Equal(decoded, value) {
+			t.Fatalf("round trip = %q, want %q", decoded, value)
+		}
+	}
+}
+
+func TestAESGCMCodecKeyRotation(t *testing.T) {
+	old := NewAESGCMCodec(mustParseKeyring(t, "k1 "+testKey1))
+	encoded, err := old.Encode([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+
+	rotated := NewAESGCMCodec(mustParseKeyring(t, "k2:"+testKey2+",k1:"+testKey1))
+	if decoded, err := rotated.Decode(encoded); err != nil || string(decoded) != "secret" {
+		t.Fatalf("Decode with retired key = %q, %v", decoded, err)
+	}
+	reencrypted, changed, err := rotated.Reencrypt(encoded)
+	if err != nil || !changed {
+		t.Fatalf("Reencrypt = %v, %v", changed, err)
+	}
+	if id, _ := rotated.KeyID(reencrypted); id != "k2" {
+		t.Fatalf("KeyID = %q, want k2", id)
+	}
+	if _, changed, _ := rotated.Reencrypt(reencrypted); changed {
+		t.Fatalf("value sealed with the active key was re-encrypted")
+	}
+
+	retired := NewAESGCMCodec(mustParseKeyring(t, "k2 "+testKey2))
+	if _, err := retired.Decode(encoded); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("Decode without the key = %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestAESGCMCodecWithoutKeyring(t *testing.T) {
+	codec := NewAESGCMCodec(nil)
+	if out, err := codec.Encode([]byte("plain")); err != nil || string(out) != "plain" {
+		t.Fatalf("Encode = %q, %v; want passthrough", out, err)
+	}
+
+	encoded, err := NewAESGCMCodec(mustParseKeyring(t, "k1 "+testKey1)).Encode([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if _, err := codec.Decode(encoded); !errors.Is(err, ErrNoEncryptionKey) {
+		t.Fatalf("Decode = %v, want ErrNoEncryptionKey", err)
+	}
+}
+
+func TestAESGCMCodecTamperedValue(t *testing.T) {
+	codec := NewAESGCMCodec(mustParseKeyring(t, "k1 "+testKey1))
+	encoded, err := codec.Encode([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	encoded[len(encoded)-1] ^= 1
+	if _, err := codec.Decode(encoded); err == nil {
+		t.Fatalf("tampered value decoded")
+	}
+}
+
+func TestParseKeyringErrors(t *testing.T) {
+	for _, text := range []string{"", "# only a comment", "k1", "k1 zz", "k1 0102"} {
+		if _, err := ParseKeyring(text); err == nil {
+			t.Errorf("ParseKeyring(%q) succeeded", text)
+		}
+	}
+	k := mustParseKeyring(t, strings.Join([]string{"# keys", "k2 " + testKey2, "k1 " + testKey1}, "\n"))
+	if k.ActiveID() != "k2" {
+		t.Fatalf("ActiveID = %q, want k2", k.ActiveID())
+	}
+}
+
+func TestCodecChainReadsLegacyUTF8(t *testing.T) {
+	// Every lead byte of a multi-byte UTF-8 sequence, as legacy plaintext.
+	legacy := []string{"£100", "é", "€", "😀"}
+	for r := rune(0x80); r <= utf8.MaxRune; r += 0x3F {
+		if utf8.ValidRune(r) {
+			if value := string(r) + " legacy"; hasHeader([]byte(value)) {
+				t.Fatalf("UTF-8 value %q starts with header byte %#x", value, value[0])
+			}
+		}
+	}
+
+	keyring := mustParseKeyring(t, "k1 "+testKey1)
+	chains := map[string]*CodecRepo{
+		"with keyring":    NewCodecRepo(NewMapRepo(), NewFlateCodec(64), NewAESGCMCodec(keyring)),
+		"without keyring": NewCodecRepo(NewMapRepo(), NewFlateCodec(64), NewAESGCMCodec(nil)),
+		"flate only":      NewCodecRepo(NewMapRepo(), NewFlateCodec(64)),
+	}
+	for name, r := range chains {
+		for _, value := range legacy {
+			r.Unwrap().Put(value, value)
+			if got, found, err := r.Get(value); err != nil || !found || got != value {
+				t.Errorf("%s: Get legacy %q = %q, %v, %v", name, value, got, found, err)
+			}
+		}
+	}
+
+	codec := NewAESGCMCodec(keyring)
+	sealed, changed, err := codec.Reencrypt([]byte("£100"))
+	if err != nil || !changed {
+		t.Fatalf("Reencrypt legacy value = %v, %v; want it encrypted", changed, err)
+	}
+	if decoded, err := codec.Decode(sealed); err != nil || string(decoded) != "£100" {
+		t.Fatalf("Decode re-encrypted value = %q, %v", decoded, err)
+	}
+}
+
+func TestGobStreamsHaveNoHeader(t *testing.T) {
+	// Raft proposals are gob streams, decoded with a codec only when encryption is on.
+	for _, size := range []int{1, 200, 70000} {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(struct{ Val string }{strings.Repeat("v", size)}); err != nil {
+			t.Fatal(err)
+		}
+		if hasHeader(buf.Bytes()) {
+			t.Fatalf("gob stream of a %d byte value starts with header byte %#x", size, buf.Bytes()[0])
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	EngineSQLite = "sqlite"
+	EngineBolt   = "bolt"
+	EngineMemory = "memory"
+)
+
+var (
+	ErrUnknownEngine     = errors.New("unknown storage engine")
+	ErrVacuumUnsupported = errors.New("storage engine does not support vacuum")
+	ErrViewUnsupported   = errors.New("storage engine cannot hold a view while writes continue")
+)
+
+// OpType identifies the kind of mutation carried by an Op.
+type OpType int
+
+const (
+	OpPut OpType = iota
+	OpDelete
+)
+
+// Op is a single mutation applied as part of a batch.
+type Op struct {
+	Type  OpType
+	Key   string
+	Value string
+}
+
+// StorageEngine is the durable key-value backend of the replicated state machine.
+type StorageEngine interface {
+	Get(key string) (string, bool, error)
+	Put(key, value string) error
+	Delete(key string) error
+
+	// Range calls fn for every key in [start, end) in ascending key order,
+	// stopping early when fn returns false. An empty end means no upper bound.
+	// The iteration sees a consistent view of the engine.
+	Range(start, end string, fn func(key, value string) bool) error
+
+	// Batch applies all ops atomically.
+	Batch(ops []Op) error
+
+	// Snapshot serializes all data; Restore replaces all data with a snapshot.
+	Snapshot() ([]byte, error)
+	Restore(data []byte) error
+
+	// Size returns the bytes the engine's data occupies on disk, or in
+	// memory for engines without a file.
+	Size() (int64, error)
+
+	Close() error
+}
+
+// View is a read-only view of an engine's data as of when it was opened;
+// later writes do not show in it. It must be closed.
+type View interface {
+	Range(start, end string, fn func(key, value string) bool) error
+	Close() error
+}
+
+// Viewer is implemented by engines that can hold a View while writes
+// continue, so long scans need not block them. View returns
+// ErrViewUnsupported if the engine's current settings do not allow it.
+type Viewer interface {
+	View() (View, error)
+}
+
+// EngineOptions holds engine-specific settings; engines ignore the ones
+// that are not theirs.
+type EngineOptions struct {
+	SQLite SQLiteOptions
+}
+
+// DefaultDataDir is the directory nodes keep their data in unless told otherwise.
+const DefaultDataDir = "./storage"
+
+// OpenStorageEngine opens the engine of the given kind for a node that keeps
+// its data in DefaultDataDir.
+func OpenStorageEngine(engine string, nodeID uint64, opts EngineOptions) (StorageEngine, error) {
+	return OpenStorageEngineAt(engine, StoragePath(DefaultDataDir, engine, nodeID), opts)
+}
+
+// StoragePath returns the file a node keeps its engine's data in under
+// dataDir, or "" if the engine keeps nothing on disk.
+func StoragePath(dataDir, engine string, nodeID uint64) string {
+	switch engine {
+	case EngineSQLite:
+		return fmt.Sprintf("%s/kv739_%d.db", dataDir, nodeID)
+	case EngineBolt:
+		return fmt.Sprintf("%s/kv739_%d.bolt", dataDir, nodeID)
+	default:
+		return ""
+	}
+}
+
+// OpenStorageEngineAt opens the engine of the given kind at path.
+func OpenStorageEngineAt(engine string, path string, opts EngineOptions) (StorageEngine, error) {
+	switch engine {
+	case EngineSQLite:
+		return OpenRDSRepoWithOptions(path, opts.SQLite)
+	case EngineBolt:
+		return OpenBoltRepo(path)
+	case EngineMemory:
+		return NewMapRepo(), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEngine, engine)
+	}
+}
+
+// Vacuumer is implemented by engines that can give free space back to the
+// file system while open.
+type Vacuumer interface {
+	// Vacuum reclaims free space and returns the number of bytes reclaimed.
+	// An incremental vacuum is cheaper but may reclaim less.
+	Vacuum(incremental bool) (int64, error)
+}
+
+// Vacuum vacuums engine, or the engine it wraps.
+func Vacuum(engine StorageEngine, incremental bool) (int64, error) {
+	for {
+		if v, ok := engine.(Vacuumer); ok {
+			return v.Vacuum(incremental)
+		}
+		wrapper, ok := engine.(interface{ Unwrap() StorageEngine })
+		if !ok {
+			return 0, ErrVacuumUnsupported
+		}
+		engine = wrapper.Unwrap()
+	}
+}
+
+// PrefixEnd returns the smallest key greater than every key with the given
+// prefix, for use as the end of a Range. It returns "" if there is none.
+func PrefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
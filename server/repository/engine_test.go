@@ -0,0 +1,301 @@
+package repository
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// engineFactories lists every StorageEngine implementation; each one must
+// pass the same conformance tests.
+var engineFactories = []struct {
+	name string
+	open func(t *testing.T) StorageEngine
+}{
+	{
+		name: EngineSQLite,
+		open: func(t *testing.T) StorageEngine {
+			r, err := OpenRDSRepo(filepath.Join(t.TempDir(), "kv.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			return r
+		},
+	},
+	{
+		name: EngineBolt,
+		open: func(t *testing.T) StorageEngine {
+			r, err := OpenBoltRepo(filepath.Join(t.TempDir(), "kv.bolt"))
+			if err != nil {
+				t.Fatalf("open bolt: %v", err)
+			}
+			return r
+		},
+	},
+	{
+		name: EngineMemory,
+		open: func(t *testing.T) StorageEngine {
+			return NewMapRepo()
+		},
+	},
+	{
+		name: EngineSQLite + "+flate",
+		open: func(t *testing.T) StorageEngine {
+			r, err := OpenRDSRepo(filepath.Join(t.TempDir(), "kv.db"))
+			if err != nil {
+				t.Fatalf("open sqlite: %v", err)
+			}
+			return NewCodecRepo(r, NewFlateCodec(1))
+		},
+	},
+	{
+		name: EngineBolt + "+aesgcm",
+		open: func(t *testing.T) StorageEngine {
+			r, err := OpenBoltRepo(filepath.Join(t.TempDir(), "kv.bolt"))
+			if err != nil {
+				t.Fatalf("open bolt: %v", err)
+			}
+			return NewCodecRepo(r, NewFlateCodec(1), NewAESGCMCodec(mustParseKeyring(t, "k1 "+testKey1)))
+		},
+	},
+}
+
+func runEngineTest(t *testing.T, fn func(t *testing.T, e StorageEngine)) {
+	for _, f := range engineFactories {
+		t.Run(f.name, func(t *testing.T) {
+			e := f.open(t)
+			defer e.Close()
+			fn(t, e)
+		})
+	}
+}
+
+func mustGet(t *testing.T, e StorageEngine, key string) (string, bool) {
+	t.Helper()
+	value, found, err := e.Get(key)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", key, err)
+	}
+	return value, found
+}
+
+func collectRange(t *testing.T, e StorageEngine, start, end string) []string {
+	t.Helper()
+	var out []string
+	err := e.Range(start, end, func(key, value string) bool {
+		out = append(out, key+"="+value)
+		return true
+	})
+	if err != nil {
+		t.Fatalf("Range(%q, %q): %v", start, end, err)
+	}
+	return out
+}
+
+func TestEngineGetPutDelete(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		if _, found := mustGet(t, e, "a"); found {
+			t.Fatalf("expected missing key")
+		}
+		if err := e.Put("a", "1"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := e.Put("a", "2"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if value, found := mustGet(t, e, "a"); !found || value != "2" {
+			t.Fatalf("Get = %q, %v; want \"2\", true", value, found)
+		}
+		if err := e.Delete("a"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, found := mustGet(t, e, "a"); found {
+			t.Fatalf("expected key to be deleted")
+		}
+		if err := e.Delete("missing"); err != nil {
+			t.Fatalf("Delete of missing key: %v", err)
+		}
+	})
+}
+
+func TestEngineRange(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		for _, k := range []string{"b/2", "a/1", "b/1", "c", "b/3"} {
+			if err := e.Put(k, "v"+k); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+
+		got := collectRange(t, e, "b/", PrefixEnd("b/"))
+		want := []string{"b/1=vb/1", "b/2=vb/2", "b/3=vb/3"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("prefix range = %v, want %v", got, want)
+		}
+
+		got = collectRange(t, e, "", "")
+		if len(got) != 5 || got[0] != "a/1=va/1" || got[4] != "c=vc" {
+			t.Fatalf("full range = %v", got)
+		}
+
+		var n int
+		if err := e.Range("", "", func(string, string) bool { n++; return n < 2 }); err != nil {
+			t.Fatalf("Range: %v", err)
+		}
+		if n != 2 {
+			t.Fatalf("Range visited %d keys after stop, want 2", n)
+		}
+	})
+}
+
+func TestEngineBatch(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		if err := e.Put("gone", "x"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		err := e.Batch([]Op{
+			{Type: OpPut, Key: "k1", Value: "v1"},
+			{Type: OpPut, Key: "k2", Value: "v2"},
+			{Type: OpDelete, Key: "gone"},
+			{Type: OpPut, Key: "k1", Value: "v1b"},
+		})
+		if err != nil {
+			t.Fatalf("Batch: %v", err)
+		}
+		got := collectRange(t, e, "", "")
+		want := []string{"k1=v1b", "k2=v2"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("after batch = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestEngineSnapshotRestore(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		for _, k := range []string{"x", "y", "z"} {
+			if err := e.Put(k, k+k); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		data, err := e.Snapshot()
+		if err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+
+		if err := e.Put("extra", "1"); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		if err := e.Delete("x"); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if err := e.Restore(data); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+
+		got := collectRange(t, e, "", "")
+		want := []string{"x=xx", "y=yy", "z=zz"}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("after restore = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestEngineSnapshotPortable(t *testing.T) {
+	src := NewMapRepo()
+	src.Put("k", "v")
+	data, err := src.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		if err := e.Restore(data); err != nil {
+			t.Fatalf("Restore: %v", err)
+		}
+		if value, found := mustGet(t, e, "k"); !found || value != "v" {
+			t.Fatalf("Get = %q, %v; want \"v\", true", value, found)
+		}
+	})
+}
+
+func TestEngineSize(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		before, err := e.Size()
+		if err != nil {
+			t.Fatalf("Size: %v", err)
+		}
+		var ops []Op
+		for i := 0; i < 1000; i++ {
+			ops = append(ops, Op{Type: OpPut, Key: fmt.Sprintf("key-%04d", i), Value: fmt.Sprintf("%0100d", i)})
+		}
+		if err := e.Batch(ops); err != nil {
+			t.Fatalf("Batch: %v", err)
+		}
+		after, err := e.Size()
+		if err != nil {
+			t.Fatalf("Size: %v", err)
+		}
+		if after <= before {
+			t.Fatalf("Size did not grow after writing: %d -> %d", before, after)
+		}
+	})
+}
+
+func TestPrefixEnd(t *testing.T) {
+	cases := map[string]string{
+		"":         "",
+		"a":        "b",
+		"a/":       "a0",
+		"a\xff":    "b",
+		"\xff\xff": "",
+	}
+	for in, want := range cases {
+		if got := PrefixEnd(in); got != want {
+			t.Errorf("PrefixEnd(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEngineView(t *testing.T) {
+	runEngineTest(t, func(t *testing.T, e StorageEngine) {
+		viewer, ok := e.(Viewer)
+		if !ok {
+			t.Skip("engine cannot hold a view")
+		}
+		e.Batch([]Op{{Type: OpPut, Key: "a", Value: "1"}, {Type: OpPut, Key: "b", Value: "2"}})
+		view, err := viewer.View()
+		if err != nil {
+			t.Fatalf("View: %v", err)
+		}
+		defer view.Close()
+
+		// Writes go on while the view is open, and do not show in it.
+		if err := e.Batch([]Op{{Type: OpPut, Key: "a", Value: "changed"}, {Type: OpDelete, Key: "b"}, {Type: OpPut, Key: "c", Value: "3"}}); err != nil {
+			t.Fatalf("Batch while a view is open: %v", err)
+		}
+		var got []string
+		err = view.Range("", "", func(key, value string) bool {
+			got = append(got, key+"="+value)
+			return true
+		})
+		if err != nil {
+			t.Fatalf("Range: %v", err)
+		}
+		if want := []string{"a=1", "b=2"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("view = %v, want %v", got, want)
+		}
+		if got, want := collectRange(t, e, "", ""), []string{"a=changed", "c=3"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("engine = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestSQLiteViewNeedsWAL(t *testing.T) {
+	r, err := OpenRDSRepoWithOptions(filepath.Join(t.TempDir(), "kv.db"), SQLiteOptions{JournalMode: "delete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.View(); err != ErrViewUnsupported {
+		t.Fatalf("View in rollback journal mode = %v, want ErrViewUnsupported", err)
+	}
+}
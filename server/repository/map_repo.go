@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"cs739-kv-store/models"
+	"encoding/json"
+	"maps"
+	"sort"
+	"sync"
+)
+
+// MapRepo implements StorageEngine with a plain map. Nothing is persisted,
+// so it is meant for tests and throwaway nodes.
+type MapRepo struct {
+	mu   sync.RWMutex
+	data map[string]string
+}
+
+func NewMapRepo() *MapRepo {
+	return &MapRepo{
+		data: make(map[string]string),
+	}
+}
+
+func (r *MapRepo) Get(key string) (string, bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	value, found := r.data[key]
+	return value, found, nil
+}
+
+func (r *MapRepo) Put(key, value string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data[key] = value
+	return nil
+}
+
+func (r *MapRepo) Delete(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, key)
+	return nil
+}
+
+// Range iterates over a copy of the matching pairs, so fn may call back into the repo.
+func (r *MapRepo) Range(start, end string, fn func(key, value string) bool) error {
+	r.mu.RLock()
+	var kvPairs []models.KVPair
+	for k, v := range r.data {
+		if k >= start && (end == "" || k < end) {
+			kvPairs = append(kvPairs, models.KVPair{Key: k, Value: v})
+		}
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(kvPairs, func(i, j int) bool { return kvPairs[i].Key < kvPairs[j].Key })
+	for _, kv := range kvPairs {
+		if !fn(kv.Key, kv.Value) {
+			break
+		}
+	}
+	return nil
+}
+
+// View copies the map; the keys and values themselves are shared.
+func (r *MapRepo) View() (View, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &MapRepo{data: maps.Clone(r.data)}, nil
+}
+
+func (r *MapRepo) Batch(ops []Op) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			r.data[op.Key] = op.Value
+		case OpDelete:
+			delete(r.data, op.Key)
+		}
+	}
+	return nil
+}
+
+func (r *MapRepo) Snapshot() ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	kvPairs := make([]models.KVPair, 0, len(r.data))
+	for k, v := range r.data {
+		kvPairs = append(kvPairs, models.KVPair{Key: k, Value: v})
+	}
+	return json.Marshal(kvPairs)
+}
+
+func (r *MapRepo) Restore(data []byte) error {
+	var kvPairs []models.KVPair
+	if err := json.Unmarshal(data, &kvPairs); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = make(map[string]string, len(kvPairs))
+	for _, kv := range kvPairs {
+		r.data[kv.Key] = kv.Value
+	}
+	return nil
+}
+
+func (r *MapRepo) Size() (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var size int64
+	for key, value := range r.data {
+		size += int64(len(key) + len(value))
+	}
+	return size, nil
+}
+
+func (r *MapRepo) Close() error {
+	return nil
+}
@@ -1,123 +1,295 @@
 package repository
 
 import (
-	"container/list"
+	"fmt"
 	"sync"
 	"time"
 )
 
+// entryOverhead approximates the bookkeeping bytes of a cache entry beyond its key and value.
+const entryOverhead = 64
+
+// CacheConfig configures a MemoryRepo.
+type CacheConfig struct {
+	MaxBytes    int64         // total size of cached keys and values
+	TTL         time.Duration // lifetime of a cached value
+	NegativeTTL time.Duration // lifetime of a cached miss; 0 disables negative caching
+	Policy      string        // eviction policy: lru, lfu or tinylfu
+}
+
+// CacheResult is the outcome of a MemoryRepo lookup.
+type CacheResult int
+
+const (
+	CacheMiss        CacheResult = iota // nothing is known about the key
+	CacheHit                            // the key is cached with a value
+	CacheNegativeHit                    // the key is known not to exist
+)
+
+// CacheStats counts cache activity since the MemoryRepo was created.
+type CacheStats struct {
+	Hits         uint64
+	NegativeHits uint64
+	Misses       uint64
+	Evictions    uint64 // entries dropped to make room
+	Expirations  uint64 // entries dropped because their TTL passed
+	Rejections   uint64 // values the eviction policy declined to admit
+	Entries      int
+	Bytes        int64
+}
+
 // CacheEntry represents a single entry in the cache.
 type CacheEntry struct {
 	Key        string
 	Value      string
+	Index      uint64 // raft index the value was written at
+	Negative   bool   // the key did not exist at Index
 	Expiration time.Time
 }
 
-// MemoryRepo implements an in-memory Key-Value store with TTL and LRU eviction.
+func (e *CacheEntry) size() int64 {
+	return int64(len(e.Key) + len(e.Value) + entryOverhead)
+}
+
+// MemoryRepo implements an in-memory Key-Value cache bounded by bytes, with
+// TTL expiry and a pluggable eviction policy.
+//
+// Every entry is versioned by the raft index it was written at, and a write
+// never replaces an entry with a newer index. Keys that are not cached only
+// accept writes at or above floor, the highest index of any entry that was
+// invalidated or dropped, so a stale write cannot resurrect an old value.
 type MemoryRepo struct {
-	mu       sync.Mutex
-	capacity int
-	ttl      time.Duration
-	cache    map[string]*list.Element
-	lruList  *list.List
+	mu     sync.Mutex
+	config CacheConfig
+	cache  map[string]*CacheEntry
+	policy evictionPolicy
+	bytes  int64
+	floor  uint64
+	stats  CacheStats
+	stopc  chan struct{}
 }
 
-// NewMemoryRepo creates a new MemoryRepo with the given capacity and TTL.
-func NewMemoryRepo(capacity int, ttl time.Duration) *MemoryRepo {
+// Validate reports the first setting of config a MemoryRepo cannot run with.
+func (c CacheConfig) Validate() error {
+	switch {
+	case c.MaxBytes < 0:
+		return fmt.Errorf("cache size must not be negative, got %d", c.MaxBytes)
+	case c.TTL <= 0:
+		return fmt.Errorf("cache TTL must be positive, got %v", c.TTL)
+	case c.NegativeTTL < 0:
+		return fmt.Errorf("negative cache TTL must be zero or positive, got %v", c.NegativeTTL)
+	case !IsCachePolicy(c.Policy):
+		return fmt.Errorf("unknown cache eviction policy: %s", c.Policy)
+	}
+	return nil
+}
+
+// NewMemoryRepo creates a new MemoryRepo with the given configuration.
+func NewMemoryRepo(config CacheConfig) (*MemoryRepo, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	policy, err := newEvictionPolicy(config.Policy, int(config.MaxBytes/(entryOverhead*2)))
+	if err != nil {
+		return nil, err
+	}
 	repo := &MemoryRepo{
-		capacity: capacity,
-		ttl:      ttl,
-		cache:    make(map[string]*list.Element),
-		lruList:  list.New(),
+		config: config,
+		cache:  make(map[string]*CacheEntry),
+		policy: policy,
+		stopc:  make(chan struct{}),
 	}
 	// Start a background goroutine to clean up expired entries.
 	go repo.startEviction()
-	return repo
+	return repo, nil
+}
+
+// Put adds or updates a Key-Value pair written at the given raft index.
+// It returns false if the write was older than what the cache has already seen.
+func (m *MemoryRepo) Put(key, value string, index uint64) bool {
+	return m.put(&CacheEntry{
+		Key:        key,
+		Value:      value,
+		Index:      index,
+		Expiration: time.Now().Add(m.config.TTL),
+	})
+}
+
+// PutNegative records that key did not exist at the given raft index.
+// It is a no-op when negative caching is disabled.
+func (m *MemoryRepo) PutNegative(key string, index uint64) bool {
+	if m.config.NegativeTTL <= 0 {
+		return true
+	}
+	return m.put(&CacheEntry{
+		Key:        key,
+		Index:      index,
+		Negative:   true,
+		Expiration: time.Now().Add(m.config.NegativeTTL),
+	})
 }
 
-// Put adds or updates a Key-Value pair in the cache.
-func (m *MemoryRepo) Put(key, value string) error {
+func (m *MemoryRepo) put(entry *CacheEntry) bool {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if elem, ok := m.cache[key]; ok {
-		// Update existing entry.
-		entry := elem.Value.(*CacheEntry)
-		entry.Value = value
-		entry.Expiration = time.Now().Add(m.ttl)
-		m.lruList.MoveToFront(elem)
-	} else {
-		// Add new entry.
-		entry := &CacheEntry{
-			Key:        key,
-			Value:      value,
-			Expiration: time.Now().Add(m.ttl),
+	old, exists := m.cache[entry.Key]
+	if exists {
+		if entry.Index < old.Index {
+			return false
 		}
-		elem := m.lruList.PushFront(entry)
-		m.cache[key] = elem
+		m.removeEntry(old)
+	} else if entry.Index < m.floor {
+		return false
+	}
 
-		// Check capacity and evict if necessary.
-		if m.lruList.Len() > m.capacity {
-			m.evict()
+	if entry.size() > m.config.MaxBytes {
+		// Too big to ever fit; the value is current but not cached.
+		m.raiseFloor(entry.Index)
+		return true
+	}
+	if victim, ok := m.policy.victim(); ok && !exists && m.bytes+entry.size() > m.config.MaxBytes {
+		if !m.policy.admit(entry.Key, victim) {
+			m.stats.Rejections++
+			m.raiseFloor(entry.Index)
+			return true
 		}
 	}
-	return nil
+
+	m.makeRoom(entry.size())
+	m.cache[entry.Key] = entry
+	m.bytes += entry.size()
+	m.policy.add(entry.Key)
+	return true
 }
 
-// Get retrieves the Value for a given Key.
-func (m *MemoryRepo) Get(key string) (string, bool, error) {
+// Get looks up key. The value is only meaningful for a CacheHit.
+func (m *MemoryRepo) Get(key string) (string, CacheResult) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	if elem, ok := m.cache[key]; ok {
-		entry := elem.Value.(*CacheEntry)
-		if time.Now().After(entry.Expiration) {
-			// Entry has expired.
-			m.removeElement(elem)
-			return "", false, nil
+	m.policy.record(key)
+	entry, ok := m.cache[key]
+	if !ok {
+		m.stats.Misses++
+		return "", CacheMiss
+	}
+	if time.Now().After(entry.Expiration) {
+		// Entry has expired.
+		m.removeEntry(entry)
+		m.stats.Expirations++
+		m.stats.Misses++
+		return "", CacheMiss
+	}
+	m.policy.touch(key)
+	if entry.Negative {
+		m.stats.NegativeHits++
+		return "", CacheNegativeHit
+	}
+	m.stats.Hits++
+	return entry.Value, CacheHit
+}
+
+// Invalidate drops the entry for key because it was deleted at the given index.
+func (m *MemoryRepo) Invalidate(key string, index uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if entry, ok := m.cache[key]; ok {
+		m.removeEntry(entry)
+	}
+	m.raiseFloor(index)
+}
+
+// Purge drops every entry because the state was replaced by a snapshot at the given index.
+func (m *MemoryRepo) Purge(index uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cache = make(map[string]*CacheEntry)
+	m.policy.reset()
+	m.bytes = 0
+	m.raiseFloor(index)
+}
+
+// Entries returns a copy of all cached values, leaving out negative entries.
+func (m *MemoryRepo) Entries() []CacheEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entries := make([]CacheEntry, 0, len(m.cache))
+	for _, entry := range m.cache {
+		if !entry.Negative {
+			entries = append(entries, *entry)
 		}
-		// Update LRU order.
-		m.lruList.MoveToFront(elem)
-		return entry.Value, true, nil
 	}
-	return "", false, nil
+	return entries
 }
 
-// evict removes the least recently used item from the cache.
-func (m *MemoryRepo) evict() {
-	elem := m.lruList.Back()
-	if elem != nil {
-		m.removeElement(elem)
+// Stats returns a copy of the cache counters.
+func (m *MemoryRepo) Stats() CacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Entries = len(m.cache)
+	stats.Bytes = m.bytes
+	return stats
+}
+
+// Close stops the background expiry goroutine.
+func (m *MemoryRepo) Close() {
+	close(m.stopc)
+}
+
+// makeRoom evicts entries until size more bytes fit within the byte limit.
+func (m *MemoryRepo) makeRoom(size int64) {
+	for m.bytes+size > m.config.MaxBytes {
+		key, ok := m.policy.victim()
+		if !ok {
+			return
+		}
+		m.removeEntry(m.cache[key])
+		m.stats.Evictions++
 	}
 }
 
-// removeElement removes an element from the cache and list.
-func (m *MemoryRepo) removeElement(elem *list.Element) {
-	m.lruList.Remove(elem)
-	entry := elem.Value.(*CacheEntry)
+// removeEntry removes an entry from the cache and the eviction policy.
+func (m *MemoryRepo) removeEntry(entry *CacheEntry) {
 	delete(m.cache, entry.Key)
+	m.policy.remove(entry.Key)
+	m.bytes -= entry.size()
+	m.raiseFloor(entry.Index)
+}
+
+func (m *MemoryRepo) raiseFloor(index uint64) {
+	if index > m.floor {
+		m.floor = index
+	}
 }
 
 // startEviction runs in the background to remove expired entries.
 func (m *MemoryRepo) startEviction() {
-	ticker := time.NewTicker(m.ttl / 2)
+	interval := m.config.TTL
+	if m.config.NegativeTTL > 0 && m.config.NegativeTTL < interval {
+		interval = m.config.NegativeTTL
+	}
+	ticker := time.NewTicker(interval / 2)
 	defer ticker.Stop()
 	for {
-		<-ticker.C
+		select {
+		case <-m.stopc:
+			return
+		case <-ticker.C:
+		}
 		m.mu.Lock()
 		now := time.Now()
-		for elem := m.lruList.Back(); elem != nil; {
-			prev := elem.Prev()
-			entry := elem.Value.(*CacheEntry)
+		for _, entry := range m.cache {
 			if now.After(entry.Expiration) {
-				m.removeElement(elem)
+				m.removeEntry(entry)
+				m.stats.Expirations++
 			}
-			elem = prev
 		}
 		m.mu.Unlock()
 	}
 }
-
-func (m *MemoryRepo) GetCache() map[string]*list.Element {
-	return m.cache
-}
@@ -0,0 +1,256 @@
+package repository
+
+import (
+	"math/rand"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestMemoryRepo(t *testing.T, maxBytes int64, policy string) *MemoryRepo {
+	t.Helper()
+	m, err := NewMemoryRepo(CacheConfig{
+		MaxBytes:    maxBytes,
+		TTL:         time.Minute,
+		NegativeTTL: time.Minute,
+		Policy:      policy,
+	})
+	if err != nil {
+		t.Fatalf("NewMemoryRepo: %v", err)
+	}
+	t.Cleanup(m.Close)
+	return m
+}
+
+// entrySize is the accounted size of an entry with a one-byte key and value.
+const entrySize = 2 + entryOverhead
+
+func TestMemoryRepoRejectsStaleWrites(t *testing.T) {
+	m := newTestMemoryRepo(t, 1<<20, PolicyLRU)
+
+	if !m.Put("k", "v5", 5) {
+		t.Fatalf("first write rejected")
+	}
+	if m.Put("k", "v3", 3) {
+		t.Fatalf("stale write accepted")
+	}
+	if !m.Put("k", "v5b", 5) {
+		t.Fatalf("write at the same index rejected")
+	}
+	if value, result := m.Get("k"); result != CacheHit || value != "v5b" {
+		t.Fatalf("Get = %q, %v; want \"v5b\", hit", value, result)
+	}
+}
+
+func TestMemoryRepoInvalidate(t *testing.T) {
+	m := newTestMemoryRepo(t, 1<<20, PolicyLRU)
+
+	m.Put("k", "v", 5)
+	m.Invalidate("k", 6)
+	if _, result := m.Get("k"); result != CacheMiss {
+		t.Fatalf("invalidated key still cached")
+	}
+	if m.Put("k", "v", 5) {
+		t.Fatalf("write older than the delete was accepted")
+	}
+	if !m.Put("k", "v7", 7) {
+		t.Fatalf("write newer than the delete was rejected")
+	}
+}
+
+func TestMemoryRepoPurge(t *testing.T) {
+	m := newTestMemoryRepo(t, 1<<20, PolicyLRU)
+
+	m.Put("a", "1", 1)
+	m.Put("b", "2", 2)
+	m.Purge(10)
+	if len(m.Entries()) != 0 {
+		t.Fatalf("purge left entries behind: %v", m.Entries())
+	}
+	if m.Put("a", "1", 9) {
+		t.Fatalf("write older than the snapshot was accepted")
+	}
+	if !m.Put("a", "11", 11) {
+		t.Fatalf("write newer than the snapshot was rejected")
+	}
+}
+
+func TestMemoryRepoEvictedKeysStayVersioned(t *testing.T) {
+	m := newTestMemoryRepo(t, entrySize, PolicyLRU)
+
+	m.Put("a", "n", 8)
+	m.Put("b", "x", 9) // evicts a
+	if m.Put("a", "old", 4) {
+		t.Fatalf("stale write for an evicted key was accepted")
+	}
+}
+
+// TestMemoryRepoReadsNeverRegress writes every index for a key from many
+// goroutines in random order while readers check that the value they observe
+// only ever moves forward. Run with -race.
+func TestMemoryRepoReadsNeverRegress(t *testing.T) {
+	const (
+		writers = 8
+		readers = 4
+		writes  = 500
+	)
+	m := newTestMemoryRepo(t, 1<<20, PolicyLRU)
+
+	var writeWG, readWG sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < readers; r++ {
+		readWG.Add(1)
+		go func() {
+			defer readWG.Done()
+			last := 0
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				value, result := m.Get("k")
+				if result != CacheHit {
+					continue
+				}
+				n, _ := strconv.Atoi(value)
+				if n < last {
+					t.Errorf("read regressed from %d to %d", last, n)
+					return
+				}
+				last = n
+			}
+		}()
+	}
+
+	for w := 0; w < writers; w++ {
+		writeWG.Add(1)
+		go func(seed int64) {
+			defer writeWG.Done()
+			for _, i := range rand.New(rand.NewSource(seed)).Perm(writes) {
+				index := uint64(i + 1)
+				m.Put("k", strconv.FormatUint(index, 10), index)
+			}
+		}(int64(w))
+	}
+
+	writeWG.Wait()
+	close(done)
+	readWG.Wait()
+
+	if value, result := m.Get("k"); result != CacheHit || value != strconv.Itoa(writes) {
+		t.Fatalf("final value = %q, %v; want %q", value, result, strconv.Itoa(writes))
+	}
+}
+
+func TestMemoryRepoByteLimit(t *testing.T) {
+	m := newTestMemoryRepo(t, 3*entrySize, PolicyLRU)
+
+	for i, k := range []string{"a", "b", "c", "d"} {
+		m.Put(k, "v", uint64(i+1))
+	}
+	stats := m.Stats()
+	if stats.Bytes > 3*entrySize || stats.Entries != 3 || stats.Evictions != 1 {
+		t.Fatalf("stats = %+v; want 3 entries within the limit and 1 eviction", stats)
+	}
+	if _, result := m.Get("a"); result != CacheMiss {
+		t.Fatalf("least recently used key was not evicted")
+	}
+
+	// A value larger than the whole cache is never cached.
+	m.Put("big", string(make([]byte, 4*entrySize)), 5)
+	if _, result := m.Get("big"); result != CacheMiss {
+		t.Fatalf("oversized value was cached")
+	}
+}
+
+func TestMemoryRepoLFUPolicy(t *testing.T) {
+	m := newTestMemoryRepo(t, 2*entrySize, PolicyLFU)
+
+	m.Put("a", "v", 1)
+	m.Put("b", "v", 2)
+	m.Get("a")
+	m.Get("a")
+	m.Put("c", "v", 3) // evicts b, the least frequently used
+
+	if _, result := m.Get("a"); result != CacheHit {
+		t.Fatalf("frequently used key was evicted")
+	}
+	if _, result := m.Get("b"); result != CacheMiss {
+		t.Fatalf("least frequently used key was kept")
+	}
+}
+
+func TestMemoryRepoTinyLFUAdmission(t *testing.T) {
+	m := newTestMemoryRepo(t, 2*entrySize, PolicyTinyLFU)
+
+	m.Put("a", "v", 1)
+	m.Put("b", "v", 2)
+	for i := 0; i < 5; i++ {
+		m.Get("a")
+		m.Get("b")
+	}
+
+	// A key seen once does not displace popular keys.
+	m.Get("x")
+	m.Put("x", "v", 3)
+	if _, result := m.Get("x"); result != CacheMiss {
+		t.Fatalf("unpopular key was admitted")
+	}
+	if m.Stats().Rejections != 1 {
+		t.Fatalf("rejections = %d, want 1", m.Stats().Rejections)
+	}
+
+	// A key looked up more often than the victim is admitted.
+	for i := 0; i < 10; i++ {
+		m.Get("y")
+	}
+	m.Put("y", "v", 4)
+	if _, result := m.Get("y"); result != CacheHit {
+		t.Fatalf("popular key was not admitted")
+	}
+}
+
+func TestMemoryRepoNegativeCaching(t *testing.T) {
+	m := newTestMemoryRepo(t, 1<<20, PolicyLRU)
+
+	m.PutNegative("k", 3)
+	if _, result := m.Get("k"); result != CacheNegativeHit {
+		t.Fatalf("Get = %v, want negative hit", result)
+	}
+	m.Put("k", "v", 4)
+	if value, result := m.Get("k"); result != CacheHit || value != "v" {
+		t.Fatalf("Get = %q, %v; want \"v\", hit", value, result)
+	}
+	if len(m.Entries()) != 1 {
+		t.Fatalf("Entries = %v", m.Entries())
+	}
+
+	stats := m.Stats()
+	if stats.Hits != 1 || stats.NegativeHits != 1 {
+		t.Fatalf("stats = %+v", stats)
+	}
+}
+
+func TestCacheConfigValidate(t *testing.T) {
+	valid := CacheConfig{MaxBytes: 1 << 20, TTL: time.Second, Policy: PolicyLRU}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+	for name, mutate := range map[string]func(*CacheConfig){
+		"negative size":         func(c *CacheConfig) { c.MaxBytes = -1 },
+		"zero TTL":              func(c *CacheConfig) { c.TTL = 0 },
+		"negative negative TTL": func(c *CacheConfig) { c.NegativeTTL = -time.Second },
+		"unknown policy":        func(c *CacheConfig) { c.Policy = "fifo" },
+	} {
+		config := valid
+		mutate(&config)
+		if err := config.Validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+		if _, err := NewMemoryRepo(config); err == nil {
+			t.Errorf("%s: NewMemoryRepo accepted it", name)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Keys starting with ReservedPrefix hold the state machine's own bookkeeping.
+// They are replicated and snapshotted like any other key but are never
+// served to clients.
+const ReservedPrefix = "\x00"
+
+// MetaPrefix holds node-local progress that is not part of the replicated state.
+const MetaPrefix = ReservedPrefix + "meta/"
+
+// CoordinationPrefix holds the state the load balancers coordinate through,
+// such as their lease. Unlike other reserved keys, these are served, but only
+// to Get and CompareAndSwap, so no client Put or Delete can disturb them.
+const CoordinationPrefix = ReservedPrefix + "coord/"
+
+const appliedIndexKey = MetaPrefix + "applied_index"
+
+func IsReservedKey(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+func IsCoordinationKey(key string) bool {
+	return strings.HasPrefix(key, CoordinationPrefix)
+}
+
+// AppliedIndexOp records index as the last raft index applied to the engine.
+// Batch it with the entry's own ops so both land atomically.
+func AppliedIndexOp(index uint64) Op {
+	return Op{Type: OpPut, Key: appliedIndexKey, Value: strconv.FormatUint(index, 10)}
+}
+
+// ReadAppliedIndex returns the index stored by AppliedIndexOp, or 0 if there is none.
+func ReadAppliedIndex(engine StorageEngine) (uint64, error) {
+	value, found, err := engine.Get(appliedIndexKey)
+	if err != nil || !found {
+		return 0, err
+	}
+	index, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid applied index %q: %w", value, err)
+	}
+	return index, nil
+}
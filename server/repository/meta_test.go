@@ -0,0 +1,23 @@
+package repository
+
+import "testing"
+
+func TestCoordinationKeysAreReserved(t *testing.T) {
+	cases := []struct {
+		key                    string
+		reserved, coordination bool
+	}{
+		{"lb/leader", false, false},
+		{CoordinationPrefix + "lb/leader", true, true},
+		{MetaPrefix + "applied_index", true, false},
+		{ReservedPrefix + "member/1", true, false},
+	}
+	for _, c := range cases {
+		if got := IsReservedKey(c.key); got != c.reserved {
+			t.Errorf("IsReservedKey(%q) = %v, want %v", c.key, got, c.reserved)
+		}
+		if got := IsCoordinationKey(c.key); got != c.coordination {
+			t.Errorf("IsCoordinationKey(%q) = %v, want %v", c.key, got, c.coordination)
+		}
+	}
+}
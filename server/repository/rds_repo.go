@@ -5,6 +5,9 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
 )
 
 type RDSRepo struct {
@@ -17,6 +20,30 @@ func NewRDSRepo(db *sql.DB) *RDSRepo {
 	}
 }
 
+// OpenRDSRepo opens the SQLite database at path with the default options
+// and migrates its schema to the latest version.
+func OpenRDSRepo(path string) (*RDSRepo, error) {
+	return OpenRDSRepoWithOptions(path, SQLiteOptions{})
+}
+
+// OpenRDSRepoWithOptions opens the SQLite database at path and migrates its
+// schema to the latest version.
+func OpenRDSRepoWithOptions(path string, opts SQLiteOptions) (*RDSRepo, error) {
+	dsn, err := opts.dsn(path)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return NewRDSRepo(db), nil
+}
+
 func (r *RDSRepo) Put(key, value string) error {
 	_, err := r.db.Exec(`INSERT INTO kv (Key, Value) VALUES (?, ?)
                          ON CONFLICT(Key) DO UPDATE SET Value = excluded.Value;`,
@@ -40,8 +67,103 @@ func (r *RDSRepo) Get(key string) (string, bool, error) {
 	return value, true, nil
 }
 
-// Serialize all data to JSON
-func (r *RDSRepo) Serialize() ([]byte, error) {
+func (r *RDSRepo) Delete(key string) error {
+	_, err := r.db.Exec(`DELETE FROM kv WHERE Key = ?;`, key)
+	return err
+}
+
+func (r *RDSRepo) Range(start, end string, fn func(key, value string) bool) error {
+	return rangeRows(r.db, start, end, fn)
+}
+
+// rangeRows runs Range's query on a database or a transaction.
+func rangeRows(q interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, start, end string, fn func(key, value string) bool) error {
+	var rows *sql.Rows
+	var err error
+	if end == "" {
+		rows, err = q.Query(`SELECT Key, Value FROM kv WHERE Key >= ? ORDER BY Key;`, start)
+	} else {
+		rows, err = q.Query(`SELECT Key, Value FROM kv WHERE Key >= ? AND Key < ? ORDER BY Key;`, start, end)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			break
+		}
+	}
+	return rows.Err()
+}
+
+// View holds a read transaction. Only in WAL journal mode do writers go on
+// while it is open; in the other modes it returns ErrViewUnsupported.
+func (r *RDSRepo) View() (View, error) {
+	var mode string
+	if err := r.db.QueryRow(`PRAGMA journal_mode;`).Scan(&mode); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(mode, "wal") {
+		return nil, ErrViewUnsupported
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	// The transaction reads from the database as of its first read.
+	var n int
+	if err := tx.QueryRow(`SELECT count(*) FROM (SELECT 1 FROM kv LIMIT 1);`).Scan(&n); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return rdsView{tx: tx}, nil
+}
+
+type rdsView struct {
+	tx *sql.Tx
+}
+
+func (v rdsView) Range(start, end string, fn func(key, value string) bool) error {
+	return rangeRows(v.tx, start, end, fn)
+}
+
+func (v rdsView) Close() error {
+	return v.tx.Rollback()
+}
+
+func (r *RDSRepo) Batch(ops []Op) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, op := range ops {
+		switch op.Type {
+		case OpPut:
+			_, err = tx.Exec(`INSERT INTO kv (Key, Value) VALUES (?, ?)
+                              ON CONFLICT(Key) DO UPDATE SET Value = excluded.Value;`, op.Key, op.Value)
+		case OpDelete:
+			_, err = tx.Exec(`DELETE FROM kv WHERE Key = ?;`, op.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Snapshot serializes all data to JSON
+func (r *RDSRepo) Snapshot() ([]byte, error) {
 	rows, err := r.db.Query(`SELECT Key, Value FROM kv`)
 	if err != nil {
 		return nil, err
@@ -56,12 +178,15 @@ func (r *RDSRepo) Serialize() ([]byte, error) {
 		}
 		kvPairs = append(kvPairs, kv)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
 	return json.Marshal(kvPairs)
 }
 
-// Deserialize JSON data and load it into the database
-func (r *RDSRepo) Deserialize(data []byte) error {
+// Restore replaces the contents of the database with the JSON data
+func (r *RDSRepo) Restore(data []byte) error {
 	var kvPairs []models.KVPair
 	if err := json.Unmarshal(data, &kvPairs); err != nil {
 		return err
@@ -73,6 +198,10 @@ func (r *RDSRepo) Deserialize(data []byte) error {
 	}
 	defer tx.Rollback()
 
+	if _, err := tx.Exec(`DELETE FROM kv;`); err != nil {
+		return err
+	}
+
 	stmt, err := tx.Prepare(`INSERT INTO kv (Key, Value) VALUES (?, ?)
                              ON CONFLICT(Key) DO UPDATE SET Value = excluded.Value;`)
 	if err != nil {
@@ -88,3 +217,66 @@ func (r *RDSRepo) Deserialize(data []byte) error {
 
 	return tx.Commit()
 }
+
+// Size returns the size of the database file, free pages included.
+func (r *RDSRepo) Size() (int64, error) {
+	var pageCount, pageSize int64
+	if err := r.db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := r.db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// Vacuum rebuilds the database file without its free pages, or with
+// incremental set, only releases the free pages at the end of the file.
+// It returns the bytes the file shrank by.
+func (r *RDSRepo) Vacuum(incremental bool) (int64, error) {
+	before, err := r.Size()
+	if err != nil {
+		return 0, err
+	}
+	if incremental {
+		var mode int
+		if err := r.db.QueryRow("PRAGMA auto_vacuum").Scan(&mode); err != nil {
+			return 0, err
+		}
+		if mode != 2 {
+			return 0, errors.New("incremental vacuum needs auto_vacuum=INCREMENTAL; run a full vacuum once to convert the database")
+		}
+		// The pragma frees one page per step, so it has to be read to the end.
+		err = drainQuery(r.db, "PRAGMA incremental_vacuum")
+	} else {
+		// A full vacuum also converts older databases to auto_vacuum=INCREMENTAL.
+		_, err = r.db.Exec("VACUUM")
+	}
+	if err != nil {
+		return 0, err
+	}
+	// In WAL mode the main file only shrinks once the WAL is checkpointed.
+	if _, err := r.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		return 0, err
+	}
+	after, err := r.Size()
+	if err != nil {
+		return 0, err
+	}
+	return before - after, nil
+}
+
+func drainQuery(db *sql.DB, query string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+func (r *RDSRepo) Close() error {
+	return r.db.Close()
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+)
+
+// SQLiteOptions configures how an RDSRepo opens its database.
+type SQLiteOptions struct {
+	// JournalMode is one of delete, truncate, persist, memory, wal or off.
+	// The default is wal.
+	JournalMode string
+	// Synchronous is one of off, normal, full or extra. The default is
+	// normal: in WAL mode a crash can then lose the last transactions but
+	// never corrupts the database, and the raft log replays what was lost.
+	Synchronous string
+}
+
+func (o SQLiteOptions) dsn(path string) (string, error) {
+	journal, err := pragmaValue("journal mode", o.JournalMode, "wal", "delete", "truncate", "persist", "memory", "wal", "off")
+	if err != nil {
+		return "", err
+	}
+	synchronous, err := pragmaValue("synchronous", o.Synchronous, "normal", "off", "normal", "full", "extra")
+	if err != nil {
+		return "", err
+	}
+	params := url.Values{}
+	params.Set("_journal_mode", journal)
+	params.Set("_synchronous", synchronous)
+	params.Set("_busy_timeout", "5000") // writers wait out a running VACUUM
+	// Only takes effect on new databases; a full VACUUM converts old ones.
+	params.Set("_auto_vacuum", "incremental")
+	return path + "?" + params.Encode(), nil
+}
+
+func pragmaValue(name, value, def string, allowed ...string) (string, error) {
+	if value == "" {
+		return strings.ToUpper(def), nil
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return strings.ToUpper(a), nil
+		}
+	}
+	return "", fmt.Errorf("invalid SQLite %s %q, want one of %s", name, value, strings.Join(allowed, ", "))
+}
+
+// migration upgrades the schema from version-1 to version. Migrations run
+// in order, each in its own transaction, and are never edited once released:
+// add a new one instead.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+var rdsMigrations = []migration{
+	{
+		version:     1,
+		description: "create kv table",
+		statements: []string{
+			// Databases from before schema versioning already have this table.
+			`CREATE TABLE IF NOT EXISTS kv (
+				key TEXT PRIMARY KEY,
+				value TEXT
+			)`,
+		},
+	},
+}
+
+// migrate brings the schema up to the latest version, recording each step
+// in the schema_version table.
+func migrate(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := rdsMigrations[len(rdsMigrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than the latest known version %d", current, latest)
+	}
+
+	for _, m := range rdsMigrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migrate schema to version %d (%s): %w", m.version, m.description, err)
+		}
+		log.Printf("Migrated database schema to version %d: %s\n", m.version, m.description)
+	}
+	return nil
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	return version, err
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, stmt := range m.statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, description) VALUES (?, ?)`, m.version, m.description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRDSRepoMigratesNewDatabase(t *testing.T) {
+	r, err := OpenRDSRepo(filepath.Join(t.TempDir(), "kv.db"))
+	if err != nil {
+		t.Fatalf("OpenRDSRepo: %v", err)
+	}
+	defer r.Close()
+
+	version, err := schemaVersion(r.db)
+	if err != nil {
+		t.Fatalf("schemaVersion: %v", err)
+	}
+	if latest := rdsMigrations[len(rdsMigrations)-1].version; version != latest {
+		t.Fatalf("schema version = %d, want %d", version, latest)
+	}
+	var mode string
+	if err := r.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "wal" {
+		t.Fatalf("journal mode = %q, %v; want wal", mode, err)
+	}
+}
+
+func TestRDSRepoMigratesLegacyDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The schema from before versioning.
+	for _, stmt := range []string{
+		`CREATE TABLE IF NOT EXISTS kv (key TEXT PRIMARY KEY, value TEXT);`,
+		`INSERT INTO kv (key, value) VALUES ('k', 'v');`,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	r, err := OpenRDSRepo(path)
+	if err != nil {
+		t.Fatalf("OpenRDSRepo: %v", err)
+	}
+	defer r.Close()
+	if value, found := mustGet(t, r, "k"); !found || value != "v" {
+		t.Fatalf("Get = %q, %v; want \"v\", true", value, found)
+	}
+}
+
+func TestRDSRepoRejectsNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	r, err := OpenRDSRepo(path)
+	if err != nil {
+		t.Fatalf("OpenRDSRepo: %v", err)
+	}
+	if _, err := r.db.Exec(`INSERT INTO schema_version (version, description) VALUES (1000, 'from the future')`); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+
+	if _, err := OpenRDSRepo(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("OpenRDSRepo = %v, want a newer schema error", err)
+	}
+}
+
+func TestRDSRepoOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kv.db")
+	if _, err := OpenRDSRepoWithOptions(path, SQLiteOptions{Synchronous: "sometimes"}); err == nil {
+		t.Fatalf("invalid synchronous setting accepted")
+	}
+	r, err := OpenRDSRepoWithOptions(path, SQLiteOptions{JournalMode: "DELETE", Synchronous: "full"})
+	if err != nil {
+		t.Fatalf("OpenRDSRepoWithOptions: %v", err)
+	}
+	defer r.Close()
+	var mode string
+	if err := r.db.QueryRow("PRAGMA journal_mode").Scan(&mode); err != nil || mode != "delete" {
+		t.Fatalf("journal mode = %q, %v; want delete", mode, err)
+	}
+}
+
+func TestRDSRepoVacuum(t *testing.T) {
+	for _, incremental := range []bool{false, true} {
+		t.Run(fmt.Sprintf("incremental=%v", incremental), func(t *testing.T) {
+			r, err := OpenRDSRepo(filepath.Join(t.TempDir(), "kv.db"))
+			if err != nil {
+				t.Fatalf("OpenRDSRepo: %v", err)
+			}
+			defer r.Close()
+
+			var ops []Op
+			for i := 0; i < 2000; i++ {
+				ops = append(ops, Op{Type: OpPut, Key: fmt.Sprintf("key-%04d", i), Value: strings.Repeat("v", 500)})
+			}
+			if err := r.Batch(ops); err != nil {
+				t.Fatalf("Batch: %v", err)
+			}
+			for i := range ops {
+				ops[i].Type = OpDelete
+			}
+			if err := r.Batch(ops); err != nil {
+				t.Fatalf("Batch: %v", err)
+			}
+
+			reclaimed, err := Vacuum(NewCodecRepo(r), incremental)
+			if err != nil {
+				t.Fatalf("Vacuum: %v", err)
+			}
+			if reclaimed < 500*1000 {
+				t.Fatalf("Vacuum reclaimed %d bytes, want most of the deleted data", reclaimed)
+			}
+		})
+	}
+
+	if _, err := Vacuum(NewMapRepo(), false); err != ErrVacuumUnsupported {
+		t.Fatalf("Vacuum of MapRepo = %v, want ErrVacuumUnsupported", err)
+	}
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"cs739-kv-store/repository"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// AlarmCorrupt is raised for a member whose state hash diverged from the rest of the cluster.
+	AlarmCorrupt = "CORRUPT"
+	// AlarmNoSpace is raised for a member whose storage grew past its quota.
+	// While it is active the cluster rejects writes.
+	AlarmNoSpace = "NOSPACE"
+)
+
+// alarmPrefix holds active alarms as alarmPrefix + type + "/" + member ID.
+// Alarms are raised through raft, so every replica stores the same set.
+const alarmPrefix = repository.ReservedPrefix + "alarm/"
+
+type Alarm struct {
+	Member uint64
+	Type   string
+	Detail string
+}
+
+// IsAlarmKey reports whether key holds an alarm.
+func IsAlarmKey(key string) bool {
+	return strings.HasPrefix(key, alarmPrefix)
+}
+
+func alarmKey(alarmType string, member uint64) string {
+	return alarmPrefix + alarmType + "/" + strconv.FormatUint(member, 10)
+}
+
+func parseAlarm(key, detail string) (Alarm, error) {
+	alarmType, member, ok := strings.Cut(strings.TrimPrefix(key, alarmPrefix), "/")
+	if !ok {
+		return Alarm{}, fmt.Errorf("invalid alarm key %q", key)
+	}
+	id, err := strconv.ParseUint(member, 10, 64)
+	if err != nil {
+		return Alarm{}, fmt.Errorf("invalid alarm key %q: %w", key, err)
+	}
+	return Alarm{Member: id, Type: alarmType, Detail: detail}, nil
+}
+
+// RaiseAlarm proposes an alarm for member. Raising an active alarm is a no-op.
+func (s *Kvstore) RaiseAlarm(alarmType string, member uint64, detail string) error {
+	alarms, err := s.Alarms()
+	if err != nil {
+		return err
+	}
+	for _, a := range alarms {
+		if a.Type == alarmType && a.Member == member {
+			return nil
+		}
+	}
+	s.propose(kv{Key: alarmType, Val: detail, Op: opRaiseAlarm, Member: member})
+	return nil
+}
+
+// ClearAlarm proposes clearing an alarm of member.
+func (s *Kvstore) ClearAlarm(alarmType string, member uint64) {
+	s.propose(kv{Key: alarmType, Op: opClearAlarm, Member: member})
+}
+
+// HasAlarm reports whether an alarm of the given type is active for any member.
+func (s *Kvstore) HasAlarm(alarmType string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasAlarm(alarmType)
+}
+
+// hasAlarm is HasAlarm for callers that hold s.mu.
+func (s *Kvstore) hasAlarm(alarmType string) (bool, error) {
+	prefix := alarmPrefix + alarmType + "/"
+	var found bool
+	err := s.storage.Range(prefix, repository.PrefixEnd(prefix), func(string, string) bool {
+		found = true
+		return false
+	})
+	return found, err
+}
+
+// Alarms lists the active alarms.
+func (s *Kvstore) Alarms() ([]Alarm, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var alarms []Alarm
+	var parseErr error
+	err := s.storage.Range(alarmPrefix, repository.PrefixEnd(alarmPrefix), func(key, value string) bool {
+		var a Alarm
+		if a, parseErr = parseAlarm(key, value); parseErr != nil {
+			return false
+		}
+		alarms = append(alarms, a)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return alarms, parseErr
+}
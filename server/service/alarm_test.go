@@ -0,0 +1,68 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitFor fails the test unless cond holds within a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestNoSpaceAlarmRejectsWrites(t *testing.T) {
+	s := newCommittingStore(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, key := range []string{"a", "b"} {
+		if _, _, err := s.Put(key, "1"); err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, "put of "+key, func() bool { _, found, _ := s.Get(key); return found })
+	}
+	if err := s.RaiseAlarm(AlarmNoSpace, 2, "storage is 10 bytes, quota is 5 bytes"); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the alarm", func() bool { noSpace, _ := s.HasAlarm(AlarmNoSpace); return noSpace })
+
+	if _, _, err := s.Put("a", "2"); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("Put = %v, want ErrNoSpace", err)
+	}
+	if _, err := s.CompareAndSwap(ctx, "a", "1", false, "2"); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("CompareAndSwap = %v, want ErrNoSpace", err)
+	}
+	if err := s.PutBatch([]Pair{{Key: "c", Value: "1"}}); !errors.Is(err, ErrNoSpace) {
+		t.Fatalf("PutBatch = %v, want ErrNoSpace", err)
+	}
+
+	// Reads keep working, and deletes too, since they are how space is reclaimed.
+	if value, found, err := s.Get("a"); err != nil || !found || value != "1" {
+		t.Fatalf("Get = %q, %v, %v; want 1", value, found, err)
+	}
+	if _, found, err := s.Delete("b"); err != nil || !found {
+		t.Fatalf("Delete = %v, %v; want the key deleted", found, err)
+	}
+	waitFor(t, "the delete", func() bool { _, found, _ := s.Get("b"); return !found })
+
+	s.ClearAlarm(AlarmNoSpace, 2)
+	waitFor(t, "the alarm to clear", func() bool { noSpace, _ := s.HasAlarm(AlarmNoSpace); return !noSpace })
+	if _, _, err := s.Put("a", "2"); err != nil {
+		t.Fatalf("Put after clearing the alarm = %v", err)
+	}
+	waitFor(t, "the put", func() bool { value, _, _ := s.Get("a"); return value == "2" })
+	if result, err := s.CompareAndSwap(ctx, "a", "2", false, "3"); err != nil || !result.Swapped {
+		t.Fatalf("CompareAndSwap after clearing the alarm = %+v, %v; want swapped", result, err)
+	}
+	if err := s.PutBatch([]Pair{{Key: "c", Value: "1"}}); err != nil {
+		t.Fatalf("PutBatch after clearing the alarm = %v", err)
+	}
+	waitFor(t, "the import", func() bool { _, found, _ := s.Get("c"); return found })
+}
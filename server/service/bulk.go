@@ -0,0 +1,263 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"cs739-kv-store/repository"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+)
+
+// Pair is a key and its value.
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// RecordFormat is the encoding of key/value records for import and export.
+// The values match the RecordFormat enum of the protocol.
+type RecordFormat int
+
+const (
+	FormatNDJSON RecordFormat = iota // one {"key": ..., "value": ...} object per line
+	FormatCSV                        // key,value rows, with an optional key,value header row
+)
+
+// RecordError is a record that could not be parsed. Reading can go on after it.
+type RecordError struct {
+	Record int64 // 1-based position of the record in the input
+	Err    error
+}
+
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Record, e.Err)
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// RecordReader reads key/value records in a RecordFormat.
+type RecordReader struct {
+	next   func() (Pair, error)
+	record int64
+}
+
+func NewRecordReader(r io.Reader, format RecordFormat) (*RecordReader, error) {
+	rr := &RecordReader{}
+	switch format {
+	case FormatNDJSON:
+		br := bufio.NewReader(r)
+		rr.next = func() (Pair, error) { return rr.nextNDJSON(br) }
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		cr.ReuseRecord = true
+		rr.next = func() (Pair, error) { return rr.nextCSV(cr) }
+	default:
+		return nil, fmt.Errorf("unknown record format %d", format)
+	}
+	return rr, nil
+}
+
+// Next returns the next record. It returns a *RecordError for a malformed
+// record, io.EOF at the end of the input, and any other error if the input
+// could not be read.
+func (rr *RecordReader) Next() (Pair, error) {
+	return rr.next()
+}
+
+func (rr *RecordReader) nextNDJSON(br *bufio.Reader) (Pair, error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil && (err != io.EOF || len(line) == 0) {
+			return Pair{}, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		rr.record++
+		var rec struct {
+			Key   *string `json:"key"`
+			Value *string `json:"value"`
+		}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return Pair{}, &RecordError{Record: rr.record, Err: err}
+		}
+		if rec.Key == nil || rec.Value == nil {
+			return Pair{}, &RecordError{Record: rr.record, Err: errors.New(`record needs a "key" and a "value"`)}
+		}
+		return Pair{Key: *rec.Key, Value: *rec.Value}, nil
+	}
+}
+
+func (rr *RecordReader) nextCSV(cr *csv.Reader) (Pair, error) {
+	for {
+		fields, err := cr.Read()
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rr.record++
+			return Pair{}, &RecordError{Record: rr.record, Err: err}
+		}
+		if err != nil {
+			return Pair{}, err
+		}
+		if rr.record == 0 && len(fields) == 2 && fields[0] == "key" && fields[1] == "value" {
+			line, _ := cr.FieldPos(0)
+			if line == 1 {
+				continue // header row
+			}
+		}
+		rr.record++
+		if len(fields) != 2 {
+			return Pair{}, &RecordError{Record: rr.record, Err: fmt.Errorf("record has %d fields, want 2", len(fields))}
+		}
+		return Pair{Key: fields[0], Value: fields[1]}, nil
+	}
+}
+
+// RecordWriter writes key/value records in a RecordFormat.
+type RecordWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func NewRecordWriter(w io.Writer, format RecordFormat) (*RecordWriter, error) {
+	rw := &RecordWriter{}
+	switch format {
+	case FormatNDJSON:
+		rw.json = json.NewEncoder(w)
+		rw.json.SetEscapeHTML(false)
+	case FormatCSV:
+		rw.csv = csv.NewWriter(w)
+	default:
+		return nil, fmt.Errorf("unknown record format %d", format)
+	}
+	return rw, nil
+}
+
+func (rw *RecordWriter) Write(p Pair) error {
+	if rw.csv != nil {
+		return rw.csv.Write([]string{p.Key, p.Value})
+	}
+	return rw.json.Encode(struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{p.Key, p.Value})
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (rw *RecordWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		return rw.csv.Error()
+	}
+	return nil
+}
+
+// PutBatch proposes the pairs as a single raft entry. Unlike Put it does not
+// hold the lock while proposing, so a long import does not stall reads. It
+// fails with ErrNoSpace while a NOSPACE alarm is active.
+func (s *Kvstore) PutBatch(pairs []Pair) error {
+	s.mu.RLock()
+	noSpace, err := s.hasAlarm(AlarmNoSpace)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if noSpace {
+		return ErrNoSpace
+	}
+	s.propose(kv{Op: opPutBatch, Pairs: pairs})
+	return nil
+}
+
+// Export calls fn for every pair whose key starts with prefix, in key
+// order, as of a single applied index, which it passes to start first.
+// Reserved keys are left out. Engines that can hold a view are read from one
+// while writes go on; with the others, writes wait until the export is done.
+func (s *Kvstore) Export(prefix string, start func(index uint64) error, fn func(Pair) error) error {
+	s.mu.RLock()
+	index := s.appliedIndex
+	var source interface {
+		Range(start, end string, fn func(key, value string) bool) error
+	} = s.storage
+	view, err := s.openView()
+	if err != nil {
+		s.mu.RUnlock()
+		return err
+	}
+	if view != nil {
+		s.mu.RUnlock()
+		defer view.Close()
+		source = view
+	} else {
+		defer s.mu.RUnlock()
+	}
+
+	if err := start(index); err != nil {
+		return err
+	}
+	var fnErr error
+	err = source.Range(prefix, repository.PrefixEnd(prefix), func(key, value string) bool {
+		if repository.IsReservedKey(key) {
+			return true
+		}
+		fnErr = fn(Pair{Key: key, Value: value})
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// openView opens a view of storage, or returns nil if the engine cannot
+// hold one. The caller must hold s.mu.
+func (s *Kvstore) openView() (repository.View, error) {
+	viewer, ok := s.storage.(repository.Viewer)
+	if !ok {
+		return nil, nil
+	}
+	view, err := viewer.View()
+	if errors.Is(err, repository.ErrViewUnsupported) {
+		return nil, nil
+	}
+	return view, err
+}
+
+// applyPutBatch applies a committed batch to storage, the cache and the
+// state hash. The caller must hold s.mu.
+func (s *Kvstore) applyPutBatch(pairs []Pair, index uint64) {
+	// Read the old values first; a key repeated in the batch replaces the
+	// value written earlier in the same batch.
+	type value struct {
+		value string
+		found bool
+	}
+	current := make(map[string]value, len(pairs))
+	for _, p := range pairs {
+		if _, ok := current[p.Key]; ok {
+			continue
+		}
+		old, found, err := s.storage.Get(p.Key)
+		if err != nil {
+			log.Fatalf("Error reading key: %s: %v\n", p.Key, err)
+		}
+		current[p.Key] = value{old, found}
+	}
+
+	if err := NewPutService(s.memoryRepo, s.storage).PutBatch(pairs, index); err != nil {
+		log.Fatalf("Error putting batch of %d keys: %v\n", len(pairs), err)
+	}
+	for _, p := range pairs {
+		old := current[p.Key]
+		s.hash.update(p.Key, old.value, old.found, p.Value, true)
+		current[p.Key] = value{p.Value, true}
+	}
+}
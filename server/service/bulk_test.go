@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"cs739-kv-store/repository"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAll returns the pairs read and the record numbers that failed to parse.
+func readAll(t *testing.T, input string, format RecordFormat) ([]Pair, []int64) {
+	t.Helper()
+	rr, err := NewRecordReader(strings.NewReader(input), format)
+	if err != nil {
+		t.Fatalf("NewRecordReader: %v", err)
+	}
+	var pairs []Pair
+	var failed []int64
+	for {
+		p, err := rr.Next()
+		if err == io.EOF {
+			return pairs, failed
+		}
+		var recordErr *RecordError
+		if errors.As(err, &recordErr) {
+			failed = append(failed, recordErr.Record)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Next: %v", err)
+		}
+		pairs = append(pairs, p)
+	}
+}
+
+func TestRecordReaderNDJSON(t *testing.T) {
+	input := `{"key": "a", "value": "1"}
+
+{"key": "b"}
+not json
+{"key": "c", "value": "3", "extra": true}
+{"key": "d", "value": ""}`
+	pairs, failed := readAll(t, input, FormatNDJSON)
+	want := []Pair{{"a", "1"}, {"c", "3"}, {"d", ""}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("pairs = %v, want %v", pairs, want)
+	}
+	if !reflect.DeepEqual(failed, []int64{2, 3}) {
+		t.Fatalf("failed records = %v, want [2 3]", failed)
+	}
+}
+
+func TestRecordReaderCSV(t *testing.T) {
+	input := "key,value\na,1\nb\n\"c,d\",\"x\ny\"\ne,5,extra\n"
+	pairs, failed := readAll(t, input, FormatCSV)
+	want := []Pair{{"a", "1"}, {"c,d", "x\ny"}}
+	if !reflect.DeepEqual(pairs, want) {
+		t.Fatalf("pairs = %v, want %v", pairs, want)
+	}
+	if !reflect.DeepEqual(failed, []int64{2, 4}) {
+		t.Fatalf("failed records = %v, want [2 4]", failed)
+	}
+
+	// A key,value row that is not the first row is data.
+	pairs, _ = readAll(t, "a,1\nkey,value\n", FormatCSV)
+	if len(pairs) != 2 {
+		t.Fatalf("pairs = %v, want 2 records", pairs)
+	}
+}
+
+func TestRecordWriterRoundTrip(t *testing.T) {
+	pairs := []Pair{{"a", "1"}, {"b,\"c\"", "multi\nline"}, {"<html>", ""}}
+	for _, format := range []RecordFormat{FormatNDJSON, FormatCSV} {
+		var buf bytes.Buffer
+		w, err := NewRecordWriter(&buf, format)
+		if err != nil {
+			t.Fatalf("NewRecordWriter: %v", err)
+		}
+		for _, p := range pairs {
+			if err := w.Write(p); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("Flush: %v", err)
+		}
+		got, failed := readAll(t, buf.String(), format)
+		if !reflect.DeepEqual(got, pairs) || len(failed) != 0 {
+			t.Fatalf("format %d: read back %v (failed %v), want %v", format, got, failed, pairs)
+		}
+	}
+}
+
+func TestApplyPutBatch(t *testing.T) {
+	memoryRepo, err := repository.NewMemoryRepo(repository.CacheConfig{MaxBytes: 1 << 20, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memoryRepo.Close()
+	storage := repository.NewMapRepo()
+	s := &Kvstore{memoryRepo: memoryRepo, storage: storage}
+	s.hash.reset(storage, 0)
+
+	s.apply(kv{Key: "a", Val: "old", Op: opPut}, 1)
+	s.apply(kv{Op: opPutBatch, Pairs: []Pair{{"a", "1"}, {"b", "2"}, {"a", "3"}}}, 2)
+
+	if value, _, _ := storage.Get("a"); value != "3" {
+		t.Fatalf("a = %q, want the last value in the batch", value)
+	}
+	if index, _ := repository.ReadAppliedIndex(storage); index != 2 {
+		t.Fatalf("applied index = %d, want 2", index)
+	}
+	var full stateHash
+	full.reset(storage, 2)
+	if s.hash.sum != full.sum {
+		t.Fatalf("incremental hash %x, full hash %x", s.hash.sum, full.sum)
+	}
+
+	pairs, index := exportAll(t, s, "")
+	if want := []Pair{{"a", "3"}, {"b", "2"}}; !reflect.DeepEqual(pairs, want) || index != 2 {
+		t.Fatalf("Export = %v at %d, want %v at 2", pairs, index, want)
+	}
+}
+
+// exportAll collects what Export passes on.
+func exportAll(t *testing.T, s *Kvstore, prefix string) ([]Pair, uint64) {
+	t.Helper()
+	var pairs []Pair
+	var index uint64
+	err := s.Export(prefix, func(at uint64) error {
+		index = at
+		return nil
+	}, func(p Pair) error {
+		pairs = append(pairs, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	return pairs, index
+}
+
+func TestExportReadsAViewWhileWritesContinue(t *testing.T) {
+	engine, err := repository.OpenBoltRepo(filepath.Join(t.TempDir(), "kv.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	memoryRepo, err := repository.NewMemoryRepo(repository.CacheConfig{MaxBytes: 1 << 20, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memoryRepo.Close()
+	storage := repository.NewCodecRepo(engine, repository.NewFlateCodec(1))
+	s := &Kvstore{memoryRepo: memoryRepo, storage: storage}
+	s.hash.reset(storage, 0)
+	s.apply(kv{Op: opPutBatch, Pairs: []Pair{{"k1", "1"}, {"k2", "2"}, {"k3", "3"}}}, 1)
+
+	var pairs []Pair
+	var index uint64
+	err = s.Export("k", func(at uint64) error {
+		index = at
+		return nil
+	}, func(p Pair) error {
+		if len(pairs) == 0 {
+			// Writes are applied while the export runs, without showing in it.
+			s.mu.Lock()
+			s.apply(kv{Key: "k2", Val: "changed", Op: opPut}, 2)
+			s.apply(kv{Key: "k4", Val: "4", Op: opPut}, 3)
+			s.mu.Unlock()
+		}
+		pairs = append(pairs, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if want := []Pair{{"k1", "1"}, {"k2", "2"}, {"k3", "3"}}; !reflect.DeepEqual(pairs, want) || index != 1 {
+		t.Fatalf("Export = %v at %d, want %v at 1", pairs, index, want)
+	}
+	if pairs, index := exportAll(t, s, "k"); len(pairs) != 4 || index != 3 {
+		t.Fatalf("second Export = %v at %d, want 4 pairs at 3", pairs, index)
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"cs739-kv-store/repository"
+	"log"
+	"math/rand/v2"
+)
+
+// CASResult is the outcome of a compare-and-swap, as applied.
+type CASResult struct {
+	Swapped bool
+	Value   string // the value after the operation
+	Found   bool   // whether the key exists after the operation
+}
+
+// CompareAndSwap sets key to value if its value is expected, or if it is
+// missing and expectMissing is set. Unlike Put, it waits until the command
+// is applied, since only then is the outcome known. It fails with ErrNoSpace
+// while a NOSPACE alarm is active, and with ctx's error if the command is not
+// applied in time, which includes proposals lost to a leader change.
+func (s *Kvstore) CompareAndSwap(ctx context.Context, key, expected string, expectMissing bool, value string) (CASResult, error) {
+	s.mu.Lock()
+	if noSpace, err := s.hasAlarm(AlarmNoSpace); err != nil || noSpace {
+		s.mu.Unlock()
+		if err == nil {
+			err = ErrNoSpace
+		}
+		return CASResult{}, err
+	}
+	id := rand.Uint64()
+	done := make(chan CASResult, 1)
+	if s.waiters == nil {
+		s.waiters = make(map[uint64]chan CASResult)
+	}
+	s.waiters[id] = done
+	s.propose(kv{Key: key, Val: value, Op: opCompareAndSwap, Expected: expected, ExpectMissing: expectMissing, Proposal: id})
+	s.mu.Unlock()
+
+	select {
+	case result := <-done:
+		return result, nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		delete(s.waiters, id)
+		s.mu.Unlock()
+		return CASResult{}, ctx.Err()
+	}
+}
+
+// applyCompareAndSwap applies a committed compare-and-swap and hands the
+// outcome to the proposer, if it is waiting on this node. The caller must
+// hold s.mu.
+func (s *Kvstore) applyCompareAndSwap(cmd kv, old string, oldFound bool, index uint64) {
+	result := CASResult{Value: old, Found: oldFound}
+	if (oldFound && old == cmd.Expected) || (!oldFound && cmd.ExpectMissing) {
+		if err := NewPutService(s.memoryRepo, s.storage).Put(cmd.Key, cmd.Val, index); err != nil {
+			log.Fatalf("Error putting key: %s with value: %s in memory: %v\n", cmd.Key, cmd.Val, err)
+		}
+		s.hash.update(cmd.Key, old, oldFound, cmd.Val, true)
+		result = CASResult{Swapped: true, Value: cmd.Val, Found: true}
+	} else if err := s.storage.Batch([]repository.Op{repository.AppliedIndexOp(index)}); err != nil {
+		log.Fatalf("Error recording applied index %d: %v\n", index, err)
+	}
+
+	if done, ok := s.waiters[cmd.Proposal]; ok {
+		delete(s.waiters, cmd.Proposal)
+		done <- result
+	}
+}
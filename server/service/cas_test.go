@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"cs739-kv-store/repository"
+	"testing"
+	"time"
+)
+
+// newCommittingStore returns a store whose proposals are applied as soon as
+// they are made, as if raft committed them at once.
+func newCommittingStore(t *testing.T) *Kvstore {
+	memoryRepo, err := repository.NewMemoryRepo(repository.CacheConfig{TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(memoryRepo.Close)
+	proposeC := make(chan string)
+	s := &Kvstore{proposeC: proposeC, memoryRepo: memoryRepo, storage: repository.NewMapRepo(), membersChanged: make(chan struct{})}
+	s.hash.reset(s.storage, 0)
+
+	go func() {
+		var index uint64
+		for data := range proposeC {
+			cmd, err := decodeCommand(data, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			index++
+			go func(index uint64) {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				s.apply(cmd, index)
+			}(index)
+		}
+	}()
+	t.Cleanup(func() { close(proposeC) })
+	return s
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	s := newCommittingStore(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result, err := s.CompareAndSwap(ctx, "counter", "", true, "1")
+	if err != nil || !result.Swapped || result.Value != "1" {
+		t.Fatalf("swap of a missing key = %+v, %v; want swapped to 1", result, err)
+	}
+	result, err = s.CompareAndSwap(ctx, "counter", "", true, "9")
+	if err != nil || result.Swapped || result.Value != "1" || !result.Found {
+		t.Fatalf("swap expecting a missing key = %+v, %v; want the current value 1", result, err)
+	}
+	result, err = s.CompareAndSwap(ctx, "counter", "1", false, "2")
+	if err != nil || !result.Swapped {
+		t.Fatalf("swap from the current value = %+v, %v; want swapped", result, err)
+	}
+	if value, _, _ := s.Get("counter"); value != "2" {
+		t.Fatalf("counter = %q, want 2", value)
+	}
+	if s.appliedIndex != 3 || len(s.waiters) != 0 {
+		t.Fatalf("applied index %d with %d waiters, want 3 and none", s.appliedIndex, len(s.waiters))
+	}
+}
+
+func TestCompareAndSwapGivesUpWithContext(t *testing.T) {
+	// Nothing commits the proposal.
+	proposeC := make(chan string, 1)
+	s := &Kvstore{proposeC: proposeC, storage: repository.NewMapRepo()}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.CompareAndSwap(ctx, "k", "", true, "v"); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want the context's deadline", err)
+	}
+	if len(s.waiters) != 0 {
+		t.Fatalf("waiter left behind")
+	}
+}
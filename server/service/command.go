@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"cs739-kv-store/repository"
+	"encoding/gob"
+	"fmt"
+)
+
+type commandOp int
+
+const (
+	opPut            commandOp = iota
+	opDelete                   // removes Key and invalidates its cache entry
+	opRaiseAlarm               // Key is the alarm type, Val the detail
+	opClearAlarm               // Key is the alarm type
+	opPutBatch                 // Pairs are written in order
+	opCompareAndSwap           // see the compare-and-swap fields of kv
+)
+
+// kv is the command carried by a normal raft entry.
+type kv struct {
+	Key string
+	Val string
+	Op  commandOp
+
+	Member uint64 // member an alarm is raised for
+	Pairs  []Pair // pairs of a batch
+
+	// A compare-and-swap sets Key to Val if its value is Expected, or if it
+	// is missing and ExpectMissing is set. Proposal identifies the waiting
+	// proposer.
+	Expected      string
+	ExpectMissing bool
+	Proposal      uint64
+}
+
+// encodeCommand gob-encodes cmd and, if codec is set, passes it through codec.
+func encodeCommand(cmd kv, codec repository.ValueCodec) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(cmd); err != nil {
+		return "", err
+	}
+	if codec == nil {
+		return buf.String(), nil
+	}
+	data, err := codec.Encode(buf.Bytes())
+	return string(data), err
+}
+
+// decodeCommand reverses encodeCommand. Entries proposed before the codec
+// was configured decode too.
+func decodeCommand(data string, codec repository.ValueCodec) (kv, error) {
+	var cmd kv
+	raw := []byte(data)
+	if codec != nil {
+		var err error
+		if raw, err = codec.Decode(raw); err != nil {
+			return cmd, err
+		}
+	}
+	err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&cmd)
+	return cmd, err
+}
+
+// DescribeCommand decodes the data of a normal raft entry into a one-line
+// description, for tools that inspect the log offline.
+func DescribeCommand(data []byte, codec repository.ValueCodec) (string, error) {
+	cmd, err := decodeCommand(string(data), codec)
+	if err != nil {
+		return "", err
+	}
+	switch cmd.Op {
+	case opPut:
+		return fmt.Sprintf("put %q = %q", cmd.Key, cmd.Val), nil
+	case opDelete:
+		return fmt.Sprintf("delete %q", cmd.Key), nil
+	case opRaiseAlarm:
+		return fmt.Sprintf("raise alarm %s for member %d: %s", cmd.Key, cmd.Member, cmd.Val), nil
+	case opClearAlarm:
+		return fmt.Sprintf("clear alarm %s for member %d", cmd.Key, cmd.Member), nil
+	case opPutBatch:
+		if len(cmd.Pairs) == 0 {
+			return "put batch of 0 keys", nil
+		}
+		return fmt.Sprintf("put batch of %d keys, %q to %q", len(cmd.Pairs), cmd.Pairs[0].Key, cmd.Pairs[len(cmd.Pairs)-1].Key), nil
+	case opCompareAndSwap:
+		if cmd.ExpectMissing {
+			return fmt.Sprintf("compare-and-swap %q from missing or %q to %q", cmd.Key, cmd.Expected, cmd.Val), nil
+		}
+		return fmt.Sprintf("compare-and-swap %q from %q to %q", cmd.Key, cmd.Expected, cmd.Val), nil
+	default:
+		return fmt.Sprintf("unknown op %d on %q", cmd.Op, cmd.Key), nil
+	}
+}
@@ -8,62 +8,65 @@ import (
 
 var (
 	ErrMemoryRepoNotInitialized = errors.New("memory repository is not initialized")
-	ErrRDSRepoNotInitialized    = errors.New("RDS repository is not initialized")
+	ErrStorageNotInitialized    = errors.New("storage engine is not initialized")
 )
 
 type GetService struct {
 	memoryRepo *repository.MemoryRepo
-	rdsRepo    *repository.RDSRepo
+	storage    repository.StorageEngine
 }
 
-func NewGetService(memoryRepo *repository.MemoryRepo, rdsRepo *repository.RDSRepo) *GetService {
+func NewGetService(memoryRepo *repository.MemoryRepo, storage repository.StorageEngine) *GetService {
 	return &GetService{
 		memoryRepo: memoryRepo,
-		rdsRepo:    rdsRepo,
+		storage:    storage,
 	}
 }
 
-func (s *GetService) GetByKey(key string) (string, bool, error) {
+// GetByKey looks up key, filling the cache on a miss. index is the raft
+// index the storage engine currently reflects.
+func (s *GetService) GetByKey(key string, index uint64) (string, bool, error) {
 	if s.memoryRepo == nil {
 		return "", false, ErrMemoryRepoNotInitialized
 	}
 
-	value, found, err := s.memoryRepo.Get(key)
-	if err != nil {
-		return "", false, err
-	}
-
-	if found {
+	value, result := s.memoryRepo.Get(key)
+	switch result {
+	case repository.CacheHit:
 		// Key found in memoryRepo
 		return value, true, nil
+	case repository.CacheNegativeHit:
+		// Key known to be missing
+		return "", false, nil
 	}
 
-	// Key not found in memoryRepo, fetch from rdsRepo
-	log.Printf("Key: %s not found in memoryRepo, fetching from rdsRepo\n", key)
-	value, found, err = s.GetByKeyFromRDS(key)
+	// Key not found in memoryRepo, fetch from storage
+	log.Printf("Key: %s not found in memoryRepo, fetching from storage\n", key)
+	value, found, err := s.GetByKeyFromStorage(key)
 	if err != nil {
 		return "", false, err
 	}
 
 	if !found {
-		// Key does not exist in rdsRepo
+		// Key does not exist in storage
+		s.memoryRepo.PutNegative(key, index)
 		return "", false, nil
 	}
 
-	// Update memoryRepo with the value from rdsRepo
-	if err = s.memoryRepo.Put(key, value); err != nil {
-		log.Printf("Error putting key: %s with value: %s in memory: %v\n", key, value, err)
+	// Update memoryRepo with the value from storage
+	if !s.memoryRepo.Put(key, value, index) {
+		log.Printf("Skipped caching stale value for key: %s at index %d\n", key, index)
 	}
 
 	return value, true, nil
 }
 
-func (s *GetService) GetByKeyFromRDS(key string) (string, bool, error) {
-	if s.rdsRepo == nil {
-		return "", false, ErrRDSRepoNotInitialized
+func (s *GetService) GetByKeyFromStorage(key string) (string, bool, error) {
+	if s.storage == nil {
+		return "", false, ErrStorageNotInitialized
 	}
 
-	value, found, err := s.rdsRepo.Get(key)
+	value, found, err := s.storage.Get(key)
 	if err != nil {
 		return "", false, err
 	}
@@ -1,43 +1,62 @@
 package service
 
 import (
-	"bytes"
-	"cs739-kv-store/consts"
+	"context"
 	"cs739-kv-store/raft"
 	"cs739-kv-store/repository"
-	"database/sql"
-	"encoding/gob"
 	"errors"
 	"log"
-	"strings"
 	"sync"
+	"time"
 
 	"go.etcd.io/etcd/raft/v3/raftpb"
 	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
 )
 
+var ErrNoSpace = errors.New("storage quota exceeded, writes are rejected until the NOSPACE alarm is cleared")
+
 // a key-value store backed by raft
 type Kvstore struct {
 	proposeC chan<- string // channel for proposing updates
 	mu       sync.RWMutex
 	//kvStore     map[string]string // current committed key-value pairs
 	memoryRepo  *repository.MemoryRepo
-	rdsRepo     *repository.RDSRepo
+	storage     repository.StorageEngine
 	snapshotter *snap.Snapshotter
+
+	proposalCodec  repository.ValueCodec
+	appliedIndex   uint64 // raft index of the last entry applied to storage
+	hash           stateHash
+	membersChanged chan struct{}             // closed and replaced when the member registry changes
+	waiters        map[uint64]chan CASResult // compare-and-swaps proposed here, by proposal ID
 }
 
-type kv struct {
-	Key string
-	Val string
+// Options configures a Kvstore.
+type Options struct {
+	Cache repository.CacheConfig
+	// ProposalCodec, if set, encodes proposals before they reach the raft log.
+	ProposalCodec repository.ValueCodec
 }
 
-func NewKVStore(snapshotter *snap.Snapshotter, proposeC chan<- string, commitC <-chan *raft.Commit, errorC <-chan error, db *sql.DB) *Kvstore {
+func NewKVStore(snapshotter *snap.Snapshotter, proposeC chan<- string, commitC <-chan *raft.Commit, errorC <-chan error, storage repository.StorageEngine, opts Options) *Kvstore {
+	memoryRepo, err := repository.NewMemoryRepo(opts.Cache)
+	if err != nil {
+		log.Fatalf("Invalid cache configuration: %v", err)
+	}
 	s := &Kvstore{
 		proposeC: proposeC,
 		//kvStore:     make(map[string]string),
-		memoryRepo:  repository.NewMemoryRepo(consts.KVStoreCapacity, consts.KVStoreEvictionTTL),
-		rdsRepo:     repository.NewRDSRepo(db),
-		snapshotter: snapshotter,
+		memoryRepo:     memoryRepo,
+		storage:        storage,
+		snapshotter:    snapshotter,
+		proposalCodec:  opts.ProposalCodec,
+		membersChanged: make(chan struct{}),
+	}
+	if s.appliedIndex, err = repository.ReadAppliedIndex(storage); err != nil {
+		log.Panic(err)
+	}
+	if err := s.hash.reset(storage, s.appliedIndex); err != nil {
+		log.Panic(err)
 	}
 	snapshot, err := s.loadSnapshot()
 	if err != nil {
@@ -45,7 +64,7 @@ func NewKVStore(snapshotter *snap.Snapshotter, proposeC chan<- string, commitC <
 	}
 	if snapshot != nil {
 		log.Printf("loading snapshot at term %d and index %d", snapshot.Metadata.Term, snapshot.Metadata.Index)
-		if err := s.recoverFromSnapshot(snapshot.Data); err != nil {
+		if err := s.recoverFromSnapshot(snapshot); err != nil {
 			log.Panic(err)
 		}
 	}
@@ -57,23 +76,49 @@ func NewKVStore(snapshotter *snap.Snapshotter, proposeC chan<- string, commitC <
 func (s *Kvstore) Get(key string) (string, bool, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return NewGetService(s.memoryRepo, s.rdsRepo).GetByKey(key)
+	return NewGetService(s.memoryRepo, s.storage).GetByKey(key, s.appliedIndex)
 }
 
+// Put proposes a write and returns the current value. It fails with
+// ErrNoSpace while a NOSPACE alarm is active.
 func (s *Kvstore) Put(k string, v string) (string, bool, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	oldValue, found, err := NewGetService(s.memoryRepo, s.rdsRepo).GetByKey(k)
+	if noSpace, err := s.hasAlarm(AlarmNoSpace); err != nil || noSpace {
+		if err == nil {
+			err = ErrNoSpace
+		}
+		return "", false, err
+	}
+	oldValue, found, err := NewGetService(s.memoryRepo, s.storage).GetByKey(k, s.appliedIndex)
 	s.Propose(k, v)
 	return oldValue, found, err
 }
 
+// Delete proposes removing a key and returns its current value. Deletes go
+// through raft like puts, so every replica drops the key, and its cache
+// entry, at the same index.
+func (s *Kvstore) Delete(k string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	oldValue, found, err := NewGetService(s.memoryRepo, s.storage).GetByKey(k, s.appliedIndex)
+	if err != nil || !found {
+		return oldValue, found, err
+	}
+	s.propose(kv{Key: k, Op: opDelete})
+	return oldValue, found, nil
+}
+
 func (s *Kvstore) Propose(k string, v string) {
-	var buf strings.Builder
-	if err := gob.NewEncoder(&buf).Encode(kv{k, v}); err != nil {
+	s.propose(kv{Key: k, Val: v, Op: opPut})
+}
+
+func (s *Kvstore) propose(cmd kv) {
+	data, err := encodeCommand(cmd, s.proposalCodec)
+	if err != nil {
 		log.Fatal(err)
 	}
-	s.proposeC <- buf.String()
+	s.proposeC <- data
 }
 
 func (s *Kvstore) readCommits(commitC <-chan *raft.Commit, errorC <-chan error) {
@@ -86,23 +131,26 @@ func (s *Kvstore) readCommits(commitC <-chan *raft.Commit, errorC <-chan error)
 			}
 			if snapshot != nil {
 				log.Printf("loading snapshot at term %d and index %d", snapshot.Metadata.Term, snapshot.Metadata.Index)
-				if err := s.recoverFromSnapshot(snapshot.Data); err != nil {
+				if err := s.recoverFromSnapshot(snapshot); err != nil {
 					log.Panic(err)
 				}
 			}
 			continue
 		}
 
-		for _, data := range commit.Data {
-			var dataKv kv
-			dec := gob.NewDecoder(bytes.NewBufferString(data))
-			if err := dec.Decode(&dataKv); err != nil {
+		for i, data := range commit.Data {
+			if commit.ConfChanges != nil && commit.ConfChanges[i] != nil {
+				s.mu.Lock()
+				s.applyConfChange(*commit.ConfChanges[i], commit.Indexes[i])
+				s.mu.Unlock()
+				continue
+			}
+			dataKv, err := decodeCommand(data, s.proposalCodec)
+			if err != nil {
 				log.Fatalf("raftexample: could not decode message (%v)", err)
 			}
 			s.mu.Lock()
-			if err := NewPutService(s.memoryRepo, s.rdsRepo).Put(dataKv.Key, dataKv.Val); err != nil {
-				log.Fatalf("Error putting key: %s with value: %s in memory: %v\n", dataKv.Key, dataKv.Val, err)
-			}
+			s.apply(dataKv, commit.Indexes[i])
 			s.mu.Unlock()
 		}
 		close(commit.ApplyDoneC)
@@ -112,10 +160,133 @@ func (s *Kvstore) readCommits(commitC <-chan *raft.Commit, errorC <-chan error)
 	}
 }
 
+// apply applies a committed command to storage, the cache and the state
+// hash. Entries at or below appliedIndex are already in storage, so WAL
+// entries replayed after a restart are skipped. The caller must hold s.mu.
+func (s *Kvstore) apply(cmd kv, index uint64) {
+	if index <= s.appliedIndex {
+		return
+	}
+
+	key := cmd.Key
+	if cmd.Op == opRaiseAlarm || cmd.Op == opClearAlarm {
+		key = alarmKey(cmd.Key, cmd.Member)
+	}
+	var old string
+	var oldFound bool
+	if cmd.Op != opPutBatch {
+		var err error
+		if old, oldFound, err = s.storage.Get(key); err != nil {
+			log.Fatalf("Error reading key: %s: %v\n", key, err)
+		}
+	}
+
+	putService := NewPutService(s.memoryRepo, s.storage)
+	switch cmd.Op {
+	case opPut:
+		if err := putService.Put(cmd.Key, cmd.Val, index); err != nil {
+			log.Fatalf("Error putting key: %s with value: %s in memory: %v\n", cmd.Key, cmd.Val, err)
+		}
+		s.hash.update(key, old, oldFound, cmd.Val, true)
+	case opDelete:
+		if err := putService.Delete(cmd.Key, index); err != nil {
+			log.Fatalf("Error deleting key: %s: %v\n", cmd.Key, err)
+		}
+		s.hash.update(key, old, oldFound, "", false)
+	case opRaiseAlarm:
+		err := s.storage.Batch([]repository.Op{
+			{Type: repository.OpPut, Key: key, Value: cmd.Val},
+			repository.AppliedIndexOp(index),
+		})
+		if err != nil {
+			log.Fatalf("Error raising alarm %s for member %d: %v\n", cmd.Key, cmd.Member, err)
+		}
+		log.Printf("Alarm %s raised for member %d: %s\n", cmd.Key, cmd.Member, cmd.Val)
+		s.hash.update(key, old, oldFound, cmd.Val, true)
+	case opClearAlarm:
+		err := s.storage.Batch([]repository.Op{
+			{Type: repository.OpDelete, Key: key},
+			repository.AppliedIndexOp(index),
+		})
+		if err != nil {
+			log.Fatalf("Error clearing alarm %s for member %d: %v\n", cmd.Key, cmd.Member, err)
+		}
+		log.Printf("Alarm %s cleared for member %d\n", cmd.Key, cmd.Member)
+		s.hash.update(key, old, oldFound, "", false)
+	case opPutBatch:
+		s.applyPutBatch(cmd.Pairs, index)
+	case opCompareAndSwap:
+		s.applyCompareAndSwap(cmd, old, oldFound, index)
+	}
+	s.appliedIndex = index
+	s.hash.record(index)
+}
+
+// AppliedIndex returns the raft index of the last entry applied to storage.
+func (s *Kvstore) AppliedIndex() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.appliedIndex
+}
+
+// StateHash returns the applied index and the state hash as of that index.
+func (s *Kvstore) StateHash() (uint64, uint64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.appliedIndex, s.hash.sum
+}
+
+// HashAt returns the state hash as of the given raft index, waiting until
+// the entry is applied or ctx is done.
+func (s *Kvstore) HashAt(ctx context.Context, index uint64) (uint64, error) {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.RLock()
+		if s.appliedIndex >= index {
+			hash, err := s.hash.at(index)
+			s.mu.RUnlock()
+			return hash, err
+		}
+		s.mu.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// StorageSize returns the size of the storage engine's data.
+func (s *Kvstore) StorageSize() (int64, error) {
+	return s.storage.Size()
+}
+
+// Vacuum reclaims free space in the storage engine. Reads keep being
+// served; applying new entries waits until it is done.
+func (s *Kvstore) Vacuum(incremental bool) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return repository.Vacuum(s.storage, incremental)
+}
+
+func (s *Kvstore) CacheStats() repository.CacheStats {
+	return s.memoryRepo.Stats()
+}
+
 func (s *Kvstore) GetSnapshot() ([]byte, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.rdsRepo.Serialize()
+	return s.storage.Snapshot()
+}
+
+// Backup returns a snapshot payload and the raft index it reflects.
+func (s *Kvstore) Backup() ([]byte, uint64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	data, err := s.storage.Snapshot()
+	return data, s.appliedIndex, err
 }
 
 func (s *Kvstore) loadSnapshot() (*raftpb.Snapshot, error) {
@@ -129,18 +300,34 @@ func (s *Kvstore) loadSnapshot() (*raftpb.Snapshot, error) {
 	return snapshot, nil
 }
 
-func (s *Kvstore) recoverFromSnapshot(snapshot []byte) error {
-	return s.rdsRepo.Deserialize(snapshot)
+// recoverFromSnapshot replaces the storage with snapshot, unless the
+// storage already reflects a later index.
+func (s *Kvstore) recoverFromSnapshot(snapshot *raftpb.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := snapshot.Metadata.Index
+	if index <= s.appliedIndex {
+		log.Printf("storage is at index %d, skipping snapshot at index %d", s.appliedIndex, index)
+		return nil
+	}
+	if err := s.storage.Restore(snapshot.Data); err != nil {
+		return err
+	}
+	if err := s.storage.Batch([]repository.Op{repository.AppliedIndexOp(index)}); err != nil {
+		return err
+	}
+	s.memoryRepo.Purge(index)
+	s.appliedIndex = index
+	s.notifyMembers()
+	return s.hash.reset(s.storage, index)
 }
 
 func (s *Kvstore) Flush() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	for key, elem := range s.memoryRepo.GetCache() {
-		entry := elem.Value.(*repository.CacheEntry)
-		value := entry.Value
-		err := s.rdsRepo.Put(key, value)
+	for _, entry := range s.memoryRepo.Entries() {
+		err := s.storage.Put(entry.Key, entry.Value)
 		if err != nil {
 			return err
 		}
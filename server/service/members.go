@@ -0,0 +1,115 @@
+package service
+
+import (
+	"cs739-kv-store/models"
+	"cs739-kv-store/repository"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+// memberPrefix holds the member registry as memberPrefix + member ID, with
+// the member as JSON. It changes only through conf changes, so every replica
+// stores the same registry.
+const memberPrefix = repository.ReservedPrefix + "member/"
+
+func memberKey(id uint64) string {
+	return memberPrefix + strconv.FormatUint(id, 10)
+}
+
+// IsMemberKey reports whether key belongs to the member registry.
+func IsMemberKey(key string) bool {
+	return strings.HasPrefix(key, memberPrefix)
+}
+
+// applyConfChange records a committed conf change in the member registry.
+// Adds whose context names no address leave the registry as it is. The
+// caller must hold s.mu.
+func (s *Kvstore) applyConfChange(cc raftpb.ConfChange, index uint64) {
+	if index <= s.appliedIndex {
+		return
+	}
+
+	key := memberKey(cc.NodeID)
+	old, oldFound, err := s.storage.Get(key)
+	if err != nil {
+		log.Fatalf("Error reading key: %s: %v\n", key, err)
+	}
+	ops := []repository.Op{repository.AppliedIndexOp(index)}
+	switch cc.Type {
+	case raftpb.ConfChangeAddNode, raftpb.ConfChangeAddLearnerNode:
+		member := models.ParseMemberContext(cc.NodeID, cc.Context)
+		member.Learner = cc.Type == raftpb.ConfChangeAddLearnerNode
+		if member.KVAddress != "" {
+			value := string(member.Context())
+			ops = append(ops, repository.Op{Type: repository.OpPut, Key: key, Value: value})
+			s.hash.update(key, old, oldFound, value, true)
+			log.Printf("Member %d registered at %s, raft %s, learner %v\n", member.ID, member.KVAddress, member.RaftAddress, member.Learner)
+		}
+	case raftpb.ConfChangeRemoveNode:
+		if oldFound {
+			ops = append(ops, repository.Op{Type: repository.OpDelete, Key: key})
+			s.hash.update(key, old, oldFound, "", false)
+			log.Printf("Member %d unregistered\n", cc.NodeID)
+		}
+	}
+	if err := s.storage.Batch(ops); err != nil {
+		log.Fatalf("Error applying conf change for member %d: %v\n", cc.NodeID, err)
+	}
+	s.appliedIndex = index
+	s.hash.record(index)
+	s.notifyMembers()
+}
+
+// notifyMembers wakes the watchers of the registry. The caller must hold s.mu.
+func (s *Kvstore) notifyMembers() {
+	close(s.membersChanged)
+	s.membersChanged = make(chan struct{})
+}
+
+// Members returns the member registry in ID order, the applied index it
+// reflects, and a channel closed at the next change to it.
+func (s *Kvstore) Members() ([]models.Member, uint64, <-chan struct{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	members, err := ReadMembers(s.storage)
+	return members, s.appliedIndex, s.membersChanged, err
+}
+
+// Member returns the registered member with the given ID.
+func (s *Kvstore) Member(id uint64) (models.Member, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var m models.Member
+	value, found, err := s.storage.Get(memberKey(id))
+	if err != nil || !found {
+		return m, false, err
+	}
+	return m, true, json.Unmarshal([]byte(value), &m)
+}
+
+// ReadMembers reads the member registry from storage, in ID order. It
+// lets a node find its peers before raft starts.
+func ReadMembers(storage repository.StorageEngine) ([]models.Member, error) {
+	var members []models.Member
+	var parseErr error
+	err := storage.Range(memberPrefix, repository.PrefixEnd(memberPrefix), func(key, value string) bool {
+		var m models.Member
+		if err := json.Unmarshal([]byte(value), &m); err != nil {
+			parseErr = fmt.Errorf("invalid member %q: %w", key, err)
+			return false
+		}
+		members = append(members, m)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	return members, parseErr
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"cs739-kv-store/models"
+	"cs739-kv-store/repository"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+func TestMemberRegistry(t *testing.T) {
+	storage := repository.NewMapRepo()
+	s := &Kvstore{storage: storage, membersChanged: make(chan struct{})}
+	s.hash.reset(storage, 0)
+
+	one := models.Member{ID: 1, KVAddress: "localhost:6000", RaftAddress: "http://127.0.0.1:5000"}
+	two := models.Member{ID: 2, KVAddress: "localhost:6001", RaftAddress: "http://127.0.0.1:5001"}
+	_, _, changed, _ := s.Members()
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 2, Context: two.Context()}, 1)
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 1, Context: one.Context()}, 2)
+	// Adds from before the registry carry only the raft address.
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 3, Context: []byte("http://127.0.0.1:5002")}, 3)
+	select {
+	case <-changed:
+	default:
+		t.Fatalf("watchers not notified")
+	}
+
+	members, index, _, err := s.Members()
+	if err != nil {
+		t.Fatalf("Members: %v", err)
+	}
+	if want := []models.Member{one, two}; !reflect.DeepEqual(members, want) || index != 3 {
+		t.Fatalf("Members = %v at %d, want %v at 3", members, index, want)
+	}
+
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: 2}, 4)
+	// Replayed entries are skipped.
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 2, Context: two.Context()}, 4)
+	if m, ok, _ := s.Member(2); ok {
+		t.Fatalf("removed member still registered: %v", m)
+	}
+	if members, _ := ReadMembers(storage); !reflect.DeepEqual(members, []models.Member{one}) {
+		t.Fatalf("ReadMembers = %v, want %v", members, []models.Member{one})
+	}
+
+	if index, _ := repository.ReadAppliedIndex(storage); index != 4 {
+		t.Fatalf("applied index = %d, want 4", index)
+	}
+	var full stateHash
+	full.reset(storage, 4)
+	if s.hash.sum != full.sum {
+		t.Fatalf("incremental hash %x, full hash %x", s.hash.sum, full.sum)
+	}
+}
+
+func TestLearnerPromotion(t *testing.T) {
+	storage := repository.NewMapRepo()
+	s := &Kvstore{storage: storage, membersChanged: make(chan struct{})}
+	s.hash.reset(storage, 0)
+
+	four := models.Member{ID: 4, KVAddress: "localhost:6003", RaftAddress: "http://127.0.0.1:5003"}
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddLearnerNode, NodeID: 4, Context: four.Context()}, 1)
+	if m, _, _ := s.Member(4); !m.Learner {
+		t.Fatalf("member = %+v, want a learner", m)
+	}
+
+	// Promotion re-adds the member as a voter, whatever its context says.
+	learner := four
+	learner.Learner = true
+	s.applyConfChange(raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: 4, Context: learner.Context()}, 2)
+	if m, _, _ := s.Member(4); m != four {
+		t.Fatalf("member = %+v, want voter %+v", m, four)
+	}
+}
@@ -7,31 +7,74 @@ import (
 
 type PutService struct {
 	memoryRepo *repository.MemoryRepo
-	rdsRepo    *repository.RDSRepo
+	storage    repository.StorageEngine
 }
 
-func NewPutService(memoryRepo *repository.MemoryRepo, rdsRepo *repository.RDSRepo) *PutService {
+func NewPutService(memoryRepo *repository.MemoryRepo, storage repository.StorageEngine) *PutService {
 	return &PutService{
 		memoryRepo: memoryRepo,
-		rdsRepo:    rdsRepo,
+		storage:    storage,
 	}
 }
 
-func (s *PutService) Put(key string, value string) error {
+// Put writes the value committed at the given raft index to storage, along
+// with the index itself, then to the cache, so the cache never holds a value
+// the storage does not.
+func (s *PutService) Put(key string, value string, index uint64) error {
 	if s.memoryRepo == nil {
 		return nil
 	}
 
-	go func() {
-		if err := s.memoryRepo.Put(key, value); err != nil {
-			log.Printf("Error putting key: %s with value: %s in memory: %v\n", key, value, err)
-		}
-	}()
+	err := s.storage.Batch([]repository.Op{
+		{Type: repository.OpPut, Key: key, Value: value},
+		repository.AppliedIndexOp(index),
+	})
+	if err != nil {
+		log.Printf("Error putting key: %s with value: %s in storage: %v\n", key, value, err)
+		return err
+	}
+
+	s.memoryRepo.Put(key, value, index)
+	return nil
+}
+
+// PutBatch writes the pairs committed at the given raft index to storage in
+// one batch, then to the cache. Later pairs win over earlier ones with the same key.
+func (s *PutService) PutBatch(pairs []Pair, index uint64) error {
+	if s.memoryRepo == nil {
+		return nil
+	}
+
+	ops := make([]repository.Op, 0, len(pairs)+1)
+	for _, p := range pairs {
+		ops = append(ops, repository.Op{Type: repository.OpPut, Key: p.Key, Value: p.Value})
+	}
+	if err := s.storage.Batch(append(ops, repository.AppliedIndexOp(index))); err != nil {
+		log.Printf("Error putting batch of %d keys in storage: %v\n", len(pairs), err)
+		return err
+	}
+
+	for _, p := range pairs {
+		s.memoryRepo.Put(p.Key, p.Value, index)
+	}
+	return nil
+}
+
+// Delete removes the key deleted at the given raft index from storage and the cache.
+func (s *PutService) Delete(key string, index uint64) error {
+	if s.memoryRepo == nil {
+		return nil
+	}
 
-	if err := s.rdsRepo.Put(key, value); err != nil {
-		log.Printf("Error putting key: %s with value: %s in RDS: %v\n", key, value, err)
+	err := s.storage.Batch([]repository.Op{
+		{Type: repository.OpDelete, Key: key},
+		repository.AppliedIndexOp(index),
+	})
+	if err != nil {
+		log.Printf("Error deleting key: %s in storage: %v\n", key, err)
 		return err
 	}
 
+	s.memoryRepo.Invalidate(key, index)
 	return nil
 }
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"cs739-kv-store/repository"
+	"testing"
+	"time"
+)
+
+func TestApplyDeleteInvalidatesCache(t *testing.T) {
+	memoryRepo, err := repository.NewMemoryRepo(repository.CacheConfig{MaxBytes: 1 << 20, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer memoryRepo.Close()
+	storage := repository.NewMapRepo()
+	s := &Kvstore{memoryRepo: memoryRepo, storage: storage}
+	s.hash.reset(storage, 0)
+
+	s.apply(kv{Key: "k", Val: "v", Op: opPut}, 1)
+	if value, found, _ := s.Get("k"); !found || value != "v" {
+		t.Fatalf("k = %q, %v before the delete, want v", value, found)
+	}
+	s.apply(kv{Key: "k", Op: opDelete}, 2)
+	if value, found, _ := s.Get("k"); found {
+		t.Fatalf("k = %q after the delete, want it missing", value)
+	}
+	// A put replayed from before the delete must not bring the value back.
+	memoryRepo.Put("k", "v", 1)
+	if value, found, _ := s.Get("k"); found {
+		t.Fatalf("k = %q after a stale put, want it missing", value)
+	}
+	if index, _ := repository.ReadAppliedIndex(storage); index != 2 {
+		t.Fatalf("applied index = %d, want 2", index)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"cs739-kv-store/models"
+	"cs739-kv-store/repository"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+)
+
+const rebuildTestKey = "000102030405060708090a0b0c0d0e0f000102030405060708090a0b0c0d0e0f"
+
+// newTestStore returns a store over storage that applies entries directly.
+func newTestStore(t *testing.T, storage repository.StorageEngine) *Kvstore {
+	t.Helper()
+	memoryRepo, err := repository.NewMemoryRepo(repository.CacheConfig{MaxBytes: 1 << 20, TTL: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(memoryRepo.Close)
+	s := &Kvstore{memoryRepo: memoryRepo, storage: storage, membersChanged: make(chan struct{})}
+	s.hash.reset(storage, 0)
+	return s
+}
+
+func TestRebuildIntoAnotherEngineAndCodec(t *testing.T) {
+	keyring, err := repository.ParseKeyring("k1 " + rebuildTestKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposalCodec := repository.NewAESGCMCodec(keyring)
+
+	// The node that wrote the log kept compressed values in memory.
+	source := newTestStore(t, repository.NewCodecRepo(repository.NewMapRepo(), repository.NewFlateCodec(1)))
+	var entries []raftpb.Entry
+	apply := func(index uint64, cmd kv) {
+		data, err := encodeCommand(cmd, proposalCodec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, raftpb.Entry{Term: 1, Index: index, Type: raftpb.EntryNormal, Data: []byte(data)})
+		source.apply(cmd, index)
+	}
+	addMember := func(index uint64, m models.Member) {
+		cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: m.ID, Context: m.Context()}
+		data, err := cc.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, raftpb.Entry{Term: 1, Index: index, Type: raftpb.EntryConfChange, Data: data})
+		source.applyConfChange(cc, index)
+	}
+
+	apply(1, kv{Key: "a", Val: "1", Op: opPut})
+	apply(2, kv{Key: "b", Val: "2", Op: opPut})
+	addMember(3, models.Member{ID: 2, KVAddress: "localhost:6001", RaftAddress: "http://127.0.0.1:5001"})
+	snapshotData, err := source.storage.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = entries[:0] // compacted into the snapshot
+	apply(4, kv{Key: "a", Val: "changed", Op: opPut})
+	apply(5, kv{Op: opPutBatch, Pairs: []Pair{{"c", "3"}, {"d", "4"}}})
+	apply(6, kv{Key: "b", Op: opDelete})
+	addMember(7, models.Member{ID: 3, KVAddress: "localhost:6002", RaftAddress: "http://127.0.0.1:5002"})
+	want := source.hash.sum
+	// Proposed but never committed.
+	data, _ := encodeCommand(kv{Key: "a", Val: "uncommitted", Op: opPut}, proposalCodec)
+	entries = append(entries, raftpb.Entry{Term: 1, Index: 8, Type: raftpb.EntryNormal, Data: []byte(data)})
+
+	dir := t.TempDir()
+	snapdir, waldir := filepath.Join(dir, "snap"), filepath.Join(dir, "wal")
+	writeRaftLog(t, snapdir, waldir, raftpb.Snapshot{
+		Data:     snapshotData,
+		Metadata: raftpb.SnapshotMetadata{Index: 3, Term: 1, ConfState: raftpb.ConfState{Voters: []uint64{1, 2}}},
+	}, entries, 7)
+
+	// Rebuild into bolt, encrypting values at rest.
+	engine, err := repository.OpenBoltRepo(filepath.Join(dir, "kv.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	storage := repository.NewCodecRepo(engine, repository.NewFlateCodec(0), repository.NewAESGCMCodec(keyring))
+	index, err := Rebuild(storage, snapdir, waldir, proposalCodec, 0)
+	if err != nil {
+		t.Fatalf("Rebuild: %v", err)
+	}
+	if index != 7 {
+		t.Fatalf("rebuilt to index %d, want the commit index 7", index)
+	}
+	if applied, _ := repository.ReadAppliedIndex(storage); applied != 7 {
+		t.Fatalf("applied index = %d, want 7", applied)
+	}
+	for key, value := range map[string]string{"a": "changed", "c": "3", "d": "4"} {
+		if got, _, _ := storage.Get(key); got != value {
+			t.Fatalf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if _, found, _ := storage.Get("b"); found {
+		t.Fatalf("deleted key b was rebuilt")
+	}
+	if members, _ := ReadMembers(storage); len(members) != 2 || members[1].ID != 3 {
+		t.Fatalf("members = %v, want 2 and 3", members)
+	}
+	if raw, _, _ := engine.Get("a"); raw == "changed" {
+		t.Fatalf("value stored in plaintext, want it encrypted")
+	}
+	var rebuilt stateHash
+	rebuilt.reset(storage, index)
+	if rebuilt.sum != want {
+		t.Fatalf("state hash %x after rebuild, want %x", rebuilt.sum, want)
+	}
+
+	// The applied index the node reached counts as committed.
+	again := repository.NewCodecRepo(repository.NewMapRepo(), repository.NewFlateCodec(0), repository.NewAESGCMCodec(keyring))
+	if index, err := Rebuild(again, snapdir, waldir, proposalCodec, 8); err != nil || index != 8 {
+		t.Fatalf("Rebuild with minCommit 8 = %d, %v; want index 8", index, err)
+	}
+	if value, _, _ := again.Get("a"); value != "uncommitted" {
+		t.Fatalf("a = %q, want the entry up to minCommit applied", value)
+	}
+}
+
+// writeRaftLog saves snapshot and a WAL that starts at it and holds entries,
+// committed up to commit.
+func writeRaftLog(t *testing.T, snapdir, waldir string, snapshot raftpb.Snapshot, entries []raftpb.Entry, commit uint64) {
+	t.Helper()
+	lg := zap.NewNop()
+	if err := os.MkdirAll(snapdir, 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := snap.New(lg, snapdir).SaveSnap(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	w, err := wal.Create(lg, waldir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	meta := snapshot.Metadata
+	if err := w.SaveSnapshot(walpb.Snapshot{Index: meta.Index, Term: meta.Term, ConfState: &meta.ConfState}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Save(raftpb.HardState{Term: 1, Commit: commit}, entries); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crypto/sha256"
+	"cs739-kv-store/repository"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// stateHashHistory is how many applied indexes a node can at least report its hash for.
+const stateHashHistory = 4096
+
+var ErrHashCompacted = errors.New("state hash for the requested index is no longer kept")
+
+// stateHash is an order-independent hash of every key-value pair in the
+// state machine: the sum of a hash of each pair. Applying a write only
+// subtracts the old pair and adds the new one, so it is cheap to keep current.
+// Node-local keys under repository.MetaPrefix are left out.
+type stateHash struct {
+	sum     uint64
+	history []hashRecord // ascending by index
+}
+
+type hashRecord struct {
+	index uint64
+	hash  uint64
+}
+
+func pairHash(key, value string) uint64 {
+	h := sha256.New()
+	var n [binary.MaxVarintLen64]byte
+	h.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	h.Write([]byte(key))
+	h.Write([]byte(value))
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
+
+func hashed(key string) bool {
+	return !strings.HasPrefix(key, repository.MetaPrefix)
+}
+
+// reset recomputes the hash from the full contents of storage, as of index.
+func (h *stateHash) reset(storage repository.StorageEngine, index uint64) error {
+	h.sum = 0
+	h.history = h.history[:0]
+	err := storage.Range("", "", func(key, value string) bool {
+		if hashed(key) {
+			h.sum += pairHash(key, value)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	h.record(index)
+	return nil
+}
+
+// update accounts for key changing from old (if it existed) to value (if it exists).
+func (h *stateHash) update(key, old string, oldFound bool, value string, found bool) {
+	if !hashed(key) {
+		return
+	}
+	if oldFound {
+		h.sum -= pairHash(key, old)
+	}
+	if found {
+		h.sum += pairHash(key, value)
+	}
+}
+
+// record remembers the current hash as the hash at index.
+func (h *stateHash) record(index uint64) {
+	if len(h.history) == 2*stateHashHistory {
+		h.history = append(h.history[:0], h.history[stateHashHistory:]...)
+	}
+	h.history = append(h.history, hashRecord{index: index, hash: h.sum})
+}
+
+// at returns the hash of the state as of index: the last record at or
+// before it. The caller must make sure index has been applied.
+func (h *stateHash) at(index uint64) (uint64, error) {
+	i := sort.Search(len(h.history), func(i int) bool { return h.history[i].index > index })
+	if i == 0 {
+		return 0, ErrHashCompacted
+	}
+	return h.history[i-1].hash, nil
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"cs739-kv-store/repository"
+	"errors"
+	"testing"
+)
+
+func TestStateHashIsOrderIndependent(t *testing.T) {
+	a, b := repository.NewMapRepo(), repository.NewMapRepo()
+	a.Put("x", "1")
+	a.Put("y", "2")
+	b.Put("y", "2")
+	b.Put("x", "1")
+	b.Batch([]repository.Op{repository.AppliedIndexOp(7)})
+
+	var ha, hb stateHash
+	if err := ha.reset(a, 1); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if err := hb.reset(b, 1); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if ha.sum != hb.sum {
+		t.Fatalf("hashes of equal states differ: %x != %x", ha.sum, hb.sum)
+	}
+
+	// Swapping values between keys must change the hash.
+	b.Put("x", "2")
+	b.Put("y", "1")
+	hb.reset(b, 1)
+	if ha.sum == hb.sum {
+		t.Fatalf("hashes of different states are equal")
+	}
+}
+
+func TestStateHashIncrementalMatchesFull(t *testing.T) {
+	storage := repository.NewMapRepo()
+	var h stateHash
+	h.reset(storage, 0)
+
+	apply := func(index uint64, key, value string, found bool) {
+		old, oldFound, _ := storage.Get(key)
+		if found {
+			storage.Put(key, value)
+		} else {
+			storage.Delete(key)
+		}
+		h.update(key, old, oldFound, value, found)
+		h.record(index)
+	}
+	apply(1, "a", "1", true)
+	apply(2, "b", "2", true)
+	apply(3, "a", "3", true)
+	apply(5, "b", "", false)
+
+	var full stateHash
+	full.reset(storage, 5)
+	if h.sum != full.sum {
+		t.Fatalf("incremental hash %x, full hash %x", h.sum, full.sum)
+	}
+
+	at2, _ := h.at(2)
+	at4, _ := h.at(4)
+	at3, _ := h.at(3)
+	if at4 != at3 || at2 == at3 {
+		t.Fatalf("history lookup: at(2)=%x at(3)=%x at(4)=%x", at2, at3, at4)
+	}
+}
+
+func TestStateHashHistoryIsBounded(t *testing.T) {
+	var h stateHash
+	for i := uint64(1); i <= 3*stateHashHistory; i++ {
+		h.record(i)
+	}
+	if len(h.history) > 2*stateHashHistory {
+		t.Fatalf("history grew to %d records", len(h.history))
+	}
+	if _, err := h.at(1); !errors.Is(err, ErrHashCompacted) {
+		t.Fatalf("at(1) = %v, want ErrHashCompacted", err)
+	}
+	if _, err := h.at(3 * stateHashHistory); err != nil {
+		t.Fatalf("at(latest): %v", err)
+	}
+}